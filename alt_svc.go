@@ -0,0 +1,625 @@
+package tls_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	quic "github.com/bogdanfinn/quic-go-utls"
+	"github.com/bogdanfinn/quic-go-utls/http3"
+	tls "github.com/bogdanfinn/utls"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// defaultAltSvcMaxAge is the freshness of an alternative service without ma parameter (RFC 7838, section 3.1)
+	defaultAltSvcMaxAge = 24 * time.Hour
+	// altSvcRefreshInterval avoids rewriting unchanged entries on every response, only their expiry moved
+	altSvcRefreshInterval = time.Minute
+	// like Chrome a broken alternative service is not used for 5 minutes, doubled on every further failure up to 2 days
+	altSvcBrokenDuration    = 5 * time.Minute
+	altSvcMaxBrokenDuration = 48 * time.Hour
+)
+
+// AltSvcEntry is an alternative service an origin advertised with the Alt-Svc header (RFC 7838).
+type AltSvcEntry struct {
+	// Protocol is the ALPN protocol id of the alternative service, e.g. h3.
+	Protocol string `json:"protocol"`
+	// Host is empty if the alternative service is on the host of the origin.
+	Host    string    `json:"host,omitempty"`
+	Port    int       `json:"port"`
+	Expires time.Time `json:"expires"`
+}
+
+// AltSvcStorage stores the alternative services of origins like "https://example.com:443".
+// Implementations have to be safe for concurrent use, as the storage can be shared between clients.
+type AltSvcStorage interface {
+	// Get returns the entries of the origin including expired ones, nil if there are none.
+	Get(origin string) []AltSvcEntry
+	// Set replaces the entries of the origin.
+	Set(origin string, entries []AltSvcEntry)
+	// Delete removes the entries of the origin.
+	Delete(origin string)
+}
+
+type memoryAltSvcStorage struct {
+	mu      sync.RWMutex
+	entries map[string][]AltSvcEntry
+}
+
+// NewMemoryAltSvcStorage returns an AltSvcStorage which keeps the entries in memory.
+func NewMemoryAltSvcStorage() AltSvcStorage {
+	return &memoryAltSvcStorage{
+		entries: make(map[string][]AltSvcEntry),
+	}
+}
+
+func (s *memoryAltSvcStorage) Get(origin string) []AltSvcEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]AltSvcEntry(nil), s.entries[origin]...)
+}
+
+func (s *memoryAltSvcStorage) Set(origin string, entries []AltSvcEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[origin] = append([]AltSvcEntry(nil), entries...)
+}
+
+func (s *memoryAltSvcStorage) Delete(origin string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, origin)
+}
+
+type fileAltSvcStorage struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string][]AltSvcEntry
+}
+
+// NewFileAltSvcStorage returns an AltSvcStorage which persists the entries as JSON in the file at path, so they survive
+// restarts like the Alt-Svc cache of a browser. The file is loaded once and rewritten on every change.
+// A failed write keeps the entries in memory and is retried with the next change.
+func NewFileAltSvcStorage(path string) (AltSvcStorage, error) {
+	s := &fileAltSvcStorage{
+		path:    path,
+		entries: make(map[string][]AltSvcEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return s, nil
+	}
+
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *fileAltSvcStorage) Get(origin string) []AltSvcEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]AltSvcEntry(nil), s.entries[origin]...)
+}
+
+func (s *fileAltSvcStorage) Set(origin string, entries []AltSvcEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[origin] = append([]AltSvcEntry(nil), entries...)
+	s.write()
+}
+
+func (s *fileAltSvcStorage) Delete(origin string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[origin]; !ok {
+		return
+	}
+
+	delete(s.entries, origin)
+	s.write()
+}
+
+// write replaces the file with a temporary file, so a crash never leaves a partially written file behind.
+func (s *fileAltSvcStorage) write() {
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		_ = os.Remove(tmpPath)
+	}
+}
+
+type brokenAltSvc struct {
+	until    time.Time
+	failures int
+}
+
+// altSvcCache remembers the alternative services of origins in its storage and which of them failed.
+// Without storage it only remembers the failures of the alternatives of HTTPS records.
+type altSvcCache struct {
+	storage AltSvcStorage
+
+	brokenMu sync.Mutex
+	broken   map[string]*brokenAltSvc
+
+	now func() time.Time
+}
+
+func newAltSvcCache(storage AltSvcStorage) *altSvcCache {
+	return &altSvcCache{
+		storage: storage,
+		broken:  make(map[string]*brokenAltSvc),
+		now:     time.Now,
+	}
+}
+
+// lookup returns the first fresh HTTP/3 alternative of the origin which is not broken. Expired entries are removed.
+func (c *altSvcCache) lookup(origin string) (AltSvcEntry, bool) {
+	if c.storage == nil {
+		return AltSvcEntry{}, false
+	}
+
+	entries := c.storage.Get(origin)
+	if len(entries) == 0 {
+		return AltSvcEntry{}, false
+	}
+
+	now := c.now()
+	fresh := entries[:0:0]
+
+	for _, entry := range entries {
+		if now.Before(entry.Expires) {
+			fresh = append(fresh, entry)
+		}
+	}
+
+	if len(fresh) != len(entries) {
+		if len(fresh) == 0 {
+			c.storage.Delete(origin)
+		} else {
+			c.storage.Set(origin, fresh)
+		}
+	}
+
+	for _, entry := range fresh {
+		if entry.Protocol != http3.NextProtoH3 || c.isBroken(origin, entry) {
+			continue
+		}
+
+		return entry, true
+	}
+
+	return AltSvcEntry{}, false
+}
+
+// update stores the alternatives of the Alt-Svc header values of a response of the origin. A response without Alt-Svc
+// header keeps the known alternatives, "clear" removes them.
+func (c *altSvcCache) update(origin string, values []string) {
+	if c.storage == nil || len(values) == 0 {
+		return
+	}
+
+	entries, clear := parseAltSvc(values, c.now())
+	if clear {
+		c.storage.Delete(origin)
+		return
+	}
+
+	if len(entries) == 0 || !c.changed(c.storage.Get(origin), entries) {
+		return
+	}
+
+	c.storage.Set(origin, entries)
+}
+
+// changed reports whether the entries differ in their alternatives or moved their expiry by more than the refresh interval.
+func (c *altSvcCache) changed(stored []AltSvcEntry, entries []AltSvcEntry) bool {
+	if len(stored) != len(entries) {
+		return true
+	}
+
+	for i := range entries {
+		if stored[i].Protocol != entries[i].Protocol || stored[i].Host != entries[i].Host || stored[i].Port != entries[i].Port {
+			return true
+		}
+
+		if entries[i].Expires.Sub(stored[i].Expires).Abs() > altSvcRefreshInterval {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *altSvcCache) isBroken(origin string, entry AltSvcEntry) bool {
+	c.brokenMu.Lock()
+	defer c.brokenMu.Unlock()
+
+	broken, ok := c.broken[altSvcKey(origin, entry)]
+
+	return ok && c.now().Before(broken.until)
+}
+
+// markBroken skips the alternative until its broken duration passed, which doubles with every failure.
+func (c *altSvcCache) markBroken(origin string, entry AltSvcEntry) {
+	c.brokenMu.Lock()
+	defer c.brokenMu.Unlock()
+
+	key := altSvcKey(origin, entry)
+
+	broken, ok := c.broken[key]
+	if !ok {
+		broken = &brokenAltSvc{}
+		c.broken[key] = broken
+	}
+
+	duration := altSvcMaxBrokenDuration
+	if broken.failures < 10 {
+		duration = min(altSvcBrokenDuration<<broken.failures, altSvcMaxBrokenDuration)
+	}
+
+	broken.failures++
+	broken.until = c.now().Add(duration)
+}
+
+// confirm forgets the failures of an alternative which worked again.
+func (c *altSvcCache) confirm(origin string, entry AltSvcEntry) {
+	c.brokenMu.Lock()
+	defer c.brokenMu.Unlock()
+
+	delete(c.broken, altSvcKey(origin, entry))
+}
+
+func altSvcKey(origin string, entry AltSvcEntry) string {
+	return origin + " " + entry.Protocol + "=" + net.JoinHostPort(entry.Host, strconv.Itoa(entry.Port))
+}
+
+// parseAltSvc parses the values of Alt-Svc headers. Invalid alternatives are skipped. clear is set if the origin
+// revoked all of its alternatives.
+func parseAltSvc(values []string, now time.Time) (entries []AltSvcEntry, clear bool) {
+	for _, value := range values {
+		for _, alternative := range splitAltSvc(value, ',') {
+			alternative = strings.TrimSpace(alternative)
+			if alternative == "" {
+				continue
+			}
+
+			if alternative == "clear" {
+				return nil, true
+			}
+
+			params := splitAltSvc(alternative, ';')
+
+			protocolId, authority, ok := strings.Cut(strings.TrimSpace(params[0]), "=")
+			if !ok {
+				continue
+			}
+
+			protocol, err := url.PathUnescape(strings.TrimSpace(protocolId))
+			if err != nil || protocol == "" {
+				continue
+			}
+
+			host, portStr, err := net.SplitHostPort(unquoteAltSvc(strings.TrimSpace(authority)))
+			if err != nil {
+				continue
+			}
+
+			port, err := strconv.Atoi(portStr)
+			if err != nil || port <= 0 || port > math.MaxUint16 {
+				continue
+			}
+
+			maxAge := defaultAltSvcMaxAge
+
+			for _, param := range params[1:] {
+				name, paramValue, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(name), "ma") {
+					continue
+				}
+
+				seconds, err := strconv.ParseInt(unquoteAltSvc(strings.TrimSpace(paramValue)), 10, 64)
+				if err != nil || seconds < 0 {
+					continue
+				}
+
+				maxAge = time.Duration(min(seconds, int64(math.MaxInt64/time.Second))) * time.Second
+			}
+
+			entries = append(entries, AltSvcEntry{
+				Protocol: protocol,
+				Host:     host,
+				Port:     port,
+				Expires:  now.Add(maxAge),
+			})
+		}
+	}
+
+	return entries, false
+}
+
+// splitAltSvc splits the value at every separator outside of quoted strings.
+func splitAltSvc(value string, separator byte) []string {
+	var parts []string
+
+	quoted := false
+	escaped := false
+	start := 0
+
+	for i := 0; i < len(value); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && value[i] == '\\':
+			escaped = true
+		case value[i] == '"':
+			quoted = !quoted
+		case !quoted && value[i] == separator:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, value[start:])
+}
+
+// unquoteAltSvc returns the content of a quoted string, other values are returned unchanged.
+func unquoteAltSvc(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+
+	var unquoted strings.Builder
+
+	for i := 1; i < len(value)-1; i++ {
+		if value[i] == '\\' && i+1 < len(value)-1 {
+			i++
+		}
+
+		unquoted.WriteByte(value[i])
+	}
+
+	return unquoted.String()
+}
+
+// roundTripWithAltSvc sends the request to the HTTP/3 alternative of the origin if one is known from an Alt-Svc header
+// or an HTTPS record. If the alternative fails, it is marked as broken and the request is retried over TCP like Chrome does.
+func (rt *roundTripper) roundTripWithAltSvc(req *http.Request, addr string) (*http.Response, error) {
+	origin := "https://" + addr
+
+	if alternative, ok := rt.lookupAlternative(req.Context(), origin, addr); ok {
+		transport, err := rt.getAltSvcTransport(addr, alternative)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := transport.RoundTrip(req)
+		if err == nil {
+			rt.altSvc.confirm(origin, alternative)
+			rt.altSvc.update(origin, resp.Header.Values("Alt-Svc"))
+
+			return resp, nil
+		}
+
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+
+		rt.altSvc.markBroken(origin, alternative)
+
+		// a request is only sent again if the QUIC connection failed before it was sent or it can be repeated safely
+		var dialErr *quicDialError
+		if !errors.As(err, &dialErr) && !isReplayable(req) {
+			return nil, err
+		}
+
+		// the body was consumed by the failed attempt
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, err
+			}
+
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, err
+			}
+
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+
+	resp, err := rt.roundTripAddr(req, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	rt.altSvc.update(origin, resp.Header.Values("Alt-Svc"))
+
+	return resp, nil
+}
+
+// lookupAlternative returns the HTTP/3 alternative of the origin which is not broken. Alternatives of Alt-Svc headers
+// take precedence over HTTPS records.
+func (rt *roundTripper) lookupAlternative(ctx context.Context, origin string, addr string) (AltSvcEntry, bool) {
+	if !rt.canDialQUIC() {
+		return AltSvcEntry{}, false
+	}
+
+	if alternative, ok := rt.altSvc.lookup(origin); ok {
+		return alternative, true
+	}
+
+	record := rt.lookupHTTPSRecord(ctx, addr)
+	if record == nil || !record.supportsALPN(http3.NextProtoH3) {
+		return AltSvcEntry{}, false
+	}
+
+	_, portStr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+
+	alternative := AltSvcEntry{
+		Protocol: http3.NextProtoH3,
+		Host:     record.Target,
+		Port:     port,
+	}
+
+	// like TCP connections QUIC connections use the address hints of the record if the origin is dialed directly
+	// and its address is not overridden
+	if alternative.Host == "" && isDirectDialer(rt.dialer) && !rt.resolveOverrides.contains(addr) {
+		var hints []net.IP
+		if !rt.disableIPV6 {
+			hints = append(hints, record.IPv6Hint...)
+		}
+
+		if !rt.disableIPV4 {
+			hints = append(hints, record.IPv4Hint...)
+		}
+
+		if len(hints) > 0 {
+			alternative.Host = hints[0].String()
+		}
+	}
+
+	if rt.altSvc.isBroken(origin, alternative) {
+		return AltSvcEntry{}, false
+	}
+
+	return alternative, true
+}
+
+// getAltSvcTransport returns the HTTP/3 transport which dials the alternative instead of the origin. The TLS server
+// name stays the host of the origin, as the alternative has to present a certificate for the origin (RFC 7838, section 2.1).
+func (rt *roundTripper) getAltSvcTransport(addr string, alternative AltSvcEntry) (http.RoundTripper, error) {
+	host := alternative.Host
+	if host == "" {
+		host, _, _ = net.SplitHostPort(addr)
+	}
+
+	alternativeAddr := net.JoinHostPort(host, strconv.Itoa(alternative.Port))
+
+	transportKey := addr + ":h3"
+	if alternativeAddr != addr {
+		transportKey += "@" + alternativeAddr
+	}
+
+	rt.cachedTransportsLck.Lock()
+	defer rt.cachedTransportsLck.Unlock()
+
+	if transport, ok := rt.cachedTransports[transportKey]; ok {
+		return transport, nil
+	}
+
+	http3Config := rt.getHTTP3Config()
+	if alternativeAddr != addr {
+		http3Config.dialAddr = alternativeAddr
+	}
+
+	transport, err := buildHTTP3Transport(http3Config)
+	if err != nil {
+		return nil, err
+	}
+
+	if t3, ok := transport.(*http3.Transport); ok {
+		dial := t3.Dial
+		if dial == nil {
+			dial = newDirectQUICDial(nil, "")
+		}
+
+		t3.Dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			conn, err := dial(ctx, addr, tlsCfg, cfg)
+			if err != nil {
+				return nil, &quicDialError{err: err}
+			}
+
+			return conn, nil
+		}
+	}
+
+	rt.cachedTransports[transportKey] = transport
+
+	return transport, nil
+}
+
+// canDialQUIC reports whether QUIC connections reach the target the same way the TCP connections do, i.e. directly
+// or through a proxy which tunnels QUIC. QUIC connections cannot carry the PROXY protocol header of the TCP connections.
+func (rt *roundTripper) canDialQUIC() bool {
+	if _, ok := rt.dialer.(*proxyProtocolDialer); ok {
+		return false
+	}
+
+	return rt.packetDialer != nil || isDirectDialer(rt.dialer)
+}
+
+func isDirectDialer(dialer proxy.ContextDialer) bool {
+	switch d := dialer.(type) {
+	case *directDialer, *happyEyeballsDialer:
+		return true
+	case *proxyProtocolDialer:
+		return isDirectDialer(d.dialer)
+	}
+
+	return dialer == proxy.Direct
+}
+
+// quicDialError is the error of a QUIC connection to an alternative which failed before a request was sent on it.
+type quicDialError struct {
+	err error
+}
+
+func (e *quicDialError) Error() string {
+	return e.err.Error()
+}
+
+func (e *quicDialError) Unwrap() error {
+	return e.err
+}
+
+// isReplayable reports whether the request can be sent again after it may have reached the server, following the
+// rules of net/http: the method is idempotent or the request has an idempotency key, and the body can be recreated.
+func isReplayable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	return len(req.Header.Values("Idempotency-Key")) > 0 || len(req.Header.Values("X-Idempotency-Key")) > 0
+}
@@ -0,0 +1,197 @@
+package tls_client
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+func TestParseAltSvc(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name            string
+		values          []string
+		expectedEntries []AltSvcEntry
+		expectedClear   bool
+	}{
+		{
+			name:   "default max age",
+			values: []string{`h3=":443"`},
+			expectedEntries: []AltSvcEntry{
+				{Protocol: "h3", Port: 443, Expires: now.Add(24 * time.Hour)},
+			},
+		},
+		{
+			name:   "several alternatives and header fields",
+			values: []string{`h3=":443"; ma=2592000, h3-29=":8443"; ma=60; persist=1`, `h2="alt.example.com:443"`},
+			expectedEntries: []AltSvcEntry{
+				{Protocol: "h3", Port: 443, Expires: now.Add(2592000 * time.Second)},
+				{Protocol: "h3-29", Port: 8443, Expires: now.Add(time.Minute)},
+				{Protocol: "h2", Host: "alt.example.com", Port: 443, Expires: now.Add(24 * time.Hour)},
+			},
+		},
+		{
+			name:   "quoted max age and percent encoded protocol id",
+			values: []string{`w%3Dx%3Ay="[::1]:443";ma="10"`},
+			expectedEntries: []AltSvcEntry{
+				{Protocol: "w=x:y", Host: "::1", Port: 443, Expires: now.Add(10 * time.Second)},
+			},
+		},
+		{
+			name:   "invalid alternatives are skipped",
+			values: []string{`h3, h3=":0", h3="example.com", h3=":443"`},
+			expectedEntries: []AltSvcEntry{
+				{Protocol: "h3", Port: 443, Expires: now.Add(24 * time.Hour)},
+			},
+		},
+		{
+			name:          "clear",
+			values:        []string{"clear"},
+			expectedClear: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		entries, clear := parseAltSvc(testCase.values, now)
+
+		if clear != testCase.expectedClear || !reflect.DeepEqual(entries, testCase.expectedEntries) {
+			t.Errorf("%s: got %+v (clear %v), expected %+v (clear %v)", testCase.name, entries, clear, testCase.expectedEntries, testCase.expectedClear)
+		}
+	}
+}
+
+func TestAltSvcCache_Expiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cache := newAltSvcCache(NewMemoryAltSvcStorage())
+	cache.now = func() time.Time { return now }
+
+	cache.update("https://example.com:443", []string{`h2=":443", h3=":443"; ma=60`})
+
+	entry, ok := cache.lookup("https://example.com:443")
+	if !ok || entry.Protocol != "h3" || entry.Port != 443 {
+		t.Fatalf("expected the h3 alternative, got %+v", entry)
+	}
+
+	now = now.Add(time.Minute)
+
+	if entry, ok := cache.lookup("https://example.com:443"); ok {
+		t.Fatalf("expected the h3 alternative to be expired, got %+v", entry)
+	}
+
+	// only the fresh h2 alternative is left
+	if entries := cache.storage.Get("https://example.com:443"); len(entries) != 1 || entries[0].Protocol != "h2" {
+		t.Fatalf("expected the expired alternative to be removed, got %+v", entries)
+	}
+
+	cache.update("https://example.com:443", []string{"clear"})
+
+	if entries := cache.storage.Get("https://example.com:443"); len(entries) != 0 {
+		t.Fatalf("expected clear to remove all alternatives, got %+v", entries)
+	}
+}
+
+func TestAltSvcCache_Broken(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cache := newAltSvcCache(NewMemoryAltSvcStorage())
+	cache.now = func() time.Time { return now }
+
+	cache.update("https://example.com:443", []string{`h3=":443"; ma=86400`})
+
+	entry, _ := cache.lookup("https://example.com:443")
+
+	// the broken duration doubles with every failure
+	for _, brokenDuration := range []time.Duration{5 * time.Minute, 10 * time.Minute} {
+		cache.markBroken("https://example.com:443", entry)
+
+		if _, ok := cache.lookup("https://example.com:443"); ok {
+			t.Fatal("expected the broken alternative to be skipped")
+		}
+
+		now = now.Add(brokenDuration)
+
+		if _, ok := cache.lookup("https://example.com:443"); !ok {
+			t.Fatalf("expected the alternative to be used again after %s", brokenDuration)
+		}
+	}
+
+	cache.confirm("https://example.com:443", entry)
+	cache.markBroken("https://example.com:443", entry)
+	now = now.Add(5 * time.Minute)
+
+	if _, ok := cache.lookup("https://example.com:443"); !ok {
+		t.Fatal("expected a confirmed alternative to start over with the initial broken duration")
+	}
+}
+
+func TestFileAltSvcStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alt-svc.json")
+
+	storage, err := NewFileAltSvcStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []AltSvcEntry{{Protocol: "h3", Host: "alt.example.com", Port: 443, Expires: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	storage.Set("https://example.com:443", entries)
+	storage.Set("https://example.org:443", entries)
+	storage.Delete("https://example.org:443")
+
+	storage, err = NewFileAltSvcStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := storage.Get("https://example.com:443"); !reflect.DeepEqual(got, entries) {
+		t.Fatalf("expected %+v, got %+v", entries, got)
+	}
+
+	if got := storage.Get("https://example.org:443"); got != nil {
+		t.Fatalf("expected the deleted origin to be gone, got %+v", got)
+	}
+}
+
+func TestIsReplayable(t *testing.T) {
+	newRequest := func(method string, body string) *http.Request {
+		req, err := http.NewRequest(method, "https://example.com", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return req
+	}
+
+	post := newRequest(http.MethodPost, "body")
+
+	idempotentPost := newRequest(http.MethodPost, "body")
+	idempotentPost.Header.Set("Idempotency-Key", "key")
+
+	// a body which cannot be recreated is never sent again
+	withoutGetBody := newRequest(http.MethodPut, "body")
+	withoutGetBody.Header.Set("Idempotency-Key", "key")
+	withoutGetBody.GetBody = nil
+
+	testCases := []struct {
+		name     string
+		req      *http.Request
+		expected bool
+	}{
+		{"GET", newRequest(http.MethodGet, ""), true},
+		{"HEAD", newRequest(http.MethodHead, ""), true},
+		{"POST", post, false},
+		{"POST with idempotency key", idempotentPost, true},
+		{"PUT without GetBody", withoutGetBody, false},
+	}
+
+	for _, testCase := range testCases {
+		if actual := isReplayable(testCase.req); actual != testCase.expected {
+			t.Errorf("%s: expected %v, got %v", testCase.name, testCase.expected, actual)
+		}
+	}
+}
@@ -27,7 +27,8 @@ export interface TLSClientRequestPayload {
     headers?: { [key: string]: string };
     headerOrder?: string[];
     customTlsClient?: {
-        ja3String: string;
+        ja3String?: string;
+        ja4String?: string;
         h2Settings: {
             HEADER_TABLE_SIZE: number;
             MAX_CONCURRENT_STREAMS: number;
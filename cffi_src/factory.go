@@ -312,7 +312,12 @@ func getTlsClient(requestInput RequestInput, sessionId string, withSession bool)
 	}
 
 	if tlsClientIdentifier != "" {
-		clientProfile = getTlsClientProfile(tlsClientIdentifier)
+		var err error
+
+		clientProfile, err = getTlsClientProfile(tlsClientIdentifier)
+		if err != nil {
+			return nil, fmt.Errorf("can not resolve tls client identifier: %w", err)
+		}
 	}
 
 	timeoutOption := tls_client.WithTimeoutSeconds(tls_client.DefaultTimeoutSeconds)
@@ -443,7 +448,18 @@ func getTlsClient(requestInput RequestInput, sessionId string, withSession bool)
 }
 
 func getCustomTlsClientProfile(customClientDefinition *CustomTlsClient) (tls.ClientHelloID, map[http2.SettingID]uint32, []http2.SettingID, []string, uint32, []http2.Priority, *http2.PriorityParam, uint32, bool, map[uint64]uint64, []uint64, uint32, []string, bool, error) {
-	specFactory, err := tls_client.GetSpecFactoryFromJa3String(customClientDefinition.Ja3String, customClientDefinition.SupportedSignatureAlgorithms, customClientDefinition.SupportedDelegatedCredentialsAlgorithms, customClientDefinition.SupportedVersions, customClientDefinition.KeyShareCurves, customClientDefinition.ALPNProtocols, customClientDefinition.ALPSProtocols, customClientDefinition.ECHCandidateCipherSuites.Translate(), customClientDefinition.ECHCandidatePayloads, customClientDefinition.CertCompressionAlgos, customClientDefinition.RecordSizeLimit)
+	var specFactory func() (tls.ClientHelloSpec, error)
+	var err error
+
+	switch {
+	case customClientDefinition.Ja3String != "" && customClientDefinition.Ja4String != "":
+		err = fmt.Errorf("ja3String and ja4String can not be used together")
+	case customClientDefinition.Ja4String != "":
+		specFactory, err = tls_client.GetSpecFactoryFromJa4String(customClientDefinition.Ja4String, customClientDefinition.SupportedSignatureAlgorithms, customClientDefinition.KeyShareCurves, customClientDefinition.ALPNProtocols, customClientDefinition.CertCompressionAlgos)
+	default:
+		specFactory, err = tls_client.GetSpecFactoryFromJa3String(customClientDefinition.Ja3String, customClientDefinition.SupportedSignatureAlgorithms, customClientDefinition.SupportedDelegatedCredentialsAlgorithms, customClientDefinition.SupportedVersions, customClientDefinition.KeyShareCurves, customClientDefinition.ALPNProtocols, customClientDefinition.ALPSProtocols, customClientDefinition.ECHCandidateCipherSuites.Translate(), customClientDefinition.ECHCandidatePayloads, customClientDefinition.CertCompressionAlgos, customClientDefinition.RecordSizeLimit)
+	}
+
 	if err != nil {
 		return tls.ClientHelloID{}, nil, nil, nil, 0, nil, nil, 0, false, nil, nil, 0, nil, false, err
 	}
@@ -528,14 +544,10 @@ func getCustomTlsClientProfile(customClientDefinition *CustomTlsClient) (tls.Cli
 	return clientHelloId, resolvedH2Settings, resolvedH2SettingsOrder, pseudoHeaderOrder, connectionFlow, priorityFrames, headerPriority, customClientDefinition.StreamId, customClientDefinition.AllowHttp, resolvedH3Settings, resolvedH3SettingsOrder, h3PriorityParam, h3PseudoHeaderOrder, http3SendGreaseFrames, nil
 }
 
-func getTlsClientProfile(tlsClientIdentifier string) profiles.ClientProfile {
-	tlsClientProfile, ok := profiles.MappedTLSClients[tlsClientIdentifier]
-
-	if !ok {
-		return profiles.DefaultClientProfile
-	}
-
-	return tlsClientProfile
+// getTlsClientProfile resolves the identifier with the default registry.
+// Unknown identifiers return an error wrapping profiles.ErrProfileNotFound instead of falling back to the default profile.
+func getTlsClientProfile(tlsClientIdentifier string) (profiles.ClientProfile, error) {
+	return profiles.DefaultRegistry.Resolve(tlsClientIdentifier)
 }
 
 func handleModification(client tls_client.HttpClient, proxyUrl *string, followRedirects bool, isRotatingProxy bool) (tls_client.HttpClient, bool, error) {
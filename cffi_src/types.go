@@ -98,6 +98,7 @@ type CustomTlsClient struct {
 	HeaderPriority                          *PriorityParam        `json:"headerPriority"`
 	CertCompressionAlgos                    []string              `json:"certCompressionAlgos"`
 	Ja3String                               string                `json:"ja3String"`
+	Ja4String                               string                `json:"ja4String"`
 	KeyShareCurves                          []string              `json:"keyShareCurves"`
 	ALPNProtocols                           []string              `json:"alpnProtocols"`
 	ALPSProtocols                           []string              `json:"alpsProtocols"`
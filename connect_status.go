@@ -0,0 +1,216 @@
+package tls_client
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/bogdanfinn/fhttp/http2"
+)
+
+const http2FrameHeaderLen = 9
+
+var errProxyRejectedTunnel = errors.New("proxy rejected the tunnel")
+
+// http2ProxyConn is the connection to an h2 proxy. The http2 transport only returns a response other than 2xx to a
+// CONNECT request once the request body, which is the upstream of the tunnel, stops blocking. A proxy rejects a tunnel
+// by ending the stream of the CONNECT request with its response, so the connection watches the frame headers for the
+// end of the streams which still wait for their response. Neither header blocks nor payloads are decoded.
+type http2ProxyConn struct {
+	net.Conn
+
+	// connectMu is held by a CONNECT request until its HEADERS frame is written,
+	// so the HEADERS frame which was written last belongs to the request holding it
+	connectMu sync.Mutex
+
+	mu sync.Mutex
+	// written and read split the outgoing and incoming bytes into frames
+	written http2FrameReader
+	read    http2FrameReader
+	// reads counts the calls to Read. The transport reads again once it processed the frames of the previous read.
+	reads               uint64
+	lastHeadersStreamID uint32
+	lastWatchedStreamID uint32
+	// ended holds the read during which the proxy ended streams that are not watched yet
+	ended   map[uint32]uint64
+	watched map[uint32]func()
+	// rejected is called on the next read, when the transport has the response of the rejected streams
+	rejected []func()
+	err      error
+}
+
+func newHttp2ProxyConn(conn net.Conn) *http2ProxyConn {
+	return &http2ProxyConn{
+		Conn:    conn,
+		written: http2FrameReader{preface: len(http2.ClientPreface)},
+		ended:   make(map[uint32]uint64),
+		watched: make(map[uint32]func()),
+	}
+}
+
+func (c *http2ProxyConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+
+	c.mu.Lock()
+	c.written.feed(p[:n], func(header http2.FrameHeader) {
+		if header.Type == http2.FrameHeaders {
+			c.lastHeadersStreamID = header.StreamID
+		}
+	})
+	c.mu.Unlock()
+
+	return n, err
+}
+
+func (c *http2ProxyConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	c.reads++
+	rejected := c.rejected
+	c.rejected = nil
+	c.mu.Unlock()
+
+	for _, reject := range rejected {
+		reject()
+	}
+
+	n, err := c.Conn.Read(p)
+
+	c.mu.Lock()
+	c.read.feed(p[:n], func(header http2.FrameHeader) {
+		if !endsHttp2Stream(header) {
+			return
+		}
+
+		if reject, ok := c.watched[header.StreamID]; ok {
+			delete(c.watched, header.StreamID)
+			c.rejected = append(c.rejected, reject)
+
+			return
+		}
+
+		if header.StreamID > c.lastWatchedStreamID {
+			c.ended[header.StreamID] = c.reads
+		}
+	})
+
+	// streams which wait for their response are rejected if the response cannot be read anymore
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+
+	var failed []func()
+	if c.err != nil {
+		for streamID, reject := range c.watched {
+			failed = append(failed, reject)
+			delete(c.watched, streamID)
+		}
+
+		failed = append(failed, c.rejected...)
+		c.rejected = nil
+	}
+	c.mu.Unlock()
+
+	for _, reject := range failed {
+		reject()
+	}
+
+	return n, err
+}
+
+// watchLastStream calls reject once the proxy ends the stream of the HEADERS frame which was written last,
+// or the response cannot be read anymore. The caller has to hold connectMu. The returned function stops watching the stream.
+func (c *http2ProxyConn) watchLastStream(reject func()) func() {
+	c.mu.Lock()
+
+	streamID := c.lastHeadersStreamID
+	c.lastWatchedStreamID = streamID
+
+	endedRead, ended := c.ended[streamID]
+	clear(c.ended)
+
+	rejectNow := c.err != nil || (ended && c.reads > endedRead)
+
+	switch {
+	case rejectNow:
+	case ended:
+		c.rejected = append(c.rejected, reject)
+	default:
+		c.watched[streamID] = reject
+	}
+	c.mu.Unlock()
+
+	if rejectNow {
+		reject()
+	}
+
+	return func() {
+		c.mu.Lock()
+		delete(c.watched, streamID)
+		c.mu.Unlock()
+	}
+}
+
+func endsHttp2Stream(header http2.FrameHeader) bool {
+	switch header.Type {
+	case http2.FrameData:
+		return header.Flags.Has(http2.FlagDataEndStream)
+	case http2.FrameHeaders:
+		return header.Flags.Has(http2.FlagHeadersEndStream)
+	case http2.FrameRSTStream:
+		return true
+	default:
+		return false
+	}
+}
+
+// http2FrameReader splits a stream of bytes into http2 frames and skips their payloads.
+type http2FrameReader struct {
+	// preface is the number of bytes to skip before the first frame
+	preface int
+
+	header    [http2FrameHeaderLen]byte
+	headerLen int
+	remaining int
+}
+
+// feed reads the frames of p and calls onFrame with the header of every frame once its payload was read as well.
+func (r *http2FrameReader) feed(p []byte, onFrame func(header http2.FrameHeader)) {
+	for len(p) > 0 {
+		if r.preface > 0 {
+			n := min(r.preface, len(p))
+			r.preface -= n
+			p = p[n:]
+
+			continue
+		}
+
+		if r.headerLen < http2FrameHeaderLen {
+			n := copy(r.header[r.headerLen:], p)
+			r.headerLen += n
+			p = p[n:]
+
+			if r.headerLen < http2FrameHeaderLen {
+				return
+			}
+
+			r.remaining = int(r.header[0])<<16 | int(r.header[1])<<8 | int(r.header[2])
+		}
+
+		n := min(r.remaining, len(p))
+		r.remaining -= n
+		p = p[n:]
+
+		if r.remaining > 0 {
+			return
+		}
+
+		onFrame(http2.FrameHeader{
+			Type:     http2.FrameType(r.header[3]),
+			Flags:    http2.Flags(r.header[4]),
+			Length:   uint32(r.header[0])<<16 | uint32(r.header[1])<<8 | uint32(r.header[2]),
+			StreamID: (uint32(r.header[5])<<24 | uint32(r.header[6])<<16 | uint32(r.header[7])<<8 | uint32(r.header[8])) & (1<<31 - 1),
+		})
+
+		r.headerLen = 0
+	}
+}
@@ -0,0 +1,116 @@
+package tls_client
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	tls "github.com/bogdanfinn/utls"
+)
+
+// ECHStatus tells how the ClientHello of a connection was sent with Encrypted Client Hello (ECH).
+type ECHStatus string
+
+const (
+	// ECHStatusNone means the client profile does not send the ECH extension.
+	ECHStatusNone ECHStatus = ""
+	// ECHStatusGREASE means no ECH config was known for the host and the client profile sent a GREASE ECH extension.
+	ECHStatusGREASE ECHStatus = "grease"
+	// ECHStatusAccepted means the server decrypted the inner ClientHello, possibly after a retry with its retry configs.
+	ECHStatusAccepted ECHStatus = "accepted"
+	// ECHStatusRejected means the server rejected ECH without retry configs and the connection was established without it.
+	ECHStatusRejected ECHStatus = "rejected"
+)
+
+// echConfigLists are the ECH config lists configured for the client, independent of DNS.
+type echConfigLists struct {
+	// defaultConfigList is used for hosts without a config list of their own and without one in their HTTPS record
+	defaultConfigList []byte
+	// hosts maps a host to its config list, which takes precedence over the HTTPS record of the host
+	hosts map[string][]byte
+}
+
+// echConn records the ECH status of the TLS connection on top of it.
+type echConn struct {
+	net.Conn
+	status ECHStatus
+}
+
+// echStatusOf returns the ECH status of the TLS connection conn, ECHStatusNone for other connections.
+func echStatusOf(conn net.Conn) ECHStatus {
+	if ech, ok := findConn[*echConn](conn); ok {
+		return ech.status
+	}
+
+	return ECHStatusNone
+}
+
+// echConfigList returns the ECH config list for host, nil if the client profile cannot send ECH or none is known.
+func (rt *roundTripper) echConfigList(host string, record *HTTPSRecord) []byte {
+	if !rt.echSupported {
+		return nil
+	}
+
+	if rt.echConfigLists != nil {
+		if configList, ok := rt.echConfigLists.hosts[host]; ok {
+			return configList
+		}
+	}
+
+	if record != nil && len(record.ECHConfigList) > 0 {
+		return record.ECHConfigList
+	}
+
+	if rt.echConfigLists != nil {
+		return rt.echConfigLists.defaultConfigList
+	}
+
+	return nil
+}
+
+// handshakeECH performs the TLS handshake on rawConn. If the server rejects the ECH config of tlsConfig, the connection is
+// redialed once with the retry configs of the server, or without ECH if the server sent none, as described in RFC 9849.
+func (rt *roundTripper) handshakeECH(ctx context.Context, rawConn net.Conn, tlsConfig *tls.Config, redial func() (net.Conn, error)) (*tls.UConn, error) {
+	rejected := false
+
+	for {
+		status := ECHStatusNone
+		switch {
+		case tlsConfig.EncryptedClientHelloConfigList != nil:
+			status = ECHStatusAccepted
+		case rejected:
+			status = ECHStatusRejected
+		case rt.echSupported:
+			status = ECHStatusGREASE
+		}
+
+		trackedConn := rt.bandwidthTracker.TrackConnection(ctx, &echConn{Conn: rawConn, status: status})
+
+		conn := tls.UClient(trackedConn, tlsConfig, rt.clientHelloId, rt.withRandomTlsExtensionOrder, rt.forceHttp1, rt.disableHttp3)
+
+		err := conn.HandshakeContext(ctx)
+		if err == nil {
+			return conn, nil
+		}
+
+		_ = conn.Close()
+
+		var rejectionErr *tls.ECHRejectionError
+		if !errors.As(err, &rejectionErr) || rejected {
+			return nil, err
+		}
+
+		rejected = true
+
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.EncryptedClientHelloConfigList = nil
+
+		if len(rejectionErr.RetryConfigList) > 0 {
+			tlsConfig.EncryptedClientHelloConfigList = rejectionErr.RetryConfigList
+		}
+
+		if rawConn, err = redial(); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package echoserver
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+)
+
+const (
+	recordHeaderLen      = 5
+	recordTypeHandshake  = 0x16
+	handshakeHeaderLen   = 4
+	maxClientHelloLength = 1 << 16
+)
+
+// clientHelloRecorder wraps a connection and records the incoming bytes until a complete ClientHello was read.
+type clientHelloRecorder struct {
+	net.Conn
+
+	mu        sync.Mutex
+	records   []byte
+	handshake []byte
+	done      bool
+}
+
+func newClientHelloRecorder(conn net.Conn) *clientHelloRecorder {
+	return &clientHelloRecorder{Conn: conn}
+}
+
+func (r *clientHelloRecorder) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+
+	if n > 0 {
+		r.record(p[:n])
+	}
+
+	return n, err
+}
+
+func (r *clientHelloRecorder) record(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.done {
+		return
+	}
+
+	r.records = append(r.records, data...)
+
+	// extract the handshake payload of all complete records
+	for len(r.records) >= recordHeaderLen {
+		recordLen := int(binary.BigEndian.Uint16(r.records[3:5]))
+		if len(r.records) < recordHeaderLen+recordLen {
+			return
+		}
+
+		if r.records[0] != recordTypeHandshake {
+			r.done = true
+			return
+		}
+
+		r.handshake = append(r.handshake, r.records[recordHeaderLen:recordHeaderLen+recordLen]...)
+		r.records = r.records[recordHeaderLen+recordLen:]
+
+		if len(r.handshake) >= handshakeHeaderLen {
+			messageLen := int(r.handshake[1])<<16 | int(r.handshake[2])<<8 | int(r.handshake[3])
+			if len(r.handshake) >= handshakeHeaderLen+messageLen || messageLen > maxClientHelloLength {
+				r.handshake = r.handshake[:min(len(r.handshake), handshakeHeaderLen+messageLen)]
+				r.records = nil
+				r.done = true
+				return
+			}
+		}
+	}
+}
+
+// clientHello returns the raw ClientHello handshake message.
+func (r *clientHelloRecorder) clientHello() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.handshake
+}
@@ -0,0 +1,87 @@
+package echoserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// serveHTTP1 serves HTTP/1.1 requests on the connection. The request is parsed manually to keep the header order and casing.
+func serveHTTP1(conn net.Conn, tlsDetails TLSDetails) {
+	reader := bufio.NewReader(conn)
+
+	for {
+		requestLine, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		requestLineParts := strings.Fields(requestLine)
+		if len(requestLineParts) != 3 {
+			return
+		}
+
+		var headers []string
+		contentLength := 0
+		closeConnection := requestLineParts[2] == "HTTP/1.0"
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				break
+			}
+
+			headers = append(headers, line)
+
+			name, value, _ := strings.Cut(line, ":")
+			value = strings.TrimSpace(value)
+
+			switch strings.ToLower(name) {
+			case "content-length":
+				contentLength, _ = strconv.Atoi(value)
+			case "connection":
+				closeConnection = strings.EqualFold(value, "close")
+			}
+		}
+
+		if contentLength > 0 {
+			if _, err := io.CopyN(io.Discard, reader, int64(contentLength)); err != nil {
+				return
+			}
+		}
+
+		body, err := json.Marshal(Response{
+			IP:          conn.RemoteAddr().String(),
+			HTTPVersion: requestLineParts[2],
+			Method:      requestLineParts[0],
+			Path:        requestLineParts[1],
+			TLS:         tlsDetails,
+			HTTP1:       &HTTP1Details{Headers: headers},
+		})
+		if err != nil {
+			return
+		}
+
+		connectionHeader := "keep-alive"
+		if closeConnection {
+			connectionHeader = "close"
+		}
+
+		if _, err := fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: %s\r\n\r\n", len(body), connectionHeader); err != nil {
+			return
+		}
+
+		if _, err := conn.Write(body); err != nil || closeConnection {
+			return
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package echoserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/bogdanfinn/fhttp/http2"
+	"github.com/bogdanfinn/fhttp/http2/hpack"
+	"github.com/bogdanfinn/tls-client/profiles"
+)
+
+const (
+	http2ClientPreface   = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	http2MaxFrameSize    = 16384
+	http2MaxHeaderListSz = 1 << 20
+)
+
+// http2Connection records all frames of a single HTTP/2 connection and answers each request with the recorded state.
+type http2Connection struct {
+	conn       net.Conn
+	framer     *http2.Framer
+	tlsDetails TLSDetails
+
+	frames            []Frame
+	settings          map[http2.SettingID]uint32
+	settingsOrder     []http2.SettingID
+	connectionFlow    uint32
+	priorities        []http2.Priority
+	pseudoHeaderOrder []string
+
+	requests map[uint32]*http2Request
+}
+
+type http2Request struct {
+	method string
+	path   string
+}
+
+func serveHTTP2(conn net.Conn, tlsDetails TLSDetails) {
+	preface := make([]byte, len(http2ClientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil || string(preface) != http2ClientPreface {
+		return
+	}
+
+	framer := http2.NewFramer(conn, conn)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	framer.MaxHeaderListSize = http2MaxHeaderListSz
+
+	c := &http2Connection{
+		conn:       conn,
+		framer:     framer,
+		tlsDetails: tlsDetails,
+		settings:   make(map[http2.SettingID]uint32),
+		requests:   make(map[uint32]*http2Request),
+	}
+
+	if err := framer.WriteSettings(); err != nil {
+		return
+	}
+
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			return
+		}
+
+		if err := c.handleFrame(frame); err != nil {
+			return
+		}
+	}
+}
+
+func (c *http2Connection) handleFrame(frame http2.Frame) error {
+	header := frame.Header()
+	recorded := Frame{
+		FrameType: header.Type.String(),
+		Length:    header.Length,
+		StreamID:  header.StreamID,
+		Flags:     frameFlags(header),
+	}
+
+	switch f := frame.(type) {
+	case *http2.SettingsFrame:
+		if f.IsAck() {
+			c.frames = append(c.frames, recorded)
+			return nil
+		}
+
+		_ = f.ForeachSetting(func(setting http2.Setting) error {
+			recorded.Settings = append(recorded.Settings, fmt.Sprintf("%s = %d", setting.ID, setting.Val))
+
+			if _, exists := c.settings[setting.ID]; !exists {
+				c.settingsOrder = append(c.settingsOrder, setting.ID)
+			}
+			c.settings[setting.ID] = setting.Val
+
+			return nil
+		})
+
+		c.frames = append(c.frames, recorded)
+
+		return c.framer.WriteSettingsAck()
+	case *http2.WindowUpdateFrame:
+		recorded.Increment = f.Increment
+		if f.StreamID == 0 && c.connectionFlow == 0 {
+			c.connectionFlow = f.Increment
+		}
+
+		c.frames = append(c.frames, recorded)
+	case *http2.PriorityFrame:
+		recorded.Priority = newPriority(f.PriorityParam)
+		c.priorities = append(c.priorities, http2.Priority{StreamID: f.StreamID, PriorityParam: f.PriorityParam})
+		c.frames = append(c.frames, recorded)
+	case *http2.PingFrame:
+		c.frames = append(c.frames, recorded)
+
+		if !f.IsAck() {
+			return c.framer.WritePing(true, f.Data)
+		}
+	case *http2.MetaHeadersFrame:
+		request := &http2Request{}
+		var pseudoHeaderOrder []string
+
+		for _, field := range f.Fields {
+			recorded.Headers = append(recorded.Headers, fmt.Sprintf("%s: %s", field.Name, field.Value))
+
+			switch field.Name {
+			case ":method":
+				request.method = field.Value
+			case ":path":
+				request.path = field.Value
+			}
+
+			if field.IsPseudo() {
+				pseudoHeaderOrder = append(pseudoHeaderOrder, field.Name)
+			}
+		}
+
+		// the akamai fingerprint is based on the first request of the connection
+		if c.pseudoHeaderOrder == nil {
+			c.pseudoHeaderOrder = pseudoHeaderOrder
+		}
+
+		if f.HasPriority() {
+			recorded.Priority = newPriority(f.Priority)
+		}
+
+		c.frames = append(c.frames, recorded)
+		c.requests[f.StreamID] = request
+
+		if f.StreamEnded() {
+			return c.respond(f.StreamID)
+		}
+	case *http2.DataFrame:
+		c.frames = append(c.frames, recorded)
+
+		if f.StreamEnded() {
+			return c.respond(f.StreamID)
+		}
+	case *http2.GoAwayFrame:
+		c.frames = append(c.frames, recorded)
+
+		return io.EOF
+	default:
+		c.frames = append(c.frames, recorded)
+	}
+
+	return nil
+}
+
+func (c *http2Connection) respond(streamID uint32) error {
+	request, ok := c.requests[streamID]
+	if !ok {
+		return nil
+	}
+	delete(c.requests, streamID)
+
+	akamaiFingerprint := profiles.GetAkamaiFingerprint(c.settings, c.settingsOrder, c.connectionFlow, c.priorities, c.pseudoHeaderOrder)
+
+	body, err := json.Marshal(Response{
+		IP:          c.conn.RemoteAddr().String(),
+		HTTPVersion: "h2",
+		Method:      request.method,
+		Path:        request.path,
+		TLS:         c.tlsDetails,
+		HTTP2: &HTTP2Details{
+			AkamaiFingerprint:     akamaiFingerprint,
+			AkamaiFingerprintHash: md5Hex(akamaiFingerprint),
+			SentFrames:            append([]Frame{}, c.frames...),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var headerBlock bytes.Buffer
+	encoder := hpack.NewEncoder(&headerBlock)
+	_ = encoder.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+	_ = encoder.WriteField(hpack.HeaderField{Name: "content-type", Value: "application/json"})
+	_ = encoder.WriteField(hpack.HeaderField{Name: "content-length", Value: strconv.Itoa(len(body))})
+
+	err = c.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: headerBlock.Bytes(),
+		EndHeaders:    true,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the response is small enough to fit into the initial flow control window of all known clients
+	for len(body) > http2MaxFrameSize {
+		if err := c.framer.WriteData(streamID, false, body[:http2MaxFrameSize]); err != nil {
+			return err
+		}
+		body = body[http2MaxFrameSize:]
+	}
+
+	return c.framer.WriteData(streamID, true, body)
+}
+
+func newPriority(param http2.PriorityParam) *Priority {
+	exclusive := 0
+	if param.Exclusive {
+		exclusive = 1
+	}
+
+	return &Priority{
+		Weight:    int(param.Weight) + 1,
+		DependsOn: param.StreamDep,
+		Exclusive: exclusive,
+	}
+}
+
+func frameFlags(header http2.FrameHeader) []string {
+	var flags []string
+
+	switch header.Type {
+	case http2.FrameSettings, http2.FramePing:
+		if header.Flags.Has(http2.FlagSettingsAck) {
+			flags = append(flags, "ACK")
+		}
+	case http2.FrameHeaders:
+		if header.Flags.Has(http2.FlagHeadersEndStream) {
+			flags = append(flags, "EndStream")
+		}
+		if header.Flags.Has(http2.FlagHeadersEndHeaders) {
+			flags = append(flags, "EndHeaders")
+		}
+		if header.Flags.Has(http2.FlagHeadersPriority) {
+			flags = append(flags, "Priority")
+		}
+	case http2.FrameData:
+		if header.Flags.Has(http2.FlagDataEndStream) {
+			flags = append(flags, "EndStream")
+		}
+	}
+
+	return flags
+}
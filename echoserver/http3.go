@@ -0,0 +1,312 @@
+package echoserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/bogdanfinn/quic-go-utls"
+	"github.com/bogdanfinn/quic-go-utls/http3"
+	"github.com/bogdanfinn/quic-go-utls/http3/qlog"
+	"github.com/bogdanfinn/quic-go-utls/qlogwriter"
+	"github.com/bogdanfinn/tls-client/profiles"
+	tls "github.com/bogdanfinn/utls"
+)
+
+const (
+	http3SettingMaxFieldSectionSize = 0x6
+	http3SettingExtendedConnect     = 0x8
+	http3SettingDatagram            = 0x33
+)
+
+var http3SettingNames = map[uint64]string{
+	0x1:                             "QPACK_MAX_TABLE_CAPACITY",
+	http3SettingMaxFieldSectionSize: "MAX_FIELD_SECTION_SIZE",
+	0x7:                             "QPACK_BLOCKED_STREAMS",
+	http3SettingExtendedConnect:     "ENABLE_CONNECT_PROTOCOL",
+	http3SettingDatagram:            "H3_DATAGRAM",
+}
+
+// quicClientHello is the ClientHello of a QUIC connection as reported by the TLS stack.
+// The QUIC stack does not expose the raw bytes, so the fingerprint is built from the parsed fields.
+type quicClientHello struct {
+	fingerprint profiles.ClientHelloFingerprint
+}
+
+// http3Trace is a qlog trace which records the frames the client sent on a single QUIC connection.
+type http3Trace struct {
+	mu       sync.Mutex
+	settings map[uint64]uint64
+	headers  [][]qlog.HeaderField
+}
+
+func (t *http3Trace) AddProducer() qlogwriter.Recorder {
+	return t
+}
+
+func (t *http3Trace) SupportsSchemas(schema string) bool {
+	return schema == qlog.EventSchema
+}
+
+func (t *http3Trace) RecordEvent(event qlogwriter.Event) {
+	var frame any
+
+	switch e := event.(type) {
+	case qlog.FrameParsed:
+		frame = e.Frame.Frame
+	case *qlog.FrameParsed:
+		frame = e.Frame.Frame
+	default:
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch f := frame.(type) {
+	case qlog.HeadersFrame:
+		t.headers = append(t.headers, f.HeaderFields)
+	case *qlog.HeadersFrame:
+		t.headers = append(t.headers, f.HeaderFields)
+	case qlog.SettingsFrame:
+		t.recordSettings(f)
+	case *qlog.SettingsFrame:
+		t.recordSettings(*f)
+	}
+}
+
+func (t *http3Trace) Close() error {
+	return nil
+}
+
+func (t *http3Trace) recordSettings(frame qlog.SettingsFrame) {
+	t.settings = make(map[uint64]uint64, len(frame.Other)+3)
+
+	for id, value := range frame.Other {
+		t.settings[id] = value
+	}
+
+	if frame.MaxFieldSectionSize >= 0 {
+		t.settings[http3SettingMaxFieldSectionSize] = uint64(frame.MaxFieldSectionSize)
+	}
+
+	if frame.ExtendedConnect != nil {
+		t.settings[http3SettingExtendedConnect] = boolToSetting(*frame.ExtendedConnect)
+	}
+
+	if frame.Datagram != nil {
+		t.settings[http3SettingDatagram] = boolToSetting(*frame.Datagram)
+	}
+}
+
+// takeHeaders returns the first recorded header block matching the method and path and removes it from the trace.
+func (t *http3Trace) takeHeaders(method string, path string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, fields := range t.headers {
+		var matchesMethod, matchesPath bool
+		for _, field := range fields {
+			matchesMethod = matchesMethod || (field.Name == ":method" && field.Value == method)
+			matchesPath = matchesPath || (field.Name == ":path" && field.Value == path)
+		}
+
+		if !matchesMethod || !matchesPath {
+			continue
+		}
+
+		t.headers = append(t.headers[:i], t.headers[i+1:]...)
+
+		headers := make([]string, 0, len(fields))
+		for _, field := range fields {
+			headers = append(headers, fmt.Sprintf("%s: %s", field.Name, field.Value))
+		}
+
+		return headers
+	}
+
+	return nil
+}
+
+func (t *http3Trace) sortedSettings() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]uint64, 0, len(t.settings))
+	for id := range t.settings {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	settings := make([]string, 0, len(ids))
+	for _, id := range ids {
+		name, ok := http3SettingNames[id]
+		if !ok {
+			name = fmt.Sprintf("0x%x", id)
+		}
+
+		settings = append(settings, fmt.Sprintf("%s = %d", name, t.settings[id]))
+	}
+
+	return settings
+}
+
+func boolToSetting(value bool) uint64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+func (s *Server) newHTTP3Server(certificate tls.Certificate) *http3.Server {
+	tlsConfig := http3.ConfigureTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			s.storeQUICClientHello(info)
+			return nil, nil
+		},
+	})
+
+	return &http3.Server{
+		TLSConfig: tlsConfig,
+		QUICConfig: &quic.Config{
+			Tracer: s.newHTTP3Trace,
+		},
+		ConnContext: func(ctx context.Context, conn *quic.Conn) context.Context {
+			s.forgetQUICClientHelloOnClose(conn)
+			return ctx
+		},
+		Handler: http.HandlerFunc(s.serveHTTP3),
+	}
+}
+
+func (s *Server) newHTTP3Trace(ctx context.Context, isClient bool, _ quic.ConnectionID) qlogwriter.Trace {
+	tracingID, ok := ctx.Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
+	if isClient || !ok {
+		return nil
+	}
+
+	trace := &http3Trace{}
+
+	s.http3TracesMu.Lock()
+	s.http3Traces[tracingID] = trace
+	s.http3TracesMu.Unlock()
+
+	// the context of the tracer is the context of the connection, which is done once the connection is closed
+	go func() {
+		<-ctx.Done()
+
+		s.http3TracesMu.Lock()
+		delete(s.http3Traces, tracingID)
+		s.http3TracesMu.Unlock()
+	}()
+
+	return trace
+}
+
+// forgetQUICClientHelloOnClose removes the ClientHello of the connection once it is closed, so that a later connection
+// from the same address does not get it.
+func (s *Server) forgetQUICClientHelloOnClose(conn *quic.Conn) {
+	remoteAddr := conn.RemoteAddr().String()
+
+	s.quicClientHellosMu.Lock()
+	clientHello := s.quicClientHellos[remoteAddr]
+	s.quicClientHellosMu.Unlock()
+
+	go func() {
+		<-conn.Context().Done()
+
+		s.quicClientHellosMu.Lock()
+		// a new connection from the same address might have replaced the ClientHello already
+		if s.quicClientHellos[remoteAddr] == clientHello {
+			delete(s.quicClientHellos, remoteAddr)
+		}
+		s.quicClientHellosMu.Unlock()
+	}()
+}
+
+func (s *Server) storeQUICClientHello(info *tls.ClientHelloInfo) {
+	if info.Conn == nil {
+		return
+	}
+
+	fingerprint := profiles.ClientHelloFingerprint{
+		ServerName:        info.ServerName,
+		ALPNProtocols:     info.SupportedProtos,
+		CipherSuites:      info.CipherSuites,
+		Extensions:        info.Extensions,
+		PointFormats:      info.SupportedPoints,
+		SupportedVersions: info.SupportedVersions,
+		// QUIC always uses TLS 1.3 which sends the legacy version TLS 1.2 in the ClientHello
+		Version: tls.VersionTLS12,
+		QUIC:    true,
+	}
+
+	for _, curve := range info.SupportedCurves {
+		fingerprint.SupportedGroups = append(fingerprint.SupportedGroups, uint16(curve))
+	}
+
+	for _, scheme := range info.SignatureSchemes {
+		fingerprint.SignatureAlgorithms = append(fingerprint.SignatureAlgorithms, uint16(scheme))
+	}
+
+	s.quicClientHellosMu.Lock()
+	s.quicClientHellos[info.Conn.RemoteAddr().String()] = &quicClientHello{fingerprint: fingerprint}
+	s.quicClientHellosMu.Unlock()
+}
+
+func (s *Server) serveHTTP3(w http.ResponseWriter, req *http.Request) {
+	var trace *http3Trace
+	if tracingID, ok := req.Context().Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID); ok {
+		s.http3TracesMu.Lock()
+		trace = s.http3Traces[tracingID]
+		s.http3TracesMu.Unlock()
+	}
+
+	if trace == nil {
+		http.Error(w, "no trace recorded for connection", http.StatusInternalServerError)
+		return
+	}
+
+	// the settings are sent on the control stream and might arrive after the request
+	if streamer, ok := w.(interface{ Connection() *http3.Conn }); ok {
+		select {
+		case <-streamer.Connection().ReceivedSettings():
+		case <-time.After(time.Second):
+		}
+	}
+
+	tlsDetails := TLSDetails{TLSVersionNegotiated: "TLS 1.3"}
+
+	s.quicClientHellosMu.Lock()
+	clientHello, ok := s.quicClientHellos[req.RemoteAddr]
+	s.quicClientHellosMu.Unlock()
+
+	if ok {
+		tlsDetails = fillTLSDetails(tlsDetails, &clientHello.fingerprint)
+	}
+
+	body, err := json.Marshal(Response{
+		IP:          req.RemoteAddr,
+		HTTPVersion: "h3",
+		Method:      req.Method,
+		Path:        req.URL.RequestURI(),
+		TLS:         tlsDetails,
+		HTTP3: &HTTP3Details{
+			Settings: trace.sortedSettings(),
+			Headers:  trace.takeHeaders(req.Method, req.URL.RequestURI()),
+		},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
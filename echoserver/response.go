@@ -0,0 +1,169 @@
+package echoserver
+
+import (
+	"crypto/md5"
+	stdtls "crypto/tls"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bogdanfinn/tls-client/profiles"
+)
+
+// Response is the JSON document the echo server sends back for every request.
+// The layout follows the one of https://tls.peet.ws/api/all
+type Response struct {
+	IP          string        `json:"ip"`
+	HTTPVersion string        `json:"http_version"`
+	Method      string        `json:"method"`
+	Path        string        `json:"path"`
+	TLS         TLSDetails    `json:"tls"`
+	HTTP1       *HTTP1Details `json:"http1,omitempty"`
+	HTTP2       *HTTP2Details `json:"http2,omitempty"`
+	HTTP3       *HTTP3Details `json:"http3,omitempty"`
+}
+
+// TLSDetails contains the ClientHello as it was received by the server.
+type TLSDetails struct {
+	ClientHello          string      `json:"client_hello,omitempty"`
+	TLSVersionNegotiated string      `json:"tls_version_negotiated"`
+	ServerName           string      `json:"server_name"`
+	Ciphers              []string    `json:"ciphers"`
+	Extensions           []Extension `json:"extensions"`
+	SupportedGroups      []uint16    `json:"supported_groups"`
+	SignatureAlgorithms  []uint16    `json:"signature_algorithms"`
+	ALPNProtocols        []string    `json:"alpn_protocols"`
+	JA3                  string      `json:"ja3"`
+	JA3Hash              string      `json:"ja3_hash"`
+	JA3N                 string      `json:"ja3n"`
+	JA3NHash             string      `json:"ja3n_hash"`
+	JA4                  string      `json:"ja4"`
+	JA4R                 string      `json:"ja4_r"`
+}
+
+// Extension is a single extension of the ClientHello in the order it was received.
+type Extension struct {
+	Name string `json:"name"`
+	ID   uint16 `json:"id"`
+}
+
+// HTTP1Details contains the request headers in the order and casing they were received.
+type HTTP1Details struct {
+	Headers []string `json:"headers"`
+}
+
+// HTTP2Details contains all frames the client sent on the connection up to and including the current request.
+type HTTP2Details struct {
+	AkamaiFingerprint     string  `json:"akamai_fingerprint"`
+	AkamaiFingerprintHash string  `json:"akamai_fingerprint_hash"`
+	SentFrames            []Frame `json:"sent_frames"`
+}
+
+// Frame is a single HTTP/2 frame sent by the client.
+type Frame struct {
+	FrameType string    `json:"frame_type"`
+	Settings  []string  `json:"settings,omitempty"`
+	Headers   []string  `json:"headers,omitempty"`
+	Flags     []string  `json:"flags,omitempty"`
+	Priority  *Priority `json:"priority,omitempty"`
+	Length    uint32    `json:"length"`
+	Increment uint32    `json:"increment,omitempty"`
+	StreamID  uint32    `json:"stream_id,omitempty"`
+}
+
+// Priority is the priority information of a PRIORITY or HEADERS frame. The weight is the actual weight (1-256).
+type Priority struct {
+	Weight    int    `json:"weight"`
+	DependsOn uint32 `json:"depends_on"`
+	Exclusive int    `json:"exclusive"`
+}
+
+// HTTP3Details contains the HTTP/3 settings and the request headers in the order they were received.
+// The settings are reported sorted by their identifier because the QUIC stack does not preserve their order.
+type HTTP3Details struct {
+	Settings []string `json:"settings"`
+	Headers  []string `json:"headers"`
+}
+
+var extensionNames = map[uint16]string{
+	0:     "server_name",
+	5:     "status_request",
+	10:    "supported_groups",
+	11:    "ec_point_formats",
+	13:    "signature_algorithms",
+	16:    "application_layer_protocol_negotiation",
+	18:    "signed_certificate_timestamp",
+	21:    "padding",
+	23:    "extended_master_secret",
+	27:    "compress_certificate",
+	28:    "record_size_limit",
+	34:    "delegated_credentials",
+	35:    "session_ticket",
+	41:    "pre_shared_key",
+	42:    "early_data",
+	43:    "supported_versions",
+	45:    "psk_key_exchange_modes",
+	51:    "key_share",
+	57:    "quic_transport_parameters",
+	17513: "application_settings_old",
+	17613: "application_settings",
+	65037: "encrypted_client_hello",
+	65281: "renegotiation_info",
+}
+
+func newTLSDetails(rawClientHello []byte, negotiatedVersion uint16, quic bool) TLSDetails {
+	details := TLSDetails{
+		ClientHello:          hex.EncodeToString(rawClientHello),
+		TLSVersionNegotiated: stdtls.VersionName(negotiatedVersion),
+	}
+
+	clientHello, err := profiles.ParseClientHello(rawClientHello)
+	if err != nil {
+		return details
+	}
+
+	clientHello.QUIC = quic
+
+	return fillTLSDetails(details, clientHello)
+}
+
+func fillTLSDetails(details TLSDetails, clientHello *profiles.ClientHelloFingerprint) TLSDetails {
+	details.ServerName = clientHello.ServerName
+	details.SupportedGroups = clientHello.SupportedGroups
+	details.SignatureAlgorithms = clientHello.SignatureAlgorithms
+	details.ALPNProtocols = clientHello.ALPNProtocols
+
+	for _, cipherSuite := range clientHello.CipherSuites {
+		if profiles.IsGreaseValue(cipherSuite) {
+			details.Ciphers = append(details.Ciphers, fmt.Sprintf("TLS_GREASE (0x%04x)", cipherSuite))
+			continue
+		}
+
+		details.Ciphers = append(details.Ciphers, stdtls.CipherSuiteName(cipherSuite))
+	}
+
+	for _, id := range clientHello.Extensions {
+		name, ok := extensionNames[id]
+		if profiles.IsGreaseValue(id) {
+			name = "TLS_GREASE"
+		} else if !ok {
+			name = "unknown"
+		}
+
+		details.Extensions = append(details.Extensions, Extension{Name: fmt.Sprintf("%s (%d)", name, id), ID: id})
+	}
+
+	details.JA3 = clientHello.JA3()
+	details.JA3Hash = md5Hex(details.JA3)
+	details.JA3N = clientHello.JA3N()
+	details.JA3NHash = md5Hex(details.JA3N)
+	details.JA4 = clientHello.JA4()
+	details.JA4R = clientHello.JA4R()
+
+	return details
+}
+
+func md5Hex(value string) string {
+	sum := md5.Sum([]byte(value))
+
+	return hex.EncodeToString(sum[:])
+}
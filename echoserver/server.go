@@ -0,0 +1,237 @@
+// Package echoserver provides an in-process fingerprint echo server similar to https://tls.peet.ws/api/all.
+// It accepts TLS connections speaking HTTP/1.1 or HTTP/2 and QUIC connections speaking HTTP/3 on the same port
+// and responds to every request with the captured ClientHello, HTTP/2 frames and header order as JSON.
+// This allows to verify fingerprints without depending on third party services.
+package echoserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	stdtls "crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bogdanfinn/quic-go-utls"
+	"github.com/bogdanfinn/quic-go-utls/http3"
+	tls "github.com/bogdanfinn/utls"
+)
+
+// Server is a local fingerprint echo server.
+type Server struct {
+	tcpListener net.Listener
+	udpConn     net.PacketConn
+	h3Server    *http3.Server
+	tlsConfig   *stdtls.Config
+	rootCAs     *x509.CertPool
+
+	quicClientHellos   map[string]*quicClientHello
+	quicClientHellosMu sync.Mutex
+
+	http3Traces   map[quic.ConnectionTracingID]*http3Trace
+	http3TracesMu sync.Mutex
+
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewServer starts a new echo server listening on a random port of the loopback interface.
+// The server uses a self-signed certificate for "localhost" and "127.0.0.1" which can be trusted with RootCAs.
+// HTTP/3 is served via UDP on the same port number as TLS.
+func NewServer() (*Server, error) {
+	certPEM, keyPEM, err := generateCertificate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate: %w", err)
+	}
+
+	certificate, err := stdtls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(certPEM)
+
+	s := &Server{
+		rootCAs:          rootCAs,
+		quicClientHellos: make(map[string]*quicClientHello),
+		http3Traces:      make(map[quic.ConnectionTracingID]*http3Trace),
+		tlsConfig: &stdtls.Config{
+			Certificates: []stdtls.Certificate{certificate},
+			NextProtos:   []string{"h2", "http/1.1"},
+		},
+	}
+
+	if err := s.listen(); err != nil {
+		return nil, err
+	}
+
+	h3Certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+
+	s.h3Server = s.newHTTP3Server(h3Certificate)
+
+	s.wg.Add(2)
+	go s.acceptTCP()
+	go func() {
+		defer s.wg.Done()
+		_ = s.h3Server.Serve(s.udpConn)
+	}()
+
+	return s, nil
+}
+
+// listen binds the tcp listener and the udp socket on the same port.
+func (s *Server) listen() error {
+	var lastErr error
+
+	for attempt := 0; attempt < 10; attempt++ {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+
+		udpConn, err := net.ListenPacket("udp", tcpListener.Addr().String())
+		if err != nil {
+			_ = tcpListener.Close()
+			lastErr = err
+			continue
+		}
+
+		s.tcpListener = tcpListener
+		s.udpConn = udpConn
+
+		return nil
+	}
+
+	return fmt.Errorf("failed to bind tcp and udp on the same port: %w", lastErr)
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() string {
+	return s.tcpListener.Addr().String()
+}
+
+// Port returns the port the server is listening on for TCP and UDP.
+func (s *Server) Port() int {
+	return s.tcpListener.Addr().(*net.TCPAddr).Port
+}
+
+// URL returns the base url of the server. The hostname is "localhost" so that the client sends a server name indication.
+func (s *Server) URL() string {
+	return "https://" + net.JoinHostPort("localhost", strconv.Itoa(s.Port()))
+}
+
+// RootCAs returns a certificate pool containing the self-signed certificate of the server.
+func (s *Server) RootCAs() *x509.CertPool {
+	return s.rootCAs
+}
+
+// Close stops the server and closes all listeners.
+func (s *Server) Close() error {
+	var err error
+
+	s.closeOnce.Do(func() {
+		err = s.tcpListener.Close()
+
+		if s.h3Server != nil {
+			if closeErr := s.h3Server.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+
+		if closeErr := s.udpConn.Close(); closeErr != nil && err == nil && !errors.Is(closeErr, net.ErrClosed) {
+			err = closeErr
+		}
+
+		s.wg.Wait()
+	})
+
+	return err
+}
+
+func (s *Server) acceptTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcpListener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handleTCPConn(conn)
+	}
+}
+
+func (s *Server) handleTCPConn(rawConn net.Conn) {
+	defer rawConn.Close()
+
+	recorder := newClientHelloRecorder(rawConn)
+	tlsConn := stdtls.Server(recorder, s.tlsConfig)
+
+	_ = tlsConn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := tlsConn.Handshake(); err != nil {
+		return
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+
+	tlsDetails := newTLSDetails(recorder.clientHello(), tlsConn.ConnectionState().Version, false)
+
+	switch tlsConn.ConnectionState().NegotiatedProtocol {
+	case "h2":
+		serveHTTP2(tlsConn, tlsDetails)
+	default:
+		serveHTTP1(tlsConn, tlsDetails)
+	}
+}
+
+func generateCertificate() ([]byte, []byte, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"tls-client echo server"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	return certPEM, keyPEM, nil
+}
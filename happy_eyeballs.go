@@ -0,0 +1,371 @@
+package tls_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	defaultResolutionDelay        = 50 * time.Millisecond
+	defaultConnectionAttemptDelay = 250 * time.Millisecond
+	minConnectionAttemptDelay     = 10 * time.Millisecond
+)
+
+// AddressFamily is the IP version of an address.
+type AddressFamily int
+
+const (
+	AddressFamilyIPv6 AddressFamily = iota
+	AddressFamilyIPv4
+)
+
+func (f AddressFamily) String() string {
+	if f == AddressFamilyIPv4 {
+		return "ipv4"
+	}
+
+	return "ipv6"
+}
+
+// HappyEyeballsOptions configure how direct connections race the addresses of a host (RFC 8305).
+type HappyEyeballsOptions struct {
+	// ResolutionDelay is how long the addresses of the preferred family are waited for once the addresses of the other
+	// family are resolved. It defaults to 50ms.
+	ResolutionDelay time.Duration
+	// ConnectionAttemptDelay is how long a connection attempt runs before the attempt to the next address starts.
+	// It defaults to 250ms and is at least 10ms.
+	ConnectionAttemptDelay time.Duration
+	// PreferredFamily is attempted first, the families alternate afterwards. It defaults to IPv6.
+	PreferredFamily AddressFamily
+}
+
+// ConnectionInfo describes how a direct connection was established with Happy Eyeballs.
+type ConnectionInfo struct {
+	// RemoteAddr is the address which won the race.
+	RemoteAddr *net.TCPAddr
+	Family     AddressFamily
+	// Attempts is the number of connection attempts which were started, including the winning one.
+	Attempts int
+	// ResolvedAddrs are the resolved addresses of the host.
+	ResolvedAddrs []net.IP
+}
+
+// happyEyeballsConn is a connection established by the happyEyeballsDialer.
+type happyEyeballsConn struct {
+	net.Conn
+	info *ConnectionInfo
+}
+
+// connectionInfoOf returns the connection info of the Happy Eyeballs connection under conn, nil for other connections.
+func connectionInfoOf(conn net.Conn) *ConnectionInfo {
+	if heConn, ok := findConn[*happyEyeballsConn](conn); ok {
+		return heConn.info
+	}
+
+	return nil
+}
+
+type happyEyeballsResolution struct {
+	family AddressFamily
+	ips    []net.IP
+	err    error
+}
+
+type happyEyeballsAttempt struct {
+	conn net.Conn
+	ip   net.IP
+	err  error
+}
+
+// happyEyeballsDialer resolves both address families concurrently and races connection attempts to the addresses
+// with alternating families as described in RFC 8305.
+type happyEyeballsDialer struct {
+	dialer  net.Dialer
+	options HappyEyeballsOptions
+
+	lookupIP func(ctx context.Context, network string, host string) ([]net.IP, error)
+	dial     func(ctx context.Context, network string, address string) (net.Conn, error)
+}
+
+func newHappyEyeballsDialer(timeout time.Duration, localAddr *net.TCPAddr, _dialer net.Dialer, resolver Resolver, options *HappyEyeballsOptions) *happyEyeballsDialer {
+	_dialer.Timeout = timeout
+	if nil != localAddr {
+		_dialer.LocalAddr = localAddr
+	}
+
+	d := &happyEyeballsDialer{
+		dialer:   _dialer,
+		options:  *options,
+		lookupIP: net.DefaultResolver.LookupIP,
+	}
+	d.dial = d.dialer.DialContext
+
+	if resolver != nil {
+		d.lookupIP = resolver.LookupIP
+	}
+
+	if d.options.ResolutionDelay <= 0 {
+		d.options.ResolutionDelay = defaultResolutionDelay
+	}
+
+	if d.options.ConnectionAttemptDelay <= 0 {
+		d.options.ConnectionAttemptDelay = defaultConnectionAttemptDelay
+	}
+
+	if d.options.ConnectionAttemptDelay < minConnectionAttemptDelay {
+		d.options.ConnectionAttemptDelay = minConnectionAttemptDelay
+	}
+
+	return d
+}
+
+func (d *happyEyeballsDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *happyEyeballsDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	families, err := d.families(network)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		conn, err := d.dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		remoteAddr, _ := conn.RemoteAddr().(*net.TCPAddr)
+
+		return &happyEyeballsConn{Conn: conn, info: &ConnectionInfo{
+			RemoteAddr:    remoteAddr,
+			Family:        familyOf(ip),
+			Attempts:      1,
+			ResolvedAddrs: []net.IP{ip},
+		}}, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resolutions := make(chan happyEyeballsResolution, len(families))
+	for _, family := range families {
+		go func(family AddressFamily) {
+			lookupNetwork := "ip6"
+			if family == AddressFamilyIPv4 {
+				lookupNetwork = "ip4"
+			}
+
+			ips, err := d.lookupIP(ctx, lookupNetwork, host)
+			resolutions <- happyEyeballsResolution{family: family, ips: ips, err: err}
+		}(family)
+	}
+
+	return d.race(ctx, families, port, resolutions)
+}
+
+// families returns the address families for network, the preferred one first.
+func (d *happyEyeballsDialer) families(network string) ([]AddressFamily, error) {
+	switch network {
+	case "tcp":
+		if d.options.PreferredFamily == AddressFamilyIPv4 {
+			return []AddressFamily{AddressFamilyIPv4, AddressFamilyIPv6}, nil
+		}
+
+		return []AddressFamily{AddressFamilyIPv6, AddressFamilyIPv4}, nil
+	case "tcp4":
+		return []AddressFamily{AddressFamilyIPv4}, nil
+	case "tcp6":
+		return []AddressFamily{AddressFamilyIPv6}, nil
+	default:
+		return nil, fmt.Errorf("unsupported network %s", network)
+	}
+}
+
+// race starts the connection attempts as soon as the addresses of the preferred family are resolved, or the
+// resolution delay passed after the addresses of another family. Addresses resolved later join the race.
+func (d *happyEyeballsDialer) race(ctx context.Context, families []AddressFamily, port string, resolutions <-chan happyEyeballsResolution) (net.Conn, error) {
+	queues := make(map[AddressFamily][]net.IP)
+	info := &ConnectionInfo{}
+
+	var lastErr error
+	pendingResolutions := len(families)
+
+	addResolution := func(resolution happyEyeballsResolution) {
+		pendingResolutions--
+
+		if resolution.err != nil {
+			lastErr = resolution.err
+			return
+		}
+
+		if len(resolution.ips) == 0 {
+			return
+		}
+
+		queues[resolution.family] = append(queues[resolution.family], resolution.ips...)
+		info.ResolvedAddrs = append(info.ResolvedAddrs, resolution.ips...)
+	}
+
+	// wait for the preferred family, or for the resolution delay once another family has addresses
+	var resolutionDelay <-chan time.Time
+
+resolve:
+	for pendingResolutions > 0 && len(queues[families[0]]) == 0 {
+		if resolutionDelay == nil && len(queues) > 0 {
+			timer := time.NewTimer(d.options.ResolutionDelay)
+			defer timer.Stop()
+
+			resolutionDelay = timer.C
+		}
+
+		select {
+		case resolution := <-resolutions:
+			addResolution(resolution)
+		case <-resolutionDelay:
+			break resolve
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	attempts := make(chan happyEyeballsAttempt)
+	inFlight := 0
+	nextFamily := families[0]
+
+	// the attempts which lose the race are canceled and their connections closed
+	defer func() {
+		go func(inFlight int) {
+			for ; inFlight > 0; inFlight-- {
+				if attempt := <-attempts; attempt.conn != nil {
+					_ = attempt.conn.Close()
+				}
+			}
+		}(inFlight)
+	}()
+
+	startAttempt := func() bool {
+		family := nextFamily
+		if len(queues[family]) == 0 {
+			family = otherFamily(family)
+		}
+
+		if len(queues[family]) == 0 {
+			return false
+		}
+
+		ip := queues[family][0]
+		queues[family] = queues[family][1:]
+		nextFamily = otherFamily(family)
+
+		inFlight++
+		info.Attempts++
+
+		go func() {
+			network := "tcp6"
+			if family == AddressFamilyIPv4 {
+				network = "tcp4"
+			}
+
+			conn, err := d.dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			attempts <- happyEyeballsAttempt{conn: conn, ip: ip, err: err}
+		}()
+
+		return true
+	}
+
+	attemptDelay := time.NewTimer(d.options.ConnectionAttemptDelay)
+	defer attemptDelay.Stop()
+
+	restartAttemptDelay := func() {
+		attemptDelay.Stop()
+		select {
+		case <-attemptDelay.C:
+		default:
+		}
+
+		attemptDelay.Reset(d.options.ConnectionAttemptDelay)
+	}
+
+	// idle is set if the connection attempt delay passed without another address to attempt
+	idle := !startAttempt()
+	restartAttemptDelay()
+
+	for {
+		if inFlight == 0 && pendingResolutions == 0 && len(queues[AddressFamilyIPv6]) == 0 && len(queues[AddressFamilyIPv4]) == 0 {
+			if lastErr == nil {
+				lastErr = errors.New("no addresses resolved")
+			}
+
+			return nil, lastErr
+		}
+
+		var resolutionsChan <-chan happyEyeballsResolution
+		if pendingResolutions > 0 {
+			resolutionsChan = resolutions
+		}
+
+		select {
+		case resolution := <-resolutionsChan:
+			addResolution(resolution)
+
+			if (inFlight == 0 || idle) && startAttempt() {
+				idle = false
+				restartAttemptDelay()
+			}
+		case attempt := <-attempts:
+			inFlight--
+
+			if attempt.err == nil {
+				tcpAddr, _ := attempt.conn.RemoteAddr().(*net.TCPAddr)
+				if tcpAddr == nil {
+					tcpAddr = &net.TCPAddr{IP: attempt.ip}
+				}
+
+				info.RemoteAddr = tcpAddr
+				info.Family = familyOf(attempt.ip)
+
+				return &happyEyeballsConn{Conn: attempt.conn, info: info}, nil
+			}
+
+			lastErr = attempt.err
+
+			// a failed attempt does not wait for the connection attempt delay
+			if startAttempt() {
+				idle = false
+				restartAttemptDelay()
+			}
+		case <-attemptDelay.C:
+			idle = !startAttempt()
+			if !idle {
+				attemptDelay.Reset(d.options.ConnectionAttemptDelay)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func familyOf(ip net.IP) AddressFamily {
+	if ip.To4() != nil {
+		return AddressFamilyIPv4
+	}
+
+	return AddressFamilyIPv6
+}
+
+func otherFamily(family AddressFamily) AddressFamily {
+	if family == AddressFamilyIPv4 {
+		return AddressFamilyIPv6
+	}
+
+	return AddressFamilyIPv4
+}
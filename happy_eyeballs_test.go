@@ -0,0 +1,210 @@
+package tls_client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestHappyEyeballsDialer returns a dialer which resolves host to the addresses of lookup and connects every
+// successful attempt to a local listener.
+func newTestHappyEyeballsDialer(t *testing.T, options *HappyEyeballsOptions, lookup func(network string) ([]net.IP, error), dial func(network string) error) (*happyEyeballsDialer, func() []string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+
+	var mu sync.Mutex
+	var attempts []string
+
+	d := newHappyEyeballsDialer(time.Second, nil, net.Dialer{}, nil, options)
+	d.lookupIP = func(ctx context.Context, network string, host string) ([]net.IP, error) {
+		return lookup(network)
+	}
+	d.dial = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		mu.Lock()
+		attempts = append(attempts, address)
+		mu.Unlock()
+
+		if err := dial(network); err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		return net.Dial("tcp", listener.Addr().String())
+	}
+
+	return d, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), attempts...)
+	}
+}
+
+func dualStackLookup(network string) ([]net.IP, error) {
+	if network == "ip6" {
+		return []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")}, nil
+	}
+
+	return []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")}, nil
+}
+
+func TestHappyEyeballs_FallbackAfterAttemptDelay(t *testing.T) {
+	unreachable := make(chan struct{})
+	defer close(unreachable)
+
+	d, attempts := newTestHappyEyeballsDialer(t, &HappyEyeballsOptions{ConnectionAttemptDelay: 20 * time.Millisecond}, dualStackLookup, func(network string) error {
+		// ipv6 is black holed
+		if network == "tcp6" {
+			<-unreachable
+			return errors.New("unreachable")
+		}
+
+		return nil
+	})
+
+	conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	info := connectionInfoOf(conn)
+	if info == nil {
+		t.Fatal("expected connection info")
+	}
+
+	if info.Family != AddressFamilyIPv4 || info.Attempts != 2 || len(info.ResolvedAddrs) != 4 {
+		t.Fatalf("unexpected connection info %+v", info)
+	}
+
+	if got := attempts(); len(got) != 2 || got[0] != "[2001:db8::1]:443" || got[1] != "192.0.2.1:443" {
+		t.Fatalf("unexpected attempts %v", got)
+	}
+}
+
+func TestHappyEyeballs_FailedAttemptStartsNextAttempt(t *testing.T) {
+	d, attempts := newTestHappyEyeballsDialer(t, &HappyEyeballsOptions{ConnectionAttemptDelay: time.Minute}, dualStackLookup, func(network string) error {
+		if network == "tcp6" {
+			return errors.New("connection refused")
+		}
+
+		return nil
+	})
+
+	start := time.Now()
+
+	conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if time.Since(start) > 10*time.Second {
+		t.Fatal("the failed attempt waited for the connection attempt delay")
+	}
+
+	// the second IPv6 address is attempted first if the IPv4 addresses are resolved after the first attempt failed
+	if got := attempts(); len(got) < 2 || len(got) > 3 || got[len(got)-1] != "192.0.2.1:443" {
+		t.Fatalf("unexpected attempts %v", got)
+	}
+}
+
+func TestHappyEyeballs_PreferredFamily(t *testing.T) {
+	d, attempts := newTestHappyEyeballsDialer(t, &HappyEyeballsOptions{PreferredFamily: AddressFamilyIPv4}, dualStackLookup, func(network string) error {
+		return nil
+	})
+
+	conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if info := connectionInfoOf(conn); info.Family != AddressFamilyIPv4 || info.Attempts != 1 {
+		t.Fatalf("unexpected connection info %+v", info)
+	}
+
+	if got := attempts(); len(got) != 1 || got[0] != "192.0.2.1:443" {
+		t.Fatalf("unexpected attempts %v", got)
+	}
+}
+
+func TestHappyEyeballs_ResolutionDelay(t *testing.T) {
+	testCases := []struct {
+		name            string
+		aaaaDelay       time.Duration
+		resolutionDelay time.Duration
+		expectedFirst   string
+	}{
+		{"ipv6 within the resolution delay", 20 * time.Millisecond, time.Second, "[2001:db8::1]:443"},
+		{"ipv6 after the resolution delay", time.Second, 20 * time.Millisecond, "192.0.2.1:443"},
+	}
+
+	for _, testCase := range testCases {
+		lookup := func(network string) ([]net.IP, error) {
+			if network == "ip6" {
+				time.Sleep(testCase.aaaaDelay)
+			}
+
+			return dualStackLookup(network)
+		}
+
+		d, attempts := newTestHappyEyeballsDialer(t, &HappyEyeballsOptions{ResolutionDelay: testCase.resolutionDelay}, lookup, func(network string) error {
+			return nil
+		})
+
+		conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.Close()
+
+		if got := attempts(); got[0] != testCase.expectedFirst {
+			t.Fatalf("%s: unexpected attempts %v", testCase.name, got)
+		}
+	}
+}
+
+func TestHappyEyeballs_Network(t *testing.T) {
+	d, attempts := newTestHappyEyeballsDialer(t, &HappyEyeballsOptions{}, dualStackLookup, func(network string) error {
+		return nil
+	})
+
+	conn, err := d.DialContext(context.Background(), "tcp4", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if info := connectionInfoOf(conn); len(info.ResolvedAddrs) != 2 || info.Family != AddressFamilyIPv4 {
+		t.Fatalf("unexpected connection info %+v", info)
+	}
+
+	if got := attempts(); len(got) != 1 || got[0] != "192.0.2.1:443" {
+		t.Fatalf("unexpected attempts %v", got)
+	}
+}
@@ -0,0 +1,467 @@
+package tls_client
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dnsQueryTimeout = 5 * time.Second
+	// dnsUDPPayloadSize is the EDNS(0) payload size recommended to avoid fragmentation
+	dnsUDPPayloadSize = 1232
+	// httpsRecordsNegativeTTL is how long a host without HTTPS records is remembered
+	httpsRecordsNegativeTTL = time.Minute
+	// httpsRecordsMaxAliasDepth limits the AliasMode records which are followed (RFC 9460, section 2.4.2)
+	httpsRecordsMaxAliasDepth = 8
+	// httpsRecordHintTimeout limits the connection attempt to each address hint of a record
+	httpsRecordHintTimeout = 2 * time.Second
+)
+
+// HTTPSRecord is a ServiceMode HTTPS resource record of a host (RFC 9460). It tells the client how to connect to
+// the host before the first connection, e.g. that the host supports HTTP/3 or which ECH config to encrypt the
+// ClientHello with.
+type HTTPSRecord struct {
+	Priority uint16
+	// Target is the host of the service, it is empty if the service is on the host of the record itself.
+	Target string
+	// ALPN are the protocols the service supports in addition to http/1.1, unless NoDefaultALPN is set.
+	ALPN          []string
+	NoDefaultALPN bool
+	// Port is 0 if the service is on the port of the origin.
+	Port     int
+	IPv4Hint []net.IP
+	IPv6Hint []net.IP
+	// ECHConfigList is the serialized ECHConfigList of the service, nil if it does not support ECH.
+	ECHConfigList []byte
+}
+
+// HTTPSResolver resolves the HTTPS records of hosts. The records are looked up for every request and every new
+// connection, so implementations should cache them.
+type HTTPSResolver interface {
+	// LookupHTTPS returns the ServiceMode records of the host sorted by priority. AliasMode records are followed.
+	// A host without records returns no records and no error.
+	LookupHTTPS(ctx context.Context, host string) ([]HTTPSRecord, error)
+}
+
+type cachedHTTPSRecords struct {
+	records []HTTPSRecord
+	expires time.Time
+}
+
+type dnsHTTPSResolver struct {
+	// exchange sends the packed query to the DNS server and returns the packed response
+	exchange func(ctx context.Context, query []byte) ([]byte, error)
+
+	mu    sync.Mutex
+	cache map[string]cachedHTTPSRecords
+
+	now func() time.Time
+}
+
+// NewDNSHTTPSResolver returns an HTTPSResolver which queries the DNS server at the address "host:port" over UDP,
+// and over TCP for truncated responses. An empty address uses the first nameserver of /etc/resolv.conf, which returns
+// an error on systems without it like Windows. The records are cached for their TTL.
+// The queries are sent in plaintext and not through a proxy, see NewDoHResolver and NewDoTResolver for resolvers
+// which encrypt them.
+func NewDNSHTTPSResolver(server string) (HTTPSResolver, error) {
+	if server == "" {
+		systemServer, err := systemNameserver()
+		if err != nil {
+			return nil, err
+		}
+
+		server = systemServer
+	}
+
+	return newDNSHTTPSResolver(func(ctx context.Context, query []byte) ([]byte, error) {
+		return dnsExchangeUDP(ctx, server, query)
+	}), nil
+}
+
+func newDNSHTTPSResolver(exchange func(ctx context.Context, query []byte) ([]byte, error)) *dnsHTTPSResolver {
+	return &dnsHTTPSResolver{
+		exchange: exchange,
+		cache:    make(map[string]cachedHTTPSRecords),
+		now:      time.Now,
+	}
+}
+
+func (r *dnsHTTPSResolver) LookupHTTPS(ctx context.Context, host string) ([]HTTPSRecord, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	r.mu.Lock()
+	cached, ok := r.cache[host]
+	r.mu.Unlock()
+
+	if ok && r.now().Before(cached.expires) {
+		return cached.records, nil
+	}
+
+	records, ttl, err := r.lookup(ctx, host, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		ttl = httpsRecordsNegativeTTL
+	}
+
+	r.mu.Lock()
+	r.cache[host] = cachedHTTPSRecords{records: records, expires: r.now().Add(ttl)}
+	r.mu.Unlock()
+
+	return records, nil
+}
+
+// lookup returns the records of the host and the lowest TTL of the records it followed.
+func (r *dnsHTTPSResolver) lookup(ctx context.Context, host string, depth int) ([]HTTPSRecord, time.Duration, error) {
+	query, err := newDNSQuery(host, dnsmessage.TypeHTTPS)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dnsQueryTimeout)
+		defer cancel()
+	}
+
+	response, err := r.exchange(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var parser dnsmessage.Parser
+
+	header, err := parser.Start(response)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, nil
+	default:
+		return nil, 0, fmt.Errorf("dns server responded with %s for the HTTPS records of %s", header.RCode, host)
+	}
+
+	if err := parser.SkipAllQuestions(); err != nil {
+		return nil, 0, err
+	}
+
+	var records []HTTPSRecord
+	var alias *dnsmessage.SVCBResource
+
+	ttl := time.Duration(-1)
+
+	for {
+		answerHeader, err := parser.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if answerHeader.Type != dnsmessage.TypeHTTPS {
+			if err := parser.SkipAnswer(); err != nil {
+				return nil, 0, err
+			}
+
+			continue
+		}
+
+		resource, err := parser.HTTPSResource()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if recordTTL := time.Duration(answerHeader.TTL) * time.Second; ttl < 0 || recordTTL < ttl {
+			ttl = recordTTL
+		}
+
+		if resource.Priority == 0 {
+			alias = &resource.SVCBResource
+			continue
+		}
+
+		records = append(records, newHTTPSRecord(resource.SVCBResource))
+	}
+
+	// an AliasMode record takes precedence over ServiceMode records (RFC 9460, section 2.4.2)
+	if alias != nil {
+		target := strings.TrimSuffix(strings.ToLower(alias.Target.String()), ".")
+		if target == "" || target == host || depth >= httpsRecordsMaxAliasDepth {
+			return nil, ttl, nil
+		}
+
+		aliasRecords, aliasTTL, err := r.lookup(ctx, target, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for i := range aliasRecords {
+			if aliasRecords[i].Target == "" {
+				aliasRecords[i].Target = target
+			}
+		}
+
+		return aliasRecords, min(ttl, aliasTTL), nil
+	}
+
+	slices.SortStableFunc(records, func(a, b HTTPSRecord) int {
+		return int(a.Priority) - int(b.Priority)
+	})
+
+	return records, max(ttl, 0), nil
+}
+
+// dnsExchangeUDP sends the query to the server over UDP and repeats it over TCP if the response is truncated.
+func dnsExchangeUDP(ctx context.Context, server string, query []byte) ([]byte, error) {
+	response, err := dnsExchange(ctx, "udp", server, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response) > 2 && response[2]&0x02 != 0 {
+		return dnsExchange(ctx, "tcp", server, query)
+	}
+
+	return response, nil
+}
+
+// newDNSQuery returns the packed query with a random id and EDNS(0) for the records of the type of the host.
+func newDNSQuery(host string, queryType dnsmessage.Type) ([]byte, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:]), RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: queryType, Class: dnsmessage.ClassINET},
+		},
+	}
+
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(dnsUDPPayloadSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	query.Additionals = []dnsmessage.Resource{{Header: opt, Body: &dnsmessage.OPTResource{}}}
+
+	return query.Pack()
+}
+
+func dnsExchange(ctx context.Context, network string, server string, query []byte) ([]byte, error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return dnsExchangeConn(ctx, conn, network == "tcp", query)
+}
+
+// dnsExchangeConn sends the query on conn and returns the response. Messages on stream connections like TCP and TLS
+// are prefixed with their length.
+func dnsExchangeConn(ctx context.Context, conn net.Conn, stream bool, query []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if stream {
+		query = append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	if stream {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+
+		response := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, response); err != nil {
+			return nil, err
+		}
+
+		return checkDNSResponseID(query[2:], response)
+	}
+
+	response := make([]byte, 64*1024)
+
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return nil, err
+		}
+
+		// responses to other queries are ignored
+		if checked, err := checkDNSResponseID(query, response[:n]); err == nil {
+			return checked, nil
+		}
+	}
+}
+
+func checkDNSResponseID(query []byte, response []byte) ([]byte, error) {
+	if len(response) < 12 || response[0] != query[0] || response[1] != query[1] {
+		return nil, errors.New("dns response does not match the query")
+	}
+
+	return response, nil
+}
+
+// systemNameserver returns the address of the first nameserver of /etc/resolv.conf.
+func systemNameserver() (string, error) {
+	file, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "", fmt.Errorf("no dns server configured for the HTTPS records: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+
+	return "", errors.New("no dns server configured for the HTTPS records: /etc/resolv.conf has no nameserver")
+}
+
+func newHTTPSRecord(resource dnsmessage.SVCBResource) HTTPSRecord {
+	record := HTTPSRecord{
+		Priority: resource.Priority,
+		Target:   strings.TrimSuffix(resource.Target.String(), "."),
+	}
+
+	for _, param := range resource.Params {
+		switch param.Key {
+		case dnsmessage.SVCParamALPN:
+			for value := param.Value; len(value) > 0 && int(value[0]) < len(value); value = value[1+int(value[0]):] {
+				record.ALPN = append(record.ALPN, string(value[1:1+int(value[0])]))
+			}
+		case dnsmessage.SVCParamNoDefaultALPN:
+			record.NoDefaultALPN = true
+		case dnsmessage.SVCParamPort:
+			if len(param.Value) == 2 {
+				record.Port = int(binary.BigEndian.Uint16(param.Value))
+			}
+		case dnsmessage.SVCParamIPv4Hint:
+			for value := param.Value; len(value) >= net.IPv4len; value = value[net.IPv4len:] {
+				record.IPv4Hint = append(record.IPv4Hint, net.IP(slices.Clone(value[:net.IPv4len])))
+			}
+		case dnsmessage.SVCParamIPv6Hint:
+			for value := param.Value; len(value) >= net.IPv6len; value = value[net.IPv6len:] {
+				record.IPv6Hint = append(record.IPv6Hint, net.IP(slices.Clone(value[:net.IPv6len])))
+			}
+		case dnsmessage.SVCParamECH:
+			record.ECHConfigList = slices.Clone(param.Value)
+		}
+	}
+
+	return record
+}
+
+// supportsALPN reports whether the service of the record supports the protocol.
+func (r HTTPSRecord) supportsALPN(protocol string) bool {
+	if protocol == "http/1.1" && !r.NoDefaultALPN {
+		return true
+	}
+
+	return slices.Contains(r.ALPN, protocol)
+}
+
+// lookupHTTPSRecord returns the first record of the host of addr whose service is on the port of addr. It returns nil
+// without resolver, for ip addresses and if the lookup fails, as the records are optional like in browsers.
+func (rt *roundTripper) lookupHTTPSRecord(ctx context.Context, addr string) *HTTPSRecord {
+	if rt.httpsResolver == nil {
+		return nil
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return nil
+	}
+
+	port, _ := strconv.Atoi(portStr)
+
+	records, err := rt.httpsResolver.LookupHTTPS(ctx, host)
+	if err != nil {
+		return nil
+	}
+
+	for _, record := range records {
+		if record.Port == 0 || record.Port == port {
+			return &record
+		}
+	}
+
+	return nil
+}
+
+// dialHTTPSRecord dials the address hints of the record, IPv6 first, and falls back to addr if none of them connects.
+// Each hint is dialed for at most httpsRecordHintTimeout, so stale hints delay the fallback only briefly.
+// The hints are only used for direct connections, a proxy resolves the host itself.
+func (rt *roundTripper) dialHTTPSRecord(ctx context.Context, network, addr string, record *HTTPSRecord) (net.Conn, error) {
+	if record == nil || !isDirectDialer(rt.dialer) {
+		return rt.dialer.DialContext(ctx, network, addr)
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var hints []net.IP
+	if network != "tcp4" {
+		hints = append(hints, record.IPv6Hint...)
+	}
+
+	if network != "tcp6" {
+		hints = append(hints, record.IPv4Hint...)
+	}
+
+	for _, hint := range hints {
+		hintCtx, cancel := context.WithTimeout(ctx, httpsRecordHintTimeout)
+		conn, err := rt.dialer.DialContext(hintCtx, network, net.JoinHostPort(hint.String(), port))
+		cancel()
+
+		if err == nil {
+			return conn, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+
+	return rt.dialer.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,374 @@
+package tls_client
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tls "github.com/bogdanfinn/utls"
+)
+
+// ja4 contains the parsed values of a raw JA4 fingerprint (JA4_r).
+type ja4 struct {
+	version             uint16
+	serverName          bool
+	alpn                string
+	cipherSuites        []uint16
+	extensions          []uint16
+	signatureAlgorithms []tls.SignatureScheme
+}
+
+// GetSpecFactoryFromJa4String returns a ClientHelloSpec factory for the raw JA4 fingerprint (JA4_r), for example
+// "t13d1516h2_002f,0035,009c,..._0005,000a,000b,..._0403,0804,0401,...".
+//
+// The hashed JA4 form can not be parsed because the cipher suites and extensions can not be recovered from their hashes.
+//
+// JA4 does not contain the order of the extensions, the supported groups and whether GREASE is used. Therefore:
+//   - the extensions are sent in ascending order with the pre shared key extension last. Use WithRandomTLSExtensionOrder for a chrome like permutation.
+//   - the supported groups are the keyShareCurves followed by X25519, P256 and P384.
+//   - GREASE values are added to the cipher suites, extensions, supported groups and supported versions if keyShareCurves contain "GREASE".
+//
+// The signature algorithms of the JA4_r string are used unless supportedSignatureAlgorithms are given.
+// The ALPN protocols are derived from the JA4 ALPN value ("h2" results in h2 and http/1.1) unless supportedProtocolsALPN are given.
+// supportedProtocolsALPN can not be given for a JA4 ALPN value of "00", which means the ClientHello has no ALPN extension.
+func GetSpecFactoryFromJa4String(ja4String string, supportedSignatureAlgorithms, keyShareCurves, supportedProtocolsALPN, certCompressionAlgorithms []string) (func() (tls.ClientHelloSpec, error), error) {
+	parsed, err := parseJa4String(ja4String)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(supportedSignatureAlgorithms) > 0 {
+		parsed.signatureAlgorithms = nil
+
+		for _, supportedSignatureAlgorithm := range supportedSignatureAlgorithms {
+			signatureAlgorithm, ok := signatureAlgorithms[supportedSignatureAlgorithm]
+			if !ok {
+				supportedSignatureAlgorithmAsUint, err := strconv.ParseUint(supportedSignatureAlgorithm, 16, 16)
+				if err != nil {
+					return nil, fmt.Errorf("%s is not a valid supportedSignatureAlgorithm", supportedSignatureAlgorithm)
+				}
+
+				signatureAlgorithm = tls.SignatureScheme(supportedSignatureAlgorithmAsUint)
+			}
+
+			parsed.signatureAlgorithms = append(parsed.signatureAlgorithms, signatureAlgorithm)
+		}
+	}
+
+	if len(keyShareCurves) == 0 {
+		keyShareCurves = []string{"X25519"}
+	}
+
+	var keyShareGroups []tls.CurveID
+	grease := false
+
+	for _, keyShareCurve := range keyShareCurves {
+		curve, ok := curves[keyShareCurve]
+		if !ok {
+			return nil, fmt.Errorf("%s is not a valid keyShareCurve", keyShareCurve)
+		}
+
+		if keyShareCurve == "GREASE" {
+			grease = true
+		}
+
+		keyShareGroups = append(keyShareGroups, curve)
+	}
+
+	supportedGroups := append([]tls.CurveID{}, keyShareGroups...)
+	for _, curve := range []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384} {
+		if !containsCurve(supportedGroups, curve) {
+			supportedGroups = append(supportedGroups, curve)
+		}
+	}
+
+	if parsed.alpn == "00" && len(supportedProtocolsALPN) > 0 {
+		return nil, fmt.Errorf("%s has no alpn extension, supportedProtocolsALPN can not be used", ja4String)
+	}
+
+	if len(supportedProtocolsALPN) == 0 {
+		switch parsed.alpn {
+		case "00":
+		case "h2":
+			supportedProtocolsALPN = []string{"h2", "http/1.1"}
+		case "h1":
+			supportedProtocolsALPN = []string{"http/1.1"}
+		case "h3":
+			supportedProtocolsALPN = []string{"h3"}
+		default:
+			return nil, fmt.Errorf("can not derive alpn protocols from %s, please specify them", parsed.alpn)
+		}
+	}
+
+	var mappedCertCompressionAlgorithms []tls.CertCompressionAlgo
+
+	for _, certCompressionAlgorithm := range certCompressionAlgorithms {
+		compressionAlgo, ok := certCompression[certCompressionAlgorithm]
+		if !ok {
+			return nil, fmt.Errorf("%s is not a valid certCompressionAlgorithm", certCompressionAlgorithm)
+		}
+
+		mappedCertCompressionAlgorithms = append(mappedCertCompressionAlgorithms, compressionAlgo)
+	}
+
+	if len(mappedCertCompressionAlgorithms) == 0 {
+		mappedCertCompressionAlgorithms = []tls.CertCompressionAlgo{tls.CertCompressionBrotli}
+	}
+
+	return func() (tls.ClientHelloSpec, error) {
+		return parsed.toSpec(grease, keyShareGroups, supportedGroups, supportedProtocolsALPN, mappedCertCompressionAlgorithms)
+	}, nil
+}
+
+func parseJa4String(ja4String string) (ja4, error) {
+	parts := strings.Split(ja4String, "_")
+	if len(parts) < 3 || len(parts) > 4 {
+		return ja4{}, fmt.Errorf("%s is not a valid ja4_r string", ja4String)
+	}
+
+	prefix := parts[0]
+	if len(prefix) != 10 {
+		return ja4{}, fmt.Errorf("%s is not a valid ja4 prefix", prefix)
+	}
+
+	if prefix[0] != 't' {
+		return ja4{}, fmt.Errorf("only tls over tcp ja4 strings are supported, got protocol %c", prefix[0])
+	}
+
+	var parsed ja4
+
+	switch prefix[1:3] {
+	case "13":
+		parsed.version = tls.VersionTLS13
+	case "12":
+		parsed.version = tls.VersionTLS12
+	case "11":
+		parsed.version = tls.VersionTLS11
+	case "10":
+		parsed.version = tls.VersionTLS10
+	default:
+		return ja4{}, fmt.Errorf("unsupported tls version %s in ja4 string", prefix[1:3])
+	}
+
+	switch prefix[3] {
+	case 'd':
+		parsed.serverName = true
+	case 'i':
+	default:
+		return ja4{}, fmt.Errorf("invalid sni value %c in ja4 string", prefix[3])
+	}
+
+	cipherCount, err := strconv.Atoi(prefix[4:6])
+	if err != nil {
+		return ja4{}, fmt.Errorf("invalid cipher count %s in ja4 string", prefix[4:6])
+	}
+
+	extensionCount, err := strconv.Atoi(prefix[6:8])
+	if err != nil {
+		return ja4{}, fmt.Errorf("invalid extension count %s in ja4 string", prefix[6:8])
+	}
+
+	parsed.alpn = prefix[8:10]
+
+	// the hashed form contains 12 hex characters without separator instead of the comma separated values
+	if len(parts) == 3 && isJa4Hash(parts[1]) && isJa4Hash(parts[2]) {
+		return ja4{}, fmt.Errorf("%s is a hashed ja4 string, only the raw ja4_r form can be parsed", ja4String)
+	}
+
+	if parsed.cipherSuites, err = parseJa4HexList(parts[1]); err != nil {
+		return ja4{}, err
+	}
+
+	if parsed.extensions, err = parseJa4HexList(parts[2]); err != nil {
+		return ja4{}, err
+	}
+
+	if len(parts) == 4 {
+		signatureAlgorithms, err := parseJa4HexList(parts[3])
+		if err != nil {
+			return ja4{}, err
+		}
+
+		for _, signatureAlgorithm := range signatureAlgorithms {
+			parsed.signatureAlgorithms = append(parsed.signatureAlgorithms, tls.SignatureScheme(signatureAlgorithm))
+		}
+	}
+
+	// the extension count of the prefix contains the server name and alpn extensions which are not part of the extension list
+	expectedExtensions := len(parsed.extensions)
+	if parsed.serverName {
+		expectedExtensions++
+	}
+	if parsed.alpn != "00" {
+		expectedExtensions++
+	}
+
+	// counts are capped at 99
+	if cipherCount < 99 && len(parsed.cipherSuites) != cipherCount {
+		return ja4{}, fmt.Errorf("ja4 string announces %d cipher suites but contains %d", cipherCount, len(parsed.cipherSuites))
+	}
+
+	if extensionCount < 99 && expectedExtensions != extensionCount {
+		return ja4{}, fmt.Errorf("ja4 string announces %d extensions but contains %d", extensionCount, expectedExtensions)
+	}
+
+	return parsed, nil
+}
+
+func (j ja4) toSpec(grease bool, keyShareGroups []tls.CurveID, supportedGroups []tls.CurveID, alpnProtocols []string, certCompressionAlgorithms []tls.CertCompressionAlgo) (tls.ClientHelloSpec, error) {
+	// TLS 1.3 cipher suites are sent first by all browsers
+	cipherSuites := append([]uint16{}, j.cipherSuites...)
+	sort.SliceStable(cipherSuites, func(i, k int) bool {
+		return isTLS13CipherSuite(cipherSuites[i]) && !isTLS13CipherSuite(cipherSuites[k])
+	})
+
+	var suites []uint16
+	if grease {
+		suites = append(suites, tls.GREASE_PLACEHOLDER)
+	}
+	suites = append(suites, cipherSuites...)
+
+	var versions []uint16
+	if grease {
+		versions = append(versions, tls.GREASE_PLACEHOLDER)
+	}
+
+	for _, version := range []uint16{tls.VersionTLS13, tls.VersionTLS12} {
+		if version <= j.version {
+			versions = append(versions, version)
+		}
+	}
+
+	var keyShares []tls.KeyShare
+	for _, group := range keyShareGroups {
+		keyShare := tls.KeyShare{Group: group}
+		if group == tls.CurveID(tls.GREASE_PLACEHOLDER) {
+			keyShare.Data = []byte{0}
+		}
+
+		keyShares = append(keyShares, keyShare)
+	}
+
+	signatureAlgorithms := j.signatureAlgorithms
+	if len(signatureAlgorithms) == 0 {
+		signatureAlgorithms = []tls.SignatureScheme{
+			tls.ECDSAWithP256AndSHA256,
+			tls.PSSWithSHA256,
+			tls.PKCS1WithSHA256,
+			tls.ECDSAWithP384AndSHA384,
+			tls.PSSWithSHA384,
+			tls.PKCS1WithSHA384,
+			tls.PSSWithSHA512,
+			tls.PKCS1WithSHA512,
+		}
+	}
+
+	extMap := getExtensionBaseMap()
+	extMap[tls.ExtensionSupportedCurves] = &tls.SupportedCurvesExtension{Curves: supportedGroups}
+	extMap[tls.ExtensionSupportedPoints] = &tls.SupportedPointsExtension{SupportedPoints: []byte{tls.PointFormatUncompressed}}
+	extMap[tls.ExtensionSignatureAlgorithms] = &tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: signatureAlgorithms}
+	extMap[tls.ExtensionSupportedVersions] = &tls.SupportedVersionsExtension{Versions: versions}
+	extMap[tls.ExtensionKeyShare] = &tls.KeyShareExtension{KeyShares: keyShares}
+	extMap[tls.ExtensionCompressCertificate] = &tls.UtlsCompressCertExtension{Algorithms: certCompressionAlgorithms}
+	extMap[tls.ExtensionALPN] = &tls.ALPNExtension{AlpnProtocols: alpnProtocols}
+	extMap[tls.ExtensionALPSOld] = &tls.ApplicationSettingsExtension{SupportedProtocols: []string{"h2"}}
+	extMap[tls.ExtensionALPS] = &tls.ApplicationSettingsExtensionNew{SupportedProtocols: []string{"h2"}}
+	extMap[tls.ExtensionECH] = tls.BoringGREASEECH()
+	extMap[tls.ExtensionRecordSizeLimit] = &tls.FakeRecordSizeLimitExtension{Limit: 0x4001}
+	extMap[tls.ExtensionDelegatedCredentials] = &tls.DelegatedCredentialsExtension{
+		SupportedSignatureAlgorithms: []tls.SignatureScheme{
+			tls.ECDSAWithP256AndSHA256,
+			tls.ECDSAWithP384AndSHA384,
+			tls.ECDSAWithP521AndSHA512,
+			tls.ECDSAWithSHA1,
+		},
+	}
+
+	extensionIds := append([]uint16{}, j.extensions...)
+	if len(alpnProtocols) > 0 {
+		extensionIds = append(extensionIds, tls.ExtensionALPN)
+	}
+	sort.Slice(extensionIds, func(i, k int) bool { return extensionIds[i] < extensionIds[k] })
+
+	var exts []tls.TLSExtension
+	if grease {
+		exts = append(exts, &tls.UtlsGREASEExtension{})
+	}
+
+	if j.serverName {
+		exts = append(exts, &tls.SNIExtension{})
+	}
+
+	var trailing []tls.TLSExtension
+	for _, extensionId := range extensionIds {
+		extension, ok := extMap[extensionId]
+		if !ok {
+			extension = &tls.GenericExtension{Id: extensionId}
+		}
+
+		// padding and the pre shared key extension have to be the last extensions
+		switch extensionId {
+		case tls.ExtensionPadding, tls.ExtensionPreSharedKey:
+			trailing = append(trailing, extension)
+		default:
+			exts = append(exts, extension)
+		}
+	}
+
+	if grease {
+		exts = append(exts, &tls.UtlsGREASEExtension{})
+	}
+
+	exts = append(exts, trailing...)
+
+	return tls.ClientHelloSpec{
+		CipherSuites:       suites,
+		CompressionMethods: []byte{tls.CompressionNone},
+		Extensions:         exts,
+		GetSessionID:       sha256.Sum256,
+	}, nil
+}
+
+func parseJa4HexList(list string) ([]uint16, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var values []uint16
+	for _, value := range strings.Split(list, ",") {
+		parsed, err := strconv.ParseUint(value, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid hex value in ja4 string", value)
+		}
+
+		values = append(values, uint16(parsed))
+	}
+
+	return values, nil
+}
+
+func isJa4Hash(value string) bool {
+	if len(value) != 12 {
+		return false
+	}
+
+	_, err := strconv.ParseUint(value, 16, 64)
+
+	return err == nil
+}
+
+func isTLS13CipherSuite(suite uint16) bool {
+	return suite>>8 == 0x13
+}
+
+func containsCurve(curves []tls.CurveID, curve tls.CurveID) bool {
+	for _, c := range curves {
+		if c == curve {
+			return true
+		}
+	}
+
+	return false
+}
@@ -28,6 +28,15 @@ type CertificatePinner interface {
 }
 
 func NewCertificatePinner(certificatePins map[string][]string) (CertificatePinner, error) {
+	pinner, err := newCertificatePinner(certificatePins)
+	if err != nil {
+		return nil, err
+	}
+
+	return pinner, nil
+}
+
+func newCertificatePinner(certificatePins map[string][]string) (*certificatePinner, error) {
 	pinner := &certificatePinner{
 		certificatePins: certificatePins,
 	}
@@ -70,6 +79,11 @@ func (cp *certificatePinner) init() error {
 }
 
 func (cp *certificatePinner) Pin(conn *tls.UConn, host string) error {
+	return cp.pinConnectionState(conn.ConnectionState(), host)
+}
+
+// pinConnectionState checks the peer certificates of a finished handshake, which is also used for QUIC connections.
+func (cp *certificatePinner) pinConnectionState(state tls.ConnectionState, host string) error {
 	validPin := false
 
 	if len(cp.certificatePins) == 0 {
@@ -85,7 +99,7 @@ func (cp *certificatePinner) Pin(conn *tls.UConn, host string) error {
 
 	var actualPins []string
 
-	for _, peerCert := range conn.ConnectionState().PeerCertificates {
+	for _, peerCert := range state.PeerCertificates {
 		peerPin := hpkp.Fingerprint(peerCert)
 		actualPins = append(actualPins, peerPin)
 
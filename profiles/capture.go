@@ -0,0 +1,258 @@
+package profiles
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bogdanfinn/fhttp/http2"
+	"github.com/bogdanfinn/fhttp/http2/hpack"
+	tls "github.com/bogdanfinn/utls"
+)
+
+const (
+	http2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+	recordTypeHandshake      = 0x16
+	handshakeTypeClientHello = 0x01
+	recordHeaderLength       = 5
+	handshakeHeaderLength    = 4
+)
+
+// ErrNoClientHello is returned if the capture does not contain a complete TLS ClientHello.
+var ErrNoClientHello = errors.New("no tls client hello found")
+
+// capturedHTTP2Preface contains the connection level values of a captured HTTP/2 client preface.
+type capturedHTTP2Preface struct {
+	settings          map[http2.SettingID]uint32
+	settingsOrder     []http2.SettingID
+	connectionFlow    uint32
+	priorities        []http2.Priority
+	pseudoHeaderOrder []string
+	headerPriority    *http2.PriorityParam
+	streamID          uint32
+}
+
+// NewClientProfileFromCapture builds a ClientProfile out of a captured ClientHello and the captured HTTP/2 client preface.
+//
+// The ClientHello can be given as TLS record(s) like they are sent on the wire or as bare handshake message.
+// The HTTP/2 preface are the decrypted bytes the client sent after the handshake, starting with the connection preface
+// "PRI * HTTP/2.0" up to and including the HEADERS frame of the first request. It can be nil for clients without HTTP/2.
+//
+// GREASE values, key share data and the server name are not taken over from the capture, they are generated on every connection.
+//
+// The captures hold no HTTP/3 settings, so the profile has none and its HTTP/3 connections send the default settings
+// instead of the ones of the captured client. To add them, copy the profile with NewClientProfile and the HTTP/3
+// settings of the client, or disable HTTP/3 for clients with the profile.
+func NewClientProfileFromCapture(client string, version string, clientHello []byte, http2Preface []byte) (ClientProfile, error) {
+	record, err := clientHelloRecord(clientHello)
+	if err != nil {
+		return ClientProfile{}, err
+	}
+
+	var spec tls.ClientHelloSpec
+	if err := spec.FromRaw(record, true, true); err != nil {
+		return ClientProfile{}, fmt.Errorf("failed to parse client hello: %w", err)
+	}
+
+	normalizeCapturedSpec(&spec)
+
+	// the definition creates new extension instances for every connection out of the parsed values
+	clientHelloDefinition, err := newClientHelloDefinition(spec)
+	if err != nil {
+		return ClientProfile{}, fmt.Errorf("failed to convert client hello: %w", err)
+	}
+
+	clientHelloId := tls.ClientHelloID{
+		Client:      client,
+		Version:     version,
+		SpecFactory: clientHelloDefinition.toClientHelloSpec,
+	}
+
+	preface := &capturedHTTP2Preface{}
+	if len(http2Preface) > 0 {
+		preface, err = parseHTTP2Preface(http2Preface)
+		if err != nil {
+			return ClientProfile{}, err
+		}
+	}
+
+	return NewClientProfile(clientHelloId, preface.settings, preface.settingsOrder, preface.pseudoHeaderOrder, preface.connectionFlow, preface.priorities, preface.headerPriority, preface.streamID, false, nil, nil, 0, nil, false), nil
+}
+
+// NewClientProfileFromPcap builds a ClientProfile out of the first TLS ClientHello in a pcap or pcapng file and the captured HTTP/2 client preface.
+// See NewClientProfileFromCapture for the format of the preface.
+func NewClientProfileFromPcap(client string, version string, pcap io.Reader, http2Preface []byte) (ClientProfile, error) {
+	clientHello, err := ReadClientHelloFromPcap(pcap)
+	if err != nil {
+		return ClientProfile{}, err
+	}
+
+	return NewClientProfileFromCapture(client, version, clientHello, http2Preface)
+}
+
+// clientHelloRecord returns the ClientHello as a single TLS record.
+// A ClientHello which is split over multiple records is merged into one record.
+func clientHelloRecord(data []byte) ([]byte, error) {
+	if len(data) > 0 && data[0] == handshakeTypeClientHello {
+		return newClientHelloRecord(tls.VersionTLS10, data)
+	}
+
+	record, complete := readClientHelloRecords(data)
+	if !complete {
+		return nil, ErrNoClientHello
+	}
+
+	return record, nil
+}
+
+// readClientHelloRecords reads TLS handshake records until the ClientHello message is complete.
+// It returns false if the data does not start with a ClientHello or the message is incomplete.
+func readClientHelloRecords(data []byte) ([]byte, bool) {
+	var recordVersion uint16
+	var handshake []byte
+
+	for len(data) >= recordHeaderLength && data[0] == recordTypeHandshake {
+		if recordVersion == 0 {
+			recordVersion = uint16(data[1])<<8 | uint16(data[2])
+		}
+
+		length := int(data[3])<<8 | int(data[4])
+		if len(data) < recordHeaderLength+length {
+			return nil, false
+		}
+
+		handshake = append(handshake, data[recordHeaderLength:recordHeaderLength+length]...)
+		data = data[recordHeaderLength+length:]
+
+		if len(handshake) < handshakeHeaderLength {
+			continue
+		}
+
+		if handshake[0] != handshakeTypeClientHello {
+			return nil, false
+		}
+
+		messageLength := handshakeHeaderLength + (int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3]))
+		if len(handshake) >= messageLength {
+			record, err := newClientHelloRecord(recordVersion, handshake[:messageLength])
+
+			return record, err == nil
+		}
+	}
+
+	return nil, false
+}
+
+func newClientHelloRecord(recordVersion uint16, handshake []byte) ([]byte, error) {
+	if len(handshake) < handshakeHeaderLength || handshake[0] != handshakeTypeClientHello {
+		return nil, ErrNoClientHello
+	}
+
+	if len(handshake) > 0xffff {
+		return nil, fmt.Errorf("client hello of %d bytes is too large", len(handshake))
+	}
+
+	record := make([]byte, 0, recordHeaderLength+len(handshake))
+	record = append(record, recordTypeHandshake, byte(recordVersion>>8), byte(recordVersion), byte(len(handshake)>>8), byte(len(handshake)))
+
+	return append(record, handshake...), nil
+}
+
+// normalizeCapturedSpec removes the values of the capture which are chosen per connection.
+func normalizeCapturedSpec(spec *tls.ClientHelloSpec) {
+	for i, extension := range spec.Extensions {
+		switch ext := extension.(type) {
+		case *tls.UtlsGREASEExtension:
+			// utls sets the body of the second GREASE extension like chrome does
+			ext.Body = nil
+		case *tls.GREASEEncryptedClientHelloExtension:
+			if isBoringGREASEECH(ext) {
+				spec.Extensions[i] = tls.BoringGREASEECH()
+			}
+		}
+	}
+}
+
+// isBoringGREASEECH reports whether the captured GREASE ECH extension is one of the extensions boringssl based clients send.
+// boringssl chooses the payload length randomly, therefore the capture only contains one of the candidates.
+func isBoringGREASEECH(extension *tls.GREASEEncryptedClientHelloExtension) bool {
+	boring := tls.BoringGREASEECH()
+
+	if len(extension.CandidateCipherSuites) != 1 || extension.CandidateCipherSuites[0] != boring.CandidateCipherSuites[0] || len(extension.CandidatePayloadLens) != 1 {
+		return false
+	}
+
+	for _, payloadLength := range boring.CandidatePayloadLens {
+		// the payload contains the aead tag of 16 bytes
+		if extension.CandidatePayloadLens[0] == payloadLength || extension.CandidatePayloadLens[0] == payloadLength+16 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseHTTP2Preface reads the frames of a captured HTTP/2 client preface up to and including the first HEADERS frame.
+func parseHTTP2Preface(data []byte) (*capturedHTTP2Preface, error) {
+	data = bytes.TrimPrefix(data, []byte(http2ClientPreface))
+
+	framer := http2.NewFramer(io.Discard, bytes.NewReader(data))
+	framer.ReadMetaHeaders = hpack.NewDecoder(65536, nil)
+
+	preface := &capturedHTTP2Preface{
+		settings: make(map[http2.SettingID]uint32),
+	}
+
+	for {
+		frame, err := framer.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return preface, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read http2 frame: %w", err)
+		}
+
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+
+			_ = f.ForeachSetting(func(setting http2.Setting) error {
+				if _, exists := preface.settings[setting.ID]; !exists {
+					preface.settingsOrder = append(preface.settingsOrder, setting.ID)
+				}
+				preface.settings[setting.ID] = setting.Val
+
+				return nil
+			})
+		case *http2.WindowUpdateFrame:
+			if f.StreamID == 0 && preface.connectionFlow == 0 {
+				preface.connectionFlow = f.Increment
+			}
+		case *http2.PriorityFrame:
+			preface.priorities = append(preface.priorities, http2.Priority{StreamID: f.StreamID, PriorityParam: f.PriorityParam})
+		case *http2.MetaHeadersFrame:
+			for _, field := range f.Fields {
+				if field.IsPseudo() {
+					preface.pseudoHeaderOrder = append(preface.pseudoHeaderOrder, field.Name)
+				}
+			}
+
+			if f.HasPriority() {
+				priority := f.Priority
+				preface.headerPriority = &priority
+			}
+
+			// streams start at 1 by default
+			if f.StreamID != 1 {
+				preface.streamID = f.StreamID
+			}
+
+			return preface, nil
+		}
+	}
+}
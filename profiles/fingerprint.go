@@ -0,0 +1,499 @@
+package profiles
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bogdanfinn/fhttp/http2"
+	tls "github.com/bogdanfinn/utls"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// fingerprintServerName is the SNI used when a ClientHello is generated offline out of a profile.
+// It only has to be a valid hostname so that the server_name extension is sent like in a real connection.
+const fingerprintServerName = "fingerprint.invalid"
+
+const (
+	extensionServerName          uint16 = 0x0000
+	extensionSupportedGroups     uint16 = 0x000a
+	extensionPointFormats        uint16 = 0x000b
+	extensionSignatureAlgorithms uint16 = 0x000d
+	extensionALPN                uint16 = 0x0010
+	extensionSupportedVersions   uint16 = 0x002b
+)
+
+// FingerprintReport contains the TLS and HTTP/2 fingerprints a client profile produces on the wire.
+// The field names and formats follow the ones used by https://tls.peet.ws/api/all
+type FingerprintReport struct {
+	JA3        string `json:"ja3"`
+	JA3Hash    string `json:"ja3_hash"`
+	JA3N       string `json:"ja3n"`
+	JA3NHash   string `json:"ja3n_hash"`
+	JA4        string `json:"ja4"`
+	JA4R       string `json:"ja4_r"`
+	Akamai     string `json:"akamai_fingerprint"`
+	AkamaiHash string `json:"akamai_fingerprint_hash"`
+}
+
+// ClientHelloFingerprint contains the parts of a TLS ClientHello which are relevant for JA3 and JA4 fingerprints.
+type ClientHelloFingerprint struct {
+	ServerName          string
+	ALPNProtocols       []string
+	CipherSuites        []uint16
+	Extensions          []uint16
+	SupportedGroups     []uint16
+	PointFormats        []uint8
+	SignatureAlgorithms []uint16
+	SupportedVersions   []uint16
+	Version             uint16
+	// QUIC marks a ClientHello which was sent inside a QUIC Initial packet instead of a TLS record.
+	QUIC bool
+}
+
+// GetFingerprintReport builds the ClientHello of the profile offline and computes the JA3, JA3N and JA4 fingerprints
+// together with the Akamai HTTP/2 fingerprint of the profile. No network connection is established.
+//
+// The ClientHello is generated like on a first connection to a host, therefore a pre shared key extension is not part of the fingerprint.
+func (c ClientProfile) GetFingerprintReport() (FingerprintReport, error) {
+	raw, err := c.buildClientHello()
+	if err != nil {
+		return FingerprintReport{}, err
+	}
+
+	clientHello, err := ParseClientHello(raw)
+	if err != nil {
+		return FingerprintReport{}, fmt.Errorf("failed to parse generated client hello: %w", err)
+	}
+
+	ja3 := clientHello.JA3()
+	ja3n := clientHello.JA3N()
+	akamai := GetAkamaiFingerprint(c.GetSettings(), c.GetSettingsOrder(), c.GetConnectionFlow(), c.GetPriorities(), c.GetPseudoHeaderOrder())
+
+	return FingerprintReport{
+		JA3:        ja3,
+		JA3Hash:    md5Hex(ja3),
+		JA3N:       ja3n,
+		JA3NHash:   md5Hex(ja3n),
+		JA4:        clientHello.JA4(),
+		JA4R:       clientHello.JA4R(),
+		Akamai:     akamai,
+		AkamaiHash: md5Hex(akamai),
+	}, nil
+}
+
+func (c ClientProfile) buildClientHello() ([]byte, error) {
+	spec, err := c.GetClientHelloSpec()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build client hello spec: %w", err)
+	}
+
+	tlsConfig := &tls.Config{ServerName: fingerprintServerName, InsecureSkipVerify: true, OmitEmptyPsk: true}
+
+	uconn := tls.UClient(nil, tlsConfig, tls.HelloCustom, c.clientHelloId.RandomExtensionOrder, false, false)
+	if err := uconn.ApplyPreset(&spec); err != nil {
+		return nil, fmt.Errorf("failed to apply client hello spec: %w", err)
+	}
+
+	if err := uconn.BuildHandshakeState(); err != nil {
+		return nil, fmt.Errorf("failed to build client hello: %w", err)
+	}
+
+	return uconn.HandshakeState.Hello.Raw, nil
+}
+
+// GetAkamaiFingerprint returns the Akamai HTTP/2 fingerprint for the given HTTP/2 parameters in the format
+// SETTINGS|WINDOW_UPDATE|PRIORITY|PSEUDO_HEADER_ORDER, for example "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p".
+func GetAkamaiFingerprint(settings map[http2.SettingID]uint32, settingsOrder []http2.SettingID, connectionFlow uint32, priorities []http2.Priority, pseudoHeaderOrder []string) string {
+	var settingParts []string
+	for _, id := range settingsOrder {
+		value, ok := settings[id]
+		if !ok {
+			continue
+		}
+
+		settingParts = append(settingParts, fmt.Sprintf("%d:%d", id, value))
+	}
+
+	windowUpdate := "00"
+	if connectionFlow > 0 {
+		windowUpdate = strconv.FormatUint(uint64(connectionFlow), 10)
+	}
+
+	priorityPart := "0"
+	if len(priorities) > 0 {
+		priorityParts := make([]string, 0, len(priorities))
+		for _, priority := range priorities {
+			exclusive := 0
+			if priority.PriorityParam.Exclusive {
+				exclusive = 1
+			}
+
+			// the weight on the wire is one less than the actual weight
+			priorityParts = append(priorityParts, fmt.Sprintf("%d:%d:%d:%d", priority.StreamID, exclusive, priority.PriorityParam.StreamDep, int(priority.PriorityParam.Weight)+1))
+		}
+
+		priorityPart = strings.Join(priorityParts, ",")
+	}
+
+	pseudoHeaderParts := make([]string, 0, len(pseudoHeaderOrder))
+	for _, pseudoHeader := range pseudoHeaderOrder {
+		name := strings.TrimPrefix(pseudoHeader, ":")
+		if name == "" {
+			continue
+		}
+
+		pseudoHeaderParts = append(pseudoHeaderParts, name[:1])
+	}
+
+	return strings.Join([]string{strings.Join(settingParts, ";"), windowUpdate, priorityPart, strings.Join(pseudoHeaderParts, ",")}, "|")
+}
+
+// ParseClientHello parses a raw TLS ClientHello. The input can either be a complete TLS record or only the handshake message.
+func ParseClientHello(raw []byte) (*ClientHelloFingerprint, error) {
+	s := cryptobyte.String(raw)
+
+	// strip the record header if present
+	if len(raw) > 5 && raw[0] == 0x16 {
+		var ignored uint16
+		if !s.Skip(1) || !s.ReadUint16(&ignored) || !s.Skip(2) {
+			return nil, errors.New("unable to read record header")
+		}
+	}
+
+	var handshakeType uint8
+	var body cryptobyte.String
+	if !s.ReadUint8(&handshakeType) || !s.ReadUint24LengthPrefixed(&body) {
+		return nil, errors.New("unable to read handshake header")
+	}
+
+	if handshakeType != 0x01 {
+		return nil, fmt.Errorf("handshake message type %d is not a client hello", handshakeType)
+	}
+
+	fingerprint := &ClientHelloFingerprint{}
+
+	var sessionID, cipherSuites, compressionMethods cryptobyte.String
+	if !body.ReadUint16(&fingerprint.Version) || !body.Skip(32) ||
+		!body.ReadUint8LengthPrefixed(&sessionID) ||
+		!body.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!body.ReadUint8LengthPrefixed(&compressionMethods) {
+		return nil, errors.New("unable to read client hello")
+	}
+
+	for !cipherSuites.Empty() {
+		var suite uint16
+		if !cipherSuites.ReadUint16(&suite) {
+			return nil, errors.New("unable to read cipher suites")
+		}
+
+		fingerprint.CipherSuites = append(fingerprint.CipherSuites, suite)
+	}
+
+	if body.Empty() {
+		return fingerprint, nil
+	}
+
+	var extensions cryptobyte.String
+	if !body.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errors.New("unable to read extensions")
+	}
+
+	for !extensions.Empty() {
+		var id uint16
+		var data cryptobyte.String
+		if !extensions.ReadUint16(&id) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil, errors.New("unable to read extension")
+		}
+
+		fingerprint.Extensions = append(fingerprint.Extensions, id)
+
+		if err := fingerprint.readExtension(id, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return fingerprint, nil
+}
+
+func (f *ClientHelloFingerprint) readExtension(id uint16, data cryptobyte.String) error {
+	switch id {
+	case extensionServerName:
+		var names cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&names) {
+			return errors.New("unable to read server name extension")
+		}
+
+		for !names.Empty() {
+			var nameType uint8
+			var name cryptobyte.String
+			if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+				return errors.New("unable to read server name extension")
+			}
+
+			if nameType == 0 {
+				f.ServerName = string(name)
+			}
+		}
+	case extensionSupportedGroups:
+		var groups cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&groups) {
+			return errors.New("unable to read supported groups extension")
+		}
+
+		for !groups.Empty() {
+			var group uint16
+			if !groups.ReadUint16(&group) {
+				return errors.New("unable to read supported groups extension")
+			}
+
+			f.SupportedGroups = append(f.SupportedGroups, group)
+		}
+	case extensionPointFormats:
+		var formats cryptobyte.String
+		if !data.ReadUint8LengthPrefixed(&formats) {
+			return errors.New("unable to read point formats extension")
+		}
+
+		f.PointFormats = append(f.PointFormats, formats...)
+	case extensionSignatureAlgorithms:
+		var algorithms cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&algorithms) {
+			return errors.New("unable to read signature algorithms extension")
+		}
+
+		for !algorithms.Empty() {
+			var algorithm uint16
+			if !algorithms.ReadUint16(&algorithm) {
+				return errors.New("unable to read signature algorithms extension")
+			}
+
+			f.SignatureAlgorithms = append(f.SignatureAlgorithms, algorithm)
+		}
+	case extensionALPN:
+		var protocols cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&protocols) {
+			return errors.New("unable to read alpn extension")
+		}
+
+		for !protocols.Empty() {
+			var protocol cryptobyte.String
+			if !protocols.ReadUint8LengthPrefixed(&protocol) {
+				return errors.New("unable to read alpn extension")
+			}
+
+			f.ALPNProtocols = append(f.ALPNProtocols, string(protocol))
+		}
+	case extensionSupportedVersions:
+		var versions cryptobyte.String
+		if !data.ReadUint8LengthPrefixed(&versions) {
+			return errors.New("unable to read supported versions extension")
+		}
+
+		for !versions.Empty() {
+			var version uint16
+			if !versions.ReadUint16(&version) {
+				return errors.New("unable to read supported versions extension")
+			}
+
+			f.SupportedVersions = append(f.SupportedVersions, version)
+		}
+	}
+
+	return nil
+}
+
+// JA3 returns the JA3 string of the ClientHello. GREASE values are not part of the fingerprint.
+func (f *ClientHelloFingerprint) JA3() string {
+	return f.ja3(withoutGrease(f.Extensions))
+}
+
+// JA3N returns the JA3 string of the ClientHello with sorted extensions.
+// In contrast to JA3 it is stable for clients which randomize their extension order.
+func (f *ClientHelloFingerprint) JA3N() string {
+	extensions := withoutGrease(f.Extensions)
+	sort.Slice(extensions, func(i, j int) bool { return extensions[i] < extensions[j] })
+
+	return f.ja3(extensions)
+}
+
+func (f *ClientHelloFingerprint) ja3(extensions []uint16) string {
+	pointFormats := make([]string, len(f.PointFormats))
+	for i, format := range f.PointFormats {
+		pointFormats[i] = strconv.Itoa(int(format))
+	}
+
+	return strings.Join([]string{
+		strconv.Itoa(int(f.Version)),
+		joinDecimal(withoutGrease(f.CipherSuites)),
+		joinDecimal(extensions),
+		joinDecimal(withoutGrease(f.SupportedGroups)),
+		strings.Join(pointFormats, "-"),
+	}, ",")
+}
+
+// JA4 returns the JA4 fingerprint of the ClientHello as specified on https://github.com/FoxIO-LLC/ja4
+func (f *ClientHelloFingerprint) JA4() string {
+	ciphers, extensions := f.ja4Parts()
+
+	return fmt.Sprintf("%s_%s_%s", f.ja4Prefix(), ja4Hash(ciphers), ja4Hash(extensions))
+}
+
+// JA4R returns the raw JA4 fingerprint (JA4_r) of the ClientHello which contains the sorted values instead of their hashes.
+func (f *ClientHelloFingerprint) JA4R() string {
+	ciphers, extensions := f.ja4Parts()
+
+	return fmt.Sprintf("%s_%s_%s", f.ja4Prefix(), ciphers, extensions)
+}
+
+func (f *ClientHelloFingerprint) ja4Prefix() string {
+	protocol := "t"
+	if f.QUIC {
+		protocol = "q"
+	}
+
+	// the highest version of the supported_versions extension takes precedence over the legacy version field
+	version := f.Version
+	if supportedVersions := withoutGrease(f.SupportedVersions); len(supportedVersions) > 0 {
+		version = supportedVersions[0]
+		for _, supportedVersion := range supportedVersions {
+			version = max(version, supportedVersion)
+		}
+	}
+
+	sni := "i"
+	if containsUint16(f.Extensions, extensionServerName) {
+		sni = "d"
+	}
+
+	alpn := "00"
+	if len(f.ALPNProtocols) > 0 && f.ALPNProtocols[0] != "" {
+		first := f.ALPNProtocols[0]
+		if isAlphanumeric(first[0]) && isAlphanumeric(first[len(first)-1]) {
+			alpn = string(first[0]) + string(first[len(first)-1])
+		} else {
+			encoded := hex.EncodeToString([]byte(first))
+			alpn = encoded[:1] + encoded[len(encoded)-1:]
+		}
+	}
+
+	return fmt.Sprintf("%s%s%s%02d%02d%s", protocol, ja4Version(version), sni, min(len(withoutGrease(f.CipherSuites)), 99), min(len(withoutGrease(f.Extensions)), 99), alpn)
+}
+
+func (f *ClientHelloFingerprint) ja4Parts() (string, string) {
+	ciphers := withoutGrease(f.CipherSuites)
+	sort.Slice(ciphers, func(i, j int) bool { return ciphers[i] < ciphers[j] })
+
+	var extensions []uint16
+	for _, extension := range withoutGrease(f.Extensions) {
+		if extension == extensionServerName || extension == extensionALPN {
+			continue
+		}
+
+		extensions = append(extensions, extension)
+	}
+	sort.Slice(extensions, func(i, j int) bool { return extensions[i] < extensions[j] })
+
+	extensionPart := joinHex(extensions)
+	if len(extensions) > 0 && len(f.SignatureAlgorithms) > 0 {
+		extensionPart += "_" + joinHex(f.SignatureAlgorithms)
+	}
+
+	return joinHex(ciphers), extensionPart
+}
+
+func ja4Version(version uint16) string {
+	switch version {
+	case tls.VersionTLS13:
+		return "13"
+	case tls.VersionTLS12:
+		return "12"
+	case tls.VersionTLS11:
+		return "11"
+	case tls.VersionTLS10:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	case 0xfeff:
+		return "d1"
+	case 0xfefd:
+		return "d2"
+	case 0xfefc:
+		return "d3"
+	default:
+		return "00"
+	}
+}
+
+func ja4Hash(value string) string {
+	if value == "" {
+		return "000000000000"
+	}
+
+	sum := sha256.Sum256([]byte(value))
+
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func md5Hex(value string) string {
+	sum := md5.Sum([]byte(value))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// IsGreaseValue reports whether the value is one of the reserved GREASE values from RFC 8701.
+func IsGreaseValue(value uint16) bool {
+	return value&0x0f0f == 0x0a0a && value>>8 == value&0xff
+}
+
+func withoutGrease(values []uint16) []uint16 {
+	filtered := make([]uint16, 0, len(values))
+	for _, value := range values {
+		if IsGreaseValue(value) {
+			continue
+		}
+
+		filtered = append(filtered, value)
+	}
+
+	return filtered
+}
+
+func containsUint16(values []uint16, value uint16) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func joinDecimal(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.Itoa(int(value))
+	}
+
+	return strings.Join(parts, "-")
+}
+
+func joinHex(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = fmt.Sprintf("%04x", value)
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func isAlphanumeric(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z')
+}
@@ -0,0 +1,279 @@
+package profiles
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bogdanfinn/fhttp/http2"
+	tls "github.com/bogdanfinn/utls"
+)
+
+// chromiumClients contains the clients which are based on chromium and therefore behave like chrome on the wire.
+var chromiumClients = map[string]bool{
+	"chrome": true,
+	"brave":  true,
+	"edge":   true,
+	"opera":  true,
+}
+
+const (
+	// chromeExtensionShuffleVersion is the first chrome version which permutes the TLS extensions.
+	chromeExtensionShuffleVersion = 110
+	// chromeNewALPSVersion is the first chrome version which rolled out the new ALPS codepoint.
+	// From this version on, both codepoints are seen in the wild.
+	chromeNewALPSVersion = 131
+)
+
+// postQuantumGroups contains the hybrid key exchange groups a browser can disable by policy or flag.
+var postQuantumGroups = map[tls.CurveID]bool{
+	tls.X25519MLKEM768:                    true,
+	tls.X25519Kyber768Draft00:             true,
+	tls.FakeCurveX25519Kyber768Draft00Old: true,
+}
+
+// Generator derives randomized but plausible variants of a base profile.
+// Every variant stays within the bounds the browser of the base profile shows in the wild:
+//
+//   - chromium based profiles (version 110 and later) get a permutation of their TLS extensions like chrome does
+//   - the post quantum key share group is dropped from the key shares and the supported groups like a browser with disabled post quantum key exchange
+//   - chromium based profiles (version 131 and later) switch between the old and the new ALPS codepoint
+//   - the HTTP/2 initial window size and connection flow are taken from another built-in profile of the same browser,
+//     major version and platform with the same settings
+//
+// GREASE values are not part of the variation because they are already chosen randomly for every connection.
+// A Generator created with the same base profile and seed returns the same sequence of variants. It is safe for concurrent use.
+type Generator struct {
+	mu   sync.Mutex
+	base ClientProfile
+	rand *rand.Rand
+	// windowSizeSources are determined once, so the variants do not depend on profiles added to MappedTLSClients later
+	windowSizeSources []ClientProfile
+}
+
+type variation struct {
+	seed             int64
+	shuffle          bool
+	dropPostQuantum  bool
+	switchALPS       bool
+	windowSizeSource *ClientProfile
+}
+
+func NewGenerator(base ClientProfile, seed int64) *Generator {
+	return &Generator{
+		base:              base,
+		rand:              rand.New(rand.NewSource(seed)),
+		windowSizeSources: windowSizeSources(base),
+	}
+}
+
+// Generate returns the next variant of the base profile.
+// The returned profile always sends the same ClientHello, the variation happens between the generated profiles.
+func (g *Generator) Generate() (ClientProfile, error) {
+	baseSpec, err := g.base.GetClientHelloSpec()
+	if err != nil {
+		return ClientProfile{}, fmt.Errorf("failed to get client hello spec of base profile: %w", err)
+	}
+
+	g.mu.Lock()
+	v := g.nextVariation(baseSpec)
+	g.mu.Unlock()
+
+	base := g.base
+	clientHelloId := tls.ClientHelloID{
+		Client:               base.clientHelloId.Client,
+		RandomExtensionOrder: base.clientHelloId.RandomExtensionOrder,
+		Version:              fmt.Sprintf("%s-%x", base.clientHelloId.Version, uint64(v.seed)),
+		Seed:                 base.clientHelloId.Seed,
+		SpecFactory: func() (tls.ClientHelloSpec, error) {
+			spec, err := base.GetClientHelloSpec()
+			if err != nil {
+				return tls.ClientHelloSpec{}, err
+			}
+
+			v.apply(&spec)
+
+			return spec, nil
+		},
+	}
+
+	settings := make(map[http2.SettingID]uint32, len(base.settings))
+	for id, value := range base.settings {
+		settings[id] = value
+	}
+
+	connectionFlow := base.connectionFlow
+	if v.windowSizeSource != nil {
+		settings[http2.SettingInitialWindowSize] = v.windowSizeSource.settings[http2.SettingInitialWindowSize]
+		connectionFlow = v.windowSizeSource.connectionFlow
+	}
+
+	return NewClientProfile(clientHelloId, settings, base.settingsOrder, base.pseudoHeaderOrder, connectionFlow, base.priorities, base.headerPriority, base.streamID, base.allowHTTP, base.http3Settings, base.http3SettingsOrder, base.http3PriorityParam, base.http3PseudoHeaderOrder, base.http3SendGreaseFrames), nil
+}
+
+// nextVariation draws the variation of the next profile. The same number of random values is drawn for every variation,
+// so the sequence of a seed does not depend on the base profile.
+func (g *Generator) nextVariation(spec tls.ClientHelloSpec) variation {
+	client := strings.ToLower(g.base.clientHelloId.Client)
+	version, _ := strconv.Atoi(strings.Split(g.base.clientHelloId.Version, "_")[0])
+	isChromium := chromiumClients[client]
+
+	v := variation{
+		seed:            g.rand.Int63(),
+		shuffle:         isChromium && version >= chromeExtensionShuffleVersion,
+		dropPostQuantum: g.rand.Intn(4) == 0 && hasPostQuantumKeyShare(spec),
+		switchALPS:      g.rand.Intn(2) == 0 && isChromium && version >= chromeNewALPSVersion,
+	}
+
+	sources := g.windowSizeSources
+	pick := g.rand.Intn(len(sources) + 1)
+	if pick < len(sources) {
+		v.windowSizeSource = &sources[pick]
+	}
+
+	return v
+}
+
+func (v variation) apply(spec *tls.ClientHelloSpec) {
+	if v.dropPostQuantum {
+		dropPostQuantumGroups(spec)
+	}
+
+	if v.switchALPS {
+		switchALPSCodepoint(spec)
+	}
+
+	if v.shuffle {
+		shuffleExtensions(spec.Extensions, rand.New(rand.NewSource(v.seed)))
+	}
+}
+
+// shuffleExtensions permutes the extensions like chrome does. GREASE, padding and pre shared key extensions keep their position.
+func shuffleExtensions(extensions []tls.TLSExtension, r *rand.Rand) {
+	fixed := func(extension tls.TLSExtension) bool {
+		switch extension.(type) {
+		case *tls.UtlsGREASEExtension, *tls.UtlsPaddingExtension, *tls.UtlsPreSharedKeyExtension, *tls.FakePreSharedKeyExtension:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var positions []int
+	for i, extension := range extensions {
+		if !fixed(extension) {
+			positions = append(positions, i)
+		}
+	}
+
+	r.Shuffle(len(positions), func(i, j int) {
+		a, b := positions[i], positions[j]
+		extensions[a], extensions[b] = extensions[b], extensions[a]
+	})
+}
+
+func hasPostQuantumKeyShare(spec tls.ClientHelloSpec) bool {
+	for _, extension := range spec.Extensions {
+		keyShare, ok := extension.(*tls.KeyShareExtension)
+		if !ok {
+			continue
+		}
+
+		for _, share := range keyShare.KeyShares {
+			if postQuantumGroups[share.Group] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// dropPostQuantumGroups removes the post quantum groups from the key shares and the supported groups, so that both stay consistent.
+func dropPostQuantumGroups(spec *tls.ClientHelloSpec) {
+	for _, extension := range spec.Extensions {
+		switch ext := extension.(type) {
+		case *tls.KeyShareExtension:
+			keyShares := make([]tls.KeyShare, 0, len(ext.KeyShares))
+			for _, share := range ext.KeyShares {
+				if !postQuantumGroups[share.Group] {
+					keyShares = append(keyShares, share)
+				}
+			}
+			ext.KeyShares = keyShares
+		case *tls.SupportedCurvesExtension:
+			curves := make([]tls.CurveID, 0, len(ext.Curves))
+			for _, curve := range ext.Curves {
+				if !postQuantumGroups[curve] {
+					curves = append(curves, curve)
+				}
+			}
+			ext.Curves = curves
+		}
+	}
+}
+
+func switchALPSCodepoint(spec *tls.ClientHelloSpec) {
+	for i, extension := range spec.Extensions {
+		switch ext := extension.(type) {
+		case *tls.ApplicationSettingsExtension:
+			spec.Extensions[i] = &tls.ApplicationSettingsExtensionNew{SupportedProtocols: ext.SupportedProtocols}
+		case *tls.ApplicationSettingsExtensionNew:
+			spec.Extensions[i] = &tls.ApplicationSettingsExtension{SupportedProtocols: ext.SupportedProtocols}
+		}
+	}
+}
+
+// builtinTLSClients are the profiles of MappedTLSClients before any profile is added at runtime.
+var builtinTLSClients = maps.Clone(MappedTLSClients)
+
+// windowSizeSources returns the built-in profiles of the browser, major version and platform of the base profile which
+// send the same HTTP/2 settings, sorted by name so that the result does not depend on the map iteration order.
+// A base profile which is not built-in has no sources, as its version and platform are unknown.
+func windowSizeSources(base ClientProfile) []ClientProfile {
+	if _, ok := base.settings[http2.SettingInitialWindowSize]; !ok {
+		return nil
+	}
+
+	names := slices.Sorted(maps.Keys(builtinTLSClients))
+
+	baseInfo, found := ProfileInfo{}, false
+	for _, name := range names {
+		profile := builtinTLSClients[name]
+		if profile.clientHelloId.Client == base.clientHelloId.Client && profile.clientHelloId.Version == base.clientHelloId.Version {
+			baseInfo, found = ParseProfileName(name), true
+			break
+		}
+	}
+
+	if !found {
+		return nil
+	}
+
+	var sources []ClientProfile
+	for _, name := range names {
+		profile := builtinTLSClients[name]
+		info := ParseProfileName(name)
+
+		if info.Browser != baseInfo.Browser || info.Platform != baseInfo.Platform || majorVersion(info.Version) != majorVersion(baseInfo.Version) {
+			continue
+		}
+
+		if !strings.EqualFold(profile.clientHelloId.Client, base.clientHelloId.Client) || !slices.Equal(profile.settingsOrder, base.settingsOrder) {
+			continue
+		}
+
+		sources = append(sources, profile)
+	}
+
+	return sources
+}
+
+// majorVersion returns the first part of a dotted version like "18.5".
+func majorVersion(version string) string {
+	return strings.Split(version, ".")[0]
+}
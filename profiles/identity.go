@@ -0,0 +1,311 @@
+package profiles
+
+import (
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// RequestType selects the set of default headers of an Identity.
+type RequestType string
+
+const (
+	// RequestTypeNavigation is a top level document request like typing an url into the address bar.
+	RequestTypeNavigation RequestType = "navigation"
+	// RequestTypeFetch is a XMLHttpRequest or fetch() call issued by a script.
+	RequestTypeFetch RequestType = "fetch"
+	// RequestTypeSubresource is a script, stylesheet or image request issued while rendering a document.
+	RequestTypeSubresource RequestType = "subresource"
+)
+
+// Identity bundles a ClientProfile with the request headers and header order the same browser sends.
+// Using the headers of an Identity together with its profile avoids mismatches between the TLS/HTTP2 fingerprint and the User-Agent or client hints.
+type Identity struct {
+	profile   ClientProfile
+	userAgent string
+	headers   map[RequestType]http.Header
+}
+
+// NewIdentity creates a new Identity. The headers of each request type should contain the http.HeaderOrderKey.
+func NewIdentity(profile ClientProfile, userAgent string, headers map[RequestType]http.Header) Identity {
+	return Identity{
+		profile:   profile,
+		userAgent: userAgent,
+		headers:   headers,
+	}
+}
+
+func (i Identity) GetClientProfile() ClientProfile {
+	return i.profile
+}
+
+func (i Identity) GetUserAgent() string {
+	return i.userAgent
+}
+
+// GetHeaders returns a copy of the default headers for the request type including the header order.
+// Unknown request types fall back to the navigation headers.
+func (i Identity) GetHeaders(requestType RequestType) http.Header {
+	headers, ok := i.headers[requestType]
+	if !ok {
+		headers = i.headers[RequestTypeNavigation]
+	}
+
+	return headers.Clone()
+}
+
+const (
+	chrome146UserAgent  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/146.0.0.0 Safari/537.36"
+	chrome146SecChUa    = `"Chromium";v="146", "Not-A.Brand";v="24", "Google Chrome";v="146"`
+	firefox147UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:147.0) Gecko/20100101 Firefox/147.0"
+	safariIOS185Agent   = "Mozilla/5.0 (iPhone; CPU iPhone OS 18_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.5 Mobile/15E148 Safari/604.1"
+)
+
+var Chrome_146_Identity = NewIdentity(Chrome_146, chrome146UserAgent, map[RequestType]http.Header{
+	RequestTypeNavigation: {
+		"sec-ch-ua":                 {chrome146SecChUa},
+		"sec-ch-ua-mobile":          {"?0"},
+		"sec-ch-ua-platform":        {`"Windows"`},
+		"upgrade-insecure-requests": {"1"},
+		"user-agent":                {chrome146UserAgent},
+		"accept":                    {"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+		"sec-fetch-site":            {"none"},
+		"sec-fetch-mode":            {"navigate"},
+		"sec-fetch-user":            {"?1"},
+		"sec-fetch-dest":            {"document"},
+		"accept-encoding":           {"gzip, deflate, br, zstd"},
+		"accept-language":           {"en-US,en;q=0.9"},
+		"priority":                  {"u=0, i"},
+		http.HeaderOrderKey: {
+			"sec-ch-ua",
+			"sec-ch-ua-mobile",
+			"sec-ch-ua-platform",
+			"upgrade-insecure-requests",
+			"user-agent",
+			"accept",
+			"sec-fetch-site",
+			"sec-fetch-mode",
+			"sec-fetch-user",
+			"sec-fetch-dest",
+			"accept-encoding",
+			"accept-language",
+			"cookie",
+			"priority",
+		},
+	},
+	RequestTypeFetch: {
+		"sec-ch-ua-platform": {`"Windows"`},
+		"user-agent":         {chrome146UserAgent},
+		"sec-ch-ua":          {chrome146SecChUa},
+		"sec-ch-ua-mobile":   {"?0"},
+		"accept":             {"*/*"},
+		"sec-fetch-site":     {"same-origin"},
+		"sec-fetch-mode":     {"cors"},
+		"sec-fetch-dest":     {"empty"},
+		"accept-encoding":    {"gzip, deflate, br, zstd"},
+		"accept-language":    {"en-US,en;q=0.9"},
+		"priority":           {"u=1, i"},
+		http.HeaderOrderKey: {
+			"content-length",
+			"sec-ch-ua-platform",
+			"user-agent",
+			"sec-ch-ua",
+			"content-type",
+			"sec-ch-ua-mobile",
+			"accept",
+			"origin",
+			"sec-fetch-site",
+			"sec-fetch-mode",
+			"sec-fetch-dest",
+			"referer",
+			"accept-encoding",
+			"accept-language",
+			"cookie",
+			"priority",
+		},
+	},
+	RequestTypeSubresource: {
+		"sec-ch-ua-platform": {`"Windows"`},
+		"user-agent":         {chrome146UserAgent},
+		"sec-ch-ua":          {chrome146SecChUa},
+		"sec-ch-ua-mobile":   {"?0"},
+		"accept":             {"*/*"},
+		"sec-fetch-site":     {"same-origin"},
+		"sec-fetch-mode":     {"no-cors"},
+		"sec-fetch-dest":     {"script"},
+		"accept-encoding":    {"gzip, deflate, br, zstd"},
+		"accept-language":    {"en-US,en;q=0.9"},
+		http.HeaderOrderKey: {
+			"sec-ch-ua-platform",
+			"user-agent",
+			"sec-ch-ua",
+			"sec-ch-ua-mobile",
+			"accept",
+			"sec-fetch-site",
+			"sec-fetch-mode",
+			"sec-fetch-dest",
+			"referer",
+			"accept-encoding",
+			"accept-language",
+			"cookie",
+			"priority",
+		},
+	},
+})
+
+var Firefox_147_Identity = NewIdentity(Firefox_147, firefox147UserAgent, map[RequestType]http.Header{
+	RequestTypeNavigation: {
+		"user-agent":                {firefox147UserAgent},
+		"accept":                    {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+		"accept-language":           {"en-US,en;q=0.5"},
+		"accept-encoding":           {"gzip, deflate, br, zstd"},
+		"upgrade-insecure-requests": {"1"},
+		"sec-fetch-dest":            {"document"},
+		"sec-fetch-mode":            {"navigate"},
+		"sec-fetch-site":            {"none"},
+		"sec-fetch-user":            {"?1"},
+		"priority":                  {"u=0, i"},
+		"te":                        {"trailers"},
+		http.HeaderOrderKey: {
+			"user-agent",
+			"accept",
+			"accept-language",
+			"accept-encoding",
+			"referer",
+			"cookie",
+			"upgrade-insecure-requests",
+			"sec-fetch-dest",
+			"sec-fetch-mode",
+			"sec-fetch-site",
+			"sec-fetch-user",
+			"priority",
+			"te",
+		},
+	},
+	RequestTypeFetch: {
+		"user-agent":      {firefox147UserAgent},
+		"accept":          {"*/*"},
+		"accept-language": {"en-US,en;q=0.5"},
+		"accept-encoding": {"gzip, deflate, br, zstd"},
+		"sec-fetch-dest":  {"empty"},
+		"sec-fetch-mode":  {"cors"},
+		"sec-fetch-site":  {"same-origin"},
+		"priority":        {"u=4"},
+		"te":              {"trailers"},
+		http.HeaderOrderKey: {
+			"user-agent",
+			"accept",
+			"accept-language",
+			"accept-encoding",
+			"referer",
+			"content-type",
+			"content-length",
+			"origin",
+			"cookie",
+			"sec-fetch-dest",
+			"sec-fetch-mode",
+			"sec-fetch-site",
+			"priority",
+			"te",
+		},
+	},
+	RequestTypeSubresource: {
+		"user-agent":      {firefox147UserAgent},
+		"accept":          {"*/*"},
+		"accept-language": {"en-US,en;q=0.5"},
+		"accept-encoding": {"gzip, deflate, br, zstd"},
+		"sec-fetch-dest":  {"script"},
+		"sec-fetch-mode":  {"no-cors"},
+		"sec-fetch-site":  {"same-origin"},
+		"priority":        {"u=2"},
+		http.HeaderOrderKey: {
+			"user-agent",
+			"accept",
+			"accept-language",
+			"accept-encoding",
+			"referer",
+			"cookie",
+			"sec-fetch-dest",
+			"sec-fetch-mode",
+			"sec-fetch-site",
+			"priority",
+		},
+	},
+})
+
+var Safari_IOS_18_5_Identity = NewIdentity(Safari_IOS_18_5, safariIOS185Agent, map[RequestType]http.Header{
+	RequestTypeNavigation: {
+		"sec-fetch-dest":  {"document"},
+		"user-agent":      {safariIOS185Agent},
+		"accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+		"sec-fetch-site":  {"none"},
+		"sec-fetch-mode":  {"navigate"},
+		"accept-language": {"en-US,en;q=0.9"},
+		"priority":        {"u=0, i"},
+		"accept-encoding": {"gzip, deflate, br"},
+		http.HeaderOrderKey: {
+			"sec-fetch-dest",
+			"user-agent",
+			"accept",
+			"referer",
+			"sec-fetch-site",
+			"sec-fetch-mode",
+			"accept-language",
+			"priority",
+			"accept-encoding",
+			"cookie",
+		},
+	},
+	RequestTypeFetch: {
+		"accept":          {"*/*"},
+		"sec-fetch-site":  {"same-origin"},
+		"accept-language": {"en-US,en;q=0.9"},
+		"accept-encoding": {"gzip, deflate, br"},
+		"sec-fetch-mode":  {"cors"},
+		"user-agent":      {safariIOS185Agent},
+		"sec-fetch-dest":  {"empty"},
+		"priority":        {"u=3, i"},
+		http.HeaderOrderKey: {
+			"content-type",
+			"accept",
+			"sec-fetch-site",
+			"origin",
+			"accept-language",
+			"accept-encoding",
+			"sec-fetch-mode",
+			"user-agent",
+			"referer",
+			"content-length",
+			"sec-fetch-dest",
+			"cookie",
+			"priority",
+		},
+	},
+	RequestTypeSubresource: {
+		"sec-fetch-dest":  {"script"},
+		"user-agent":      {safariIOS185Agent},
+		"accept":          {"*/*"},
+		"sec-fetch-site":  {"same-origin"},
+		"sec-fetch-mode":  {"no-cors"},
+		"accept-language": {"en-US,en;q=0.9"},
+		"priority":        {"u=1"},
+		"accept-encoding": {"gzip, deflate, br"},
+		http.HeaderOrderKey: {
+			"sec-fetch-dest",
+			"user-agent",
+			"accept",
+			"referer",
+			"sec-fetch-site",
+			"sec-fetch-mode",
+			"accept-language",
+			"priority",
+			"accept-encoding",
+			"cookie",
+		},
+	},
+})
+
+// MappedIdentities contains the identities by the name of their profile in MappedTLSClients.
+var MappedIdentities = map[string]Identity{
+	"chrome_146":      Chrome_146_Identity,
+	"firefox_147":     Firefox_147_Identity,
+	"safari_ios_18_5": Safari_IOS_18_5_Identity,
+}
@@ -0,0 +1,375 @@
+package profiles
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	pcapMagic            = 0xa1b2c3d4
+	pcapMagicNanoseconds = 0xa1b23c4d
+	pcapHeaderLength     = 24
+	pcapRecordLength     = 16
+
+	pcapngSectionHeaderBlock        = 0x0a0d0d0a
+	pcapngInterfaceDescriptionBlock = 0x00000001
+	pcapngPacketBlock               = 0x00000002
+	pcapngSimplePacketBlock         = 0x00000003
+	pcapngEnhancedPacketBlock       = 0x00000006
+	pcapngByteOrderMagic            = 0x1a2b3c4d
+
+	linkTypeNull      = 0
+	linkTypeEthernet  = 1
+	linkTypeRawIP     = 101
+	linkTypeRawIPAlt  = 12
+	linkTypeRawIPv4   = 14
+	linkTypeLinuxSLL  = 113
+	linkTypeIPv4      = 228
+	linkTypeIPv6      = 229
+	linkTypeLinuxSLL2 = 276
+
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+
+	ipProtocolTCP = 6
+)
+
+// tcpFlow identifies one direction of a TCP connection.
+type tcpFlow struct {
+	src, dst         string
+	srcPort, dstPort uint16
+}
+
+type tcpSegment struct {
+	seq     uint32
+	payload []byte
+}
+
+// ReadClientHelloFromPcap returns the first complete TLS ClientHello of a pcap or pcapng capture as TLS record.
+// Ethernet, Linux cooked (SLL and SLL2), loopback and raw IP captures are supported. The TCP stream of every connection is
+// reassembled, so a ClientHello which is split over multiple or out of order segments is found as well.
+func ReadClientHelloFromPcap(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture: %w", err)
+	}
+
+	if len(data) < 4 {
+		return nil, errors.New("capture is too short")
+	}
+
+	var packets []capturedPacket
+	switch {
+	case binary.LittleEndian.Uint32(data) == pcapngSectionHeaderBlock:
+		packets, err = readPcapngPackets(data)
+	default:
+		packets, err = readPcapPackets(data)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return findClientHello(packets)
+}
+
+type capturedPacket struct {
+	linkType uint32
+	data     []byte
+}
+
+func readPcapPackets(data []byte) ([]capturedPacket, error) {
+	if len(data) < pcapHeaderLength {
+		return nil, errors.New("pcap header is too short")
+	}
+
+	var byteOrder binary.ByteOrder
+	switch magic := binary.LittleEndian.Uint32(data); magic {
+	case pcapMagic, pcapMagicNanoseconds:
+		byteOrder = binary.LittleEndian
+	default:
+		switch binary.BigEndian.Uint32(data) {
+		case pcapMagic, pcapMagicNanoseconds:
+			byteOrder = binary.BigEndian
+		default:
+			return nil, fmt.Errorf("unknown capture format with magic number %#08x", magic)
+		}
+	}
+
+	// the upper bits of the link type field can contain the FCS length
+	linkType := byteOrder.Uint32(data[20:24]) & 0x0fffffff
+	data = data[pcapHeaderLength:]
+
+	var packets []capturedPacket
+	for len(data) >= pcapRecordLength {
+		capturedLength := int(byteOrder.Uint32(data[8:12]))
+		data = data[pcapRecordLength:]
+
+		if capturedLength > len(data) {
+			// the capture has been cut off in the middle of the packet
+			break
+		}
+
+		packets = append(packets, capturedPacket{linkType: linkType, data: data[:capturedLength]})
+		data = data[capturedLength:]
+	}
+
+	return packets, nil
+}
+
+func readPcapngPackets(data []byte) ([]capturedPacket, error) {
+	var byteOrder binary.ByteOrder = binary.LittleEndian
+	var linkTypes []uint32
+	var packets []capturedPacket
+
+	for len(data) >= 12 {
+		if binary.LittleEndian.Uint32(data) == pcapngSectionHeaderBlock {
+			// the byte order is defined per section
+			switch {
+			case binary.LittleEndian.Uint32(data[8:12]) == pcapngByteOrderMagic:
+				byteOrder = binary.LittleEndian
+			case binary.BigEndian.Uint32(data[8:12]) == pcapngByteOrderMagic:
+				byteOrder = binary.BigEndian
+			default:
+				return nil, errors.New("invalid pcapng byte order magic")
+			}
+
+			linkTypes = nil
+		}
+
+		blockType := byteOrder.Uint32(data[0:4])
+		blockLength := int(byteOrder.Uint32(data[4:8]))
+		if blockLength < 12 || blockLength > len(data) {
+			break
+		}
+
+		body := data[8 : blockLength-4]
+		data = data[blockLength:]
+
+		switch blockType {
+		case pcapngInterfaceDescriptionBlock:
+			if len(body) >= 2 {
+				linkTypes = append(linkTypes, uint32(byteOrder.Uint16(body[0:2])))
+			}
+		case pcapngEnhancedPacketBlock, pcapngPacketBlock:
+			if len(body) < 20 {
+				continue
+			}
+
+			var interfaceID uint32
+			if blockType == pcapngEnhancedPacketBlock {
+				interfaceID = byteOrder.Uint32(body[0:4])
+			} else {
+				interfaceID = uint32(byteOrder.Uint16(body[0:2]))
+			}
+
+			capturedLength := int(byteOrder.Uint32(body[12:16]))
+			if int(interfaceID) >= len(linkTypes) || 20+capturedLength > len(body) {
+				continue
+			}
+
+			packets = append(packets, capturedPacket{linkType: linkTypes[interfaceID], data: body[20 : 20+capturedLength]})
+		case pcapngSimplePacketBlock:
+			if len(body) < 4 || len(linkTypes) == 0 {
+				continue
+			}
+
+			capturedLength := int(byteOrder.Uint32(body[0:4]))
+			if 4+capturedLength > len(body) {
+				capturedLength = len(body) - 4
+			}
+
+			packets = append(packets, capturedPacket{linkType: linkTypes[0], data: body[4 : 4+capturedLength]})
+		}
+	}
+
+	return packets, nil
+}
+
+// findClientHello reassembles the TCP streams of the packets and returns the first ClientHello by the order the connections appear in the capture.
+func findClientHello(packets []capturedPacket) ([]byte, error) {
+	var flows []tcpFlow
+	segments := make(map[tcpFlow][]tcpSegment)
+
+	for _, packet := range packets {
+		flow, seq, payload, ok := parseTCPPacket(packet)
+		if !ok || len(payload) == 0 {
+			continue
+		}
+
+		if _, exists := segments[flow]; !exists {
+			flows = append(flows, flow)
+		}
+
+		segments[flow] = append(segments[flow], tcpSegment{seq: seq, payload: payload})
+	}
+
+	for _, flow := range flows {
+		stream := reassembleTCPStream(segments[flow])
+		if len(stream) == 0 || stream[0] != recordTypeHandshake {
+			continue
+		}
+
+		if record, complete := readClientHelloRecords(stream); complete {
+			return record, nil
+		}
+	}
+
+	return nil, ErrNoClientHello
+}
+
+// reassembleTCPStream orders the segments by their sequence number relative to the lowest one and returns the contiguous start of the stream.
+// Retransmitted and overlapping segments are merged.
+func reassembleTCPStream(segments []tcpSegment) []byte {
+	initialSeq := segments[0].seq
+	for _, segment := range segments[1:] {
+		// compare with wrap around of the sequence numbers
+		if int32(segment.seq-initialSeq) < 0 {
+			initialSeq = segment.seq
+		}
+	}
+
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].seq-initialSeq < segments[j].seq-initialSeq
+	})
+
+	var stream []byte
+	for _, segment := range segments {
+		offset := int(segment.seq - initialSeq)
+		if offset > len(stream) {
+			// missing segment
+			break
+		}
+
+		if end := offset + len(segment.payload); end > len(stream) {
+			stream = append(stream, segment.payload[len(stream)-offset:]...)
+		}
+	}
+
+	return stream
+}
+
+func parseTCPPacket(packet capturedPacket) (tcpFlow, uint32, []byte, bool) {
+	data := packet.data
+	var etherType uint16
+
+	switch packet.linkType {
+	case linkTypeNull:
+		if len(data) < 4 {
+			return tcpFlow{}, 0, nil, false
+		}
+
+		data = data[4:]
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return tcpFlow{}, 0, nil, false
+		}
+
+		etherType = binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+
+		for etherType == etherTypeVLAN && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return tcpFlow{}, 0, nil, false
+		}
+
+		etherType = binary.BigEndian.Uint16(data[14:16])
+		data = data[16:]
+	case linkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return tcpFlow{}, 0, nil, false
+		}
+
+		etherType = binary.BigEndian.Uint16(data[0:2])
+		data = data[20:]
+	case linkTypeRawIP, linkTypeRawIPAlt, linkTypeRawIPv4, linkTypeIPv4, linkTypeIPv6:
+	default:
+		return tcpFlow{}, 0, nil, false
+	}
+
+	if etherType != 0 && etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+		return tcpFlow{}, 0, nil, false
+	}
+
+	flow, segment, ok := parseIPPacket(data)
+	if !ok || len(segment) < 20 {
+		return tcpFlow{}, 0, nil, false
+	}
+
+	headerLength := int(segment[12]>>4) * 4
+	if headerLength < 20 || headerLength > len(segment) {
+		return tcpFlow{}, 0, nil, false
+	}
+
+	flow.srcPort = binary.BigEndian.Uint16(segment[0:2])
+	flow.dstPort = binary.BigEndian.Uint16(segment[2:4])
+
+	return flow, binary.BigEndian.Uint32(segment[4:8]), segment[headerLength:], true
+}
+
+// parseIPPacket returns the flow addresses and the TCP segment of an IPv4 or IPv6 packet.
+func parseIPPacket(data []byte) (tcpFlow, []byte, bool) {
+	if len(data) < 1 {
+		return tcpFlow{}, nil, false
+	}
+
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return tcpFlow{}, nil, false
+		}
+
+		headerLength := int(data[0]&0x0f) * 4
+		totalLength := int(binary.BigEndian.Uint16(data[2:4]))
+		if data[9] != ipProtocolTCP || headerLength < 20 || totalLength < headerLength || totalLength > len(data) {
+			return tcpFlow{}, nil, false
+		}
+
+		// fragmented packets are not reassembled
+		if binary.BigEndian.Uint16(data[6:8])&0x3fff != 0 {
+			return tcpFlow{}, nil, false
+		}
+
+		return tcpFlow{src: string(data[12:16]), dst: string(data[16:20])}, data[headerLength:totalLength], true
+	case 6:
+		if len(data) < 40 {
+			return tcpFlow{}, nil, false
+		}
+
+		payloadLength := int(binary.BigEndian.Uint16(data[4:6]))
+		if 40+payloadLength > len(data) {
+			return tcpFlow{}, nil, false
+		}
+
+		flow := tcpFlow{src: string(data[8:24]), dst: string(data[24:40])}
+		nextHeader := data[6]
+		payload := data[40 : 40+payloadLength]
+
+		// skip the hop-by-hop, routing and destination options extension headers
+		for nextHeader == 0 || nextHeader == 43 || nextHeader == 60 {
+			if len(payload) < 8 {
+				return tcpFlow{}, nil, false
+			}
+
+			length := (int(payload[1]) + 1) * 8
+			if length > len(payload) {
+				return tcpFlow{}, nil, false
+			}
+
+			nextHeader = payload[0]
+			payload = payload[length:]
+		}
+
+		return flow, payload, nextHeader == ipProtocolTCP
+	default:
+		return tcpFlow{}, nil, false
+	}
+}
@@ -125,8 +125,15 @@ func NewClientProfile(clientHelloId tls.ClientHelloID, settings map[http2.Settin
 	}
 }
 
+// GetClientHelloSpec returns the ClientHelloSpec of the profile.
+// Profiles which are based on one of the utls built-in ClientHelloIDs are resolved through utls.
 func (c ClientProfile) GetClientHelloSpec() (tls.ClientHelloSpec, error) {
-	return c.clientHelloId.ToSpec()
+	spec, err := c.clientHelloId.ToSpec()
+	if err != nil {
+		return tls.UTLSIdToSpec(c.clientHelloId)
+	}
+
+	return spec, nil
 }
 
 func (c ClientProfile) GetClientHelloStr() string {
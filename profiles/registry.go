@@ -0,0 +1,325 @@
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrProfileNotFound is returned by the Registry if no profile matches the requested identifier.
+var ErrProfileNotFound = errors.New("profile not found")
+
+// LatestVersion can be passed as version to Registry.Lookup to resolve the newest registered version of a browser.
+const LatestVersion = "latest"
+
+// ProfileInfo describes a registered profile.
+// Platform is empty for profiles which are not bound to a specific platform.
+type ProfileInfo struct {
+	Name     string
+	Browser  string
+	Version  string
+	Platform string
+}
+
+type registryEntry struct {
+	info    ProfileInfo
+	profile ClientProfile
+}
+
+// Registry holds client profiles and resolves them by name or by browser, version and platform.
+// It is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	entries map[string]registryEntry
+	// mapped is read on every lookup, so profiles which are added to it later are found as well.
+	// Registered profiles take precedence over mapped profiles with the same name.
+	mapped map[string]ClientProfile
+}
+
+// DefaultRegistry contains all profiles of MappedTLSClients, including the ones added to it at runtime.
+// MappedTLSClients is a plain map, profiles which are added while clients are created should be registered instead.
+var DefaultRegistry = newDefaultRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		entries: make(map[string]registryEntry),
+	}
+}
+
+func newDefaultRegistry() *Registry {
+	registry := NewRegistry()
+	registry.mapped = MappedTLSClients
+
+	return registry
+}
+
+// Register adds the profile to the registry. A profile registered under an existing name replaces the previous one.
+// If only the name of the info is set, browser, version and platform are derived from the name (see ParseProfileName).
+func (r *Registry) Register(info ProfileInfo, profile ClientProfile) error {
+	if info.Name == "" {
+		return errors.New("profile name must not be empty")
+	}
+
+	if info.Browser == "" {
+		parsed := ParseProfileName(info.Name)
+		info.Browser, info.Version, info.Platform = parsed.Browser, parsed.Version, parsed.Platform
+	}
+
+	info.Browser = strings.ToLower(info.Browser)
+	info.Platform = strings.ToLower(info.Platform)
+	info.Version = normalizeVersion(info.Version)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[info.Name] = registryEntry{info: info, profile: profile}
+
+	return nil
+}
+
+// Get returns the profile registered under the given name, for example "chrome_133".
+func (r *Registry) Get(name string) (ClientProfile, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if entry, ok := r.entries[name]; ok {
+		return entry.profile, nil
+	}
+
+	if profile, ok := r.mapped[name]; ok {
+		return profile, nil
+	}
+
+	return ClientProfile{}, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+}
+
+// Resolve returns the profile registered under the identifier.
+// Identifiers of the form "<browser>_latest" or "<browser>_<platform>_latest" resolve the newest version, for example "chrome_latest" or "safari_ios_latest".
+func (r *Registry) Resolve(identifier string) (ClientProfile, error) {
+	profile, err := r.Get(identifier)
+	if err == nil || !strings.HasSuffix(identifier, "_"+LatestVersion) {
+		return profile, err
+	}
+
+	info := ParseProfileName(strings.TrimSuffix(identifier, "_"+LatestVersion))
+
+	return r.Latest(info.Browser, info.Platform)
+}
+
+// Infos returns the info of all registered profiles sorted by name.
+func (r *Registry) Infos() []ProfileInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := r.allEntries()
+
+	infos := make([]ProfileInfo, 0, len(entries))
+	for _, entry := range entries {
+		infos = append(infos, entry.info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	return infos
+}
+
+// Lookup returns the profile with exactly the given browser and version.
+// An empty version or LatestVersion resolves the newest version of the browser.
+// An empty platform matches all profiles, otherwise profiles of the platform are preferred over profiles without platform.
+func (r *Registry) Lookup(browser string, version string, platform string) (ClientProfile, error) {
+	if version == "" || version == LatestVersion {
+		return r.Latest(browser, platform)
+	}
+
+	candidates := r.candidates(browser, platform)
+	version = normalizeVersion(version)
+
+	for _, candidate := range candidates {
+		if compareVersions(candidate.info.Version, version) == 0 {
+			return candidate.profile, nil
+		}
+	}
+
+	return ClientProfile{}, fmt.Errorf("%w: %s %s %s", ErrProfileNotFound, browser, version, platform)
+}
+
+// Latest returns the newest version of the browser.
+func (r *Registry) Latest(browser string, platform string) (ClientProfile, error) {
+	candidates := r.candidates(browser, platform)
+	if len(candidates) == 0 {
+		return ClientProfile{}, fmt.Errorf("%w: %s %s", ErrProfileNotFound, browser, platform)
+	}
+
+	latest := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if compareVersions(candidate.info.Version, latest.info.Version) > 0 {
+			latest = candidate
+		}
+	}
+
+	return latest.profile, nil
+}
+
+// Closest returns the profile with the given version if it exists.
+// Otherwise the newest version older than the requested one is returned, or the oldest version if all versions are newer.
+func (r *Registry) Closest(browser string, version string, platform string) (ClientProfile, error) {
+	if version == "" || version == LatestVersion {
+		return r.Latest(browser, platform)
+	}
+
+	candidates := r.candidates(browser, platform)
+	if len(candidates) == 0 {
+		return ClientProfile{}, fmt.Errorf("%w: %s %s", ErrProfileNotFound, browser, platform)
+	}
+
+	version = normalizeVersion(version)
+	closest := candidates[0]
+
+	for _, candidate := range candidates[1:] {
+		if compareVersions(candidate.info.Version, version) > 0 {
+			break
+		}
+
+		if compareVersions(candidate.info.Version, closest.info.Version) > 0 {
+			closest = candidate
+		}
+	}
+
+	return closest.profile, nil
+}
+
+// candidates returns all entries of the browser on the platform, sorted ascending by version.
+// Entries with equal versions are sorted by preference, the preferred entry first.
+func (r *Registry) candidates(browser string, platform string) []registryEntry {
+	browser = strings.ToLower(browser)
+	platform = strings.ToLower(platform)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var candidates []registryEntry
+	for _, entry := range r.allEntries() {
+		if entry.info.Browser != browser {
+			continue
+		}
+
+		if platform != "" && entry.info.Platform != "" && entry.info.Platform != platform {
+			continue
+		}
+
+		candidates = append(candidates, entry)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i].info, candidates[j].info
+
+		if c := compareVersions(a.Version, b.Version); c != 0 {
+			return c < 0
+		}
+
+		// prefer an exact platform match, which are profiles without platform if no platform was requested
+		if aMatches, bMatches := a.Platform == platform, b.Platform == platform; aMatches != bMatches {
+			return aMatches
+		}
+
+		// prefer the plain profile over variants like chrome_133_PSK
+		if len(a.Name) != len(b.Name) {
+			return len(a.Name) < len(b.Name)
+		}
+
+		return a.Name < b.Name
+	})
+
+	return candidates
+}
+
+// allEntries returns the registered entries and the mapped profiles which are not overridden by one of them.
+// The caller has to hold the read lock.
+func (r *Registry) allEntries() []registryEntry {
+	entries := make([]registryEntry, 0, len(r.entries)+len(r.mapped))
+	for _, entry := range r.entries {
+		entries = append(entries, entry)
+	}
+
+	for name, profile := range r.mapped {
+		if _, ok := r.entries[name]; !ok {
+			entries = append(entries, registryEntry{info: ParseProfileName(name), profile: profile})
+		}
+	}
+
+	return entries
+}
+
+var knownPlatforms = map[string]bool{
+	"android": true,
+	"ios":     true,
+	"ipad":    true,
+	"linux":   true,
+	"macos":   true,
+	"windows": true,
+}
+
+// ParseProfileName derives browser, version and platform from a profile name like "safari_ios_16_0" or "chrome_133_PSK".
+// Numeric parts form the version, known platform names the platform and all other parts are treated as variant.
+func ParseProfileName(name string) ProfileInfo {
+	parts := strings.Split(name, "_")
+	info := ProfileInfo{
+		Name:    name,
+		Browser: strings.ToLower(parts[0]),
+	}
+
+	var versionParts []string
+	for _, part := range parts[1:] {
+		lowerPart := strings.ToLower(part)
+
+		switch {
+		case knownPlatforms[lowerPart]:
+			info.Platform = lowerPart
+		case isNumeric(part):
+			versionParts = append(versionParts, part)
+		}
+	}
+
+	info.Version = strings.Join(versionParts, ".")
+
+	return info
+}
+
+func normalizeVersion(version string) string {
+	return strings.ReplaceAll(version, "_", ".")
+}
+
+// compareVersions compares dotted numeric versions. Missing parts are treated as zero.
+func compareVersions(a string, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aValue, bValue int
+		if i < len(aParts) {
+			aValue, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bValue, _ = strconv.Atoi(bParts[i])
+		}
+
+		if aValue != bValue {
+			if aValue < bValue {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func isNumeric(value string) bool {
+	_, err := strconv.Atoi(value)
+
+	return err == nil
+}
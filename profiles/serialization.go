@@ -0,0 +1,810 @@
+package profiles
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bogdanfinn/fhttp/http2"
+	tls "github.com/bogdanfinn/utls"
+	"github.com/bogdanfinn/utls/dicttls"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	greaseName      = "GREASE"
+	unknownSettingF = "UNKNOWN_SETTING_%d"
+)
+
+// extension names used in profile files. They follow the IANA names where available.
+const (
+	extensionNameGREASE                 = "GREASE"
+	extensionNameServerName             = "server_name"
+	extensionNameStatusRequest          = "status_request"
+	extensionNameSupportedGroups        = "supported_groups"
+	extensionNamePointFormats           = "ec_point_formats"
+	extensionNameSignatureAlgorithms    = "signature_algorithms"
+	extensionNameALPN                   = "application_layer_protocol_negotiation"
+	extensionNameSCT                    = "signed_certificate_timestamp"
+	extensionNamePadding                = "padding"
+	extensionNameExtendedMasterSecret   = "extended_master_secret"
+	extensionNameCompressCertificate    = "compress_certificate"
+	extensionNameRecordSizeLimit        = "record_size_limit"
+	extensionNameDelegatedCredentials   = "delegated_credentials"
+	extensionNameSessionTicket          = "session_ticket"
+	extensionNamePreSharedKey           = "pre_shared_key"
+	extensionNameSupportedVersions      = "supported_versions"
+	extensionNamePSKKeyExchangeModes    = "psk_key_exchange_modes"
+	extensionNameKeyShare               = "key_share"
+	extensionNameApplicationSettings    = "application_settings"
+	extensionNameApplicationSettingsNew = "application_settings_new"
+	extensionNameGREASEECH              = "encrypted_client_hello_grease"
+	extensionNameRenegotiationInfo      = "renegotiation_info"
+	extensionNameGeneric                = "generic"
+)
+
+var ErrUnsupportedExtension = errors.New("extension can not be serialized")
+
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS13: "1.3",
+	tls.VersionTLS12: "1.2",
+	tls.VersionTLS11: "1.1",
+	tls.VersionTLS10: "1.0",
+}
+
+var supportedGroupNames = mergeNames(dicttls.DictSupportedGroupsValueIndexed, map[uint16]string{
+	uint16(tls.X25519MLKEM768):           "X25519MLKEM768",
+	uint16(tls.X25519Kyber768Draft00):    "X25519Kyber768Draft00",
+	uint16(tls.X25519Kyber512Draft00):    "X25519Kyber512Draft00",
+	uint16(tls.X25519Kyber768Draft00Old): "X25519Kyber768Draft00Old",
+	uint16(tls.P256Kyber768Draft00):      "P256Kyber768Draft00",
+})
+
+var http3SettingNames = map[uint64]string{
+	0x1:  "QPACK_MAX_TABLE_CAPACITY",
+	0x6:  "MAX_FIELD_SECTION_SIZE",
+	0x7:  "QPACK_BLOCKED_STREAMS",
+	0x8:  "ENABLE_CONNECT_PROTOCOL",
+	0x33: "H3_DATAGRAM",
+}
+
+// profileDefinition is the file representation of a ClientProfile.
+type profileDefinition struct {
+	Client  string                `json:"client" yaml:"client"`
+	Version string                `json:"version" yaml:"version"`
+	TLS     clientHelloDefinition `json:"tls" yaml:"tls"`
+	HTTP2   http2Definition       `json:"http2" yaml:"http2"`
+	HTTP3   *http3Definition      `json:"http3,omitempty" yaml:"http3,omitempty"`
+}
+
+type clientHelloDefinition struct {
+	MinVersion         string                `json:"min_version,omitempty" yaml:"min_version,omitempty"`
+	MaxVersion         string                `json:"max_version,omitempty" yaml:"max_version,omitempty"`
+	CipherSuites       []string              `json:"cipher_suites" yaml:"cipher_suites"`
+	CompressionMethods []uint16              `json:"compression_methods,omitempty" yaml:"compression_methods,omitempty,flow"`
+	Extensions         []extensionDefinition `json:"extensions" yaml:"extensions"`
+}
+
+// extensionDefinition describes a single extension. Only the fields relevant for the extension named by Name are set.
+type extensionDefinition struct {
+	Name                string                      `json:"name" yaml:"name"`
+	ID                  uint16                      `json:"id,omitempty" yaml:"id,omitempty"`
+	Data                string                      `json:"data,omitempty" yaml:"data,omitempty"`
+	Groups              []string                    `json:"groups,omitempty" yaml:"groups,omitempty"`
+	PointFormats        []uint16                    `json:"point_formats,omitempty" yaml:"point_formats,omitempty,flow"`
+	SignatureAlgorithms []string                    `json:"signature_algorithms,omitempty" yaml:"signature_algorithms,omitempty"`
+	Protocols           []string                    `json:"protocols,omitempty" yaml:"protocols,omitempty"`
+	Algorithms          []string                    `json:"algorithms,omitempty" yaml:"algorithms,omitempty"`
+	Versions            []string                    `json:"versions,omitempty" yaml:"versions,omitempty"`
+	Modes               []uint16                    `json:"modes,omitempty" yaml:"modes,omitempty,flow"`
+	KeyShares           []keyShareDefinition        `json:"key_shares,omitempty" yaml:"key_shares,omitempty"`
+	CipherSuites        []hpkeCipherSuiteDefinition `json:"cipher_suites,omitempty" yaml:"cipher_suites,omitempty"`
+	PayloadLengths      []uint16                    `json:"payload_lengths,omitempty" yaml:"payload_lengths,omitempty,flow"`
+	Limit               uint16                      `json:"limit,omitempty" yaml:"limit,omitempty"`
+	PaddingLength       int                         `json:"padding_length,omitempty" yaml:"padding_length,omitempty"`
+	BoringPadding       bool                        `json:"boring_padding,omitempty" yaml:"boring_padding,omitempty"`
+	OmitEmptyPsk        bool                        `json:"omit_empty_psk,omitempty" yaml:"omit_empty_psk,omitempty"`
+	Renegotiation       int                         `json:"renegotiation,omitempty" yaml:"renegotiation,omitempty"`
+}
+
+type keyShareDefinition struct {
+	Group string `json:"group" yaml:"group"`
+	Data  string `json:"data,omitempty" yaml:"data,omitempty"`
+}
+
+type hpkeCipherSuiteDefinition struct {
+	KDF  string `json:"kdf" yaml:"kdf"`
+	AEAD string `json:"aead" yaml:"aead"`
+}
+
+type http2Definition struct {
+	Settings          map[string]uint32        `json:"settings" yaml:"settings"`
+	SettingsOrder     []string                 `json:"settings_order" yaml:"settings_order"`
+	ConnectionFlow    uint32                   `json:"connection_flow" yaml:"connection_flow"`
+	HeaderPriority    *priorityParamDefinition `json:"header_priority,omitempty" yaml:"header_priority,omitempty"`
+	Priorities        []priorityDefinition     `json:"priorities,omitempty" yaml:"priorities,omitempty"`
+	PseudoHeaderOrder []string                 `json:"pseudo_header_order" yaml:"pseudo_header_order"`
+	StreamID          uint32                   `json:"stream_id,omitempty" yaml:"stream_id,omitempty"`
+	AllowHTTP         bool                     `json:"allow_http,omitempty" yaml:"allow_http,omitempty"`
+}
+
+// priorityParamDefinition mirrors http2.PriorityParam. The weight is the wire value, which is the actual weight minus one.
+type priorityParamDefinition struct {
+	StreamDep uint32 `json:"stream_dep" yaml:"stream_dep"`
+	Exclusive bool   `json:"exclusive" yaml:"exclusive"`
+	Weight    uint8  `json:"weight" yaml:"weight"`
+}
+
+type priorityDefinition struct {
+	StreamID                uint32 `json:"stream_id" yaml:"stream_id"`
+	priorityParamDefinition `yaml:",inline"`
+}
+
+type http3Definition struct {
+	Settings          map[string]uint64 `json:"settings,omitempty" yaml:"settings,omitempty"`
+	SettingsOrder     []string          `json:"settings_order,omitempty" yaml:"settings_order,omitempty"`
+	PriorityParam     uint32            `json:"priority_param,omitempty" yaml:"priority_param,omitempty"`
+	PseudoHeaderOrder []string          `json:"pseudo_header_order,omitempty" yaml:"pseudo_header_order,omitempty"`
+	SendGreaseFrames  bool              `json:"send_grease_frames,omitempty" yaml:"send_grease_frames,omitempty"`
+}
+
+// LoadProfile reads a ClientProfile definition in JSON or YAML format.
+// The format is the one produced by ClientProfile.MarshalJSON and ClientProfile.MarshalYAML.
+// The ClientHelloSpec of the returned profile is rebuilt from the definition on every handshake.
+func LoadProfile(r io.Reader) (ClientProfile, error) {
+	var definition profileDefinition
+
+	// every JSON document is a valid YAML document, therefore the YAML decoder handles both formats
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&definition); err != nil {
+		return ClientProfile{}, fmt.Errorf("failed to decode profile: %w", err)
+	}
+
+	return definition.toClientProfile()
+}
+
+// MarshalJSON serializes the profile into the format understood by LoadProfile.
+func (c ClientProfile) MarshalJSON() ([]byte, error) {
+	definition, err := newProfileDefinition(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(definition)
+}
+
+// UnmarshalJSON is the counterpart of MarshalJSON.
+func (c *ClientProfile) UnmarshalJSON(data []byte) error {
+	var definition profileDefinition
+	if err := json.Unmarshal(data, &definition); err != nil {
+		return err
+	}
+
+	profile, err := definition.toClientProfile()
+	if err != nil {
+		return err
+	}
+
+	*c = profile
+
+	return nil
+}
+
+// MarshalYAML serializes the profile into the YAML variant of the format understood by LoadProfile.
+func (c ClientProfile) MarshalYAML() (interface{}, error) {
+	return newProfileDefinition(c)
+}
+
+func newProfileDefinition(c ClientProfile) (*profileDefinition, error) {
+	spec, err := c.GetClientHelloSpec()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client hello spec: %w", err)
+	}
+
+	clientHello, err := newClientHelloDefinition(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	definition := &profileDefinition{
+		Client:  c.clientHelloId.Client,
+		Version: c.clientHelloId.Version,
+		TLS:     clientHello,
+		HTTP2: http2Definition{
+			Settings:          make(map[string]uint32, len(c.settings)),
+			ConnectionFlow:    c.connectionFlow,
+			PseudoHeaderOrder: c.pseudoHeaderOrder,
+			StreamID:          c.streamID,
+			AllowHTTP:         c.allowHTTP,
+		},
+	}
+
+	for id, value := range c.settings {
+		definition.HTTP2.Settings[id.String()] = value
+	}
+
+	for _, id := range c.settingsOrder {
+		definition.HTTP2.SettingsOrder = append(definition.HTTP2.SettingsOrder, id.String())
+	}
+
+	if c.headerPriority != nil {
+		definition.HTTP2.HeaderPriority = newPriorityParamDefinition(*c.headerPriority)
+	}
+
+	for _, priority := range c.priorities {
+		definition.HTTP2.Priorities = append(definition.HTTP2.Priorities, priorityDefinition{
+			StreamID:                priority.StreamID,
+			priorityParamDefinition: *newPriorityParamDefinition(priority.PriorityParam),
+		})
+	}
+
+	if len(c.http3Settings) > 0 || len(c.http3SettingsOrder) > 0 || len(c.http3PseudoHeaderOrder) > 0 {
+		definition.HTTP3 = &http3Definition{
+			Settings:          make(map[string]uint64, len(c.http3Settings)),
+			PriorityParam:     c.http3PriorityParam,
+			PseudoHeaderOrder: c.http3PseudoHeaderOrder,
+			SendGreaseFrames:  c.http3SendGreaseFrames,
+		}
+
+		for id, value := range c.http3Settings {
+			definition.HTTP3.Settings[http3SettingName(id)] = value
+		}
+
+		for _, id := range c.http3SettingsOrder {
+			definition.HTTP3.SettingsOrder = append(definition.HTTP3.SettingsOrder, http3SettingName(id))
+		}
+	}
+
+	return definition, nil
+}
+
+func (d profileDefinition) toClientProfile() (ClientProfile, error) {
+	// the spec is built once to validate the definition, the factory builds a fresh spec for every connection
+	if _, err := d.TLS.toClientHelloSpec(); err != nil {
+		return ClientProfile{}, err
+	}
+
+	clientHello := d.TLS
+	clientHelloId := tls.ClientHelloID{
+		Client:      d.Client,
+		Version:     d.Version,
+		SpecFactory: clientHello.toClientHelloSpec,
+	}
+
+	settings := make(map[http2.SettingID]uint32, len(d.HTTP2.Settings))
+	for name, value := range d.HTTP2.Settings {
+		id, err := parseHTTP2SettingName(name)
+		if err != nil {
+			return ClientProfile{}, err
+		}
+
+		settings[id] = value
+	}
+
+	var settingsOrder []http2.SettingID
+	for _, name := range d.HTTP2.SettingsOrder {
+		id, err := parseHTTP2SettingName(name)
+		if err != nil {
+			return ClientProfile{}, err
+		}
+
+		settingsOrder = append(settingsOrder, id)
+	}
+
+	var headerPriority *http2.PriorityParam
+	if d.HTTP2.HeaderPriority != nil {
+		priorityParam := d.HTTP2.HeaderPriority.toPriorityParam()
+		headerPriority = &priorityParam
+	}
+
+	var priorities []http2.Priority
+	for _, priority := range d.HTTP2.Priorities {
+		priorities = append(priorities, http2.Priority{
+			StreamID:      priority.StreamID,
+			PriorityParam: priority.toPriorityParam(),
+		})
+	}
+
+	var http3Settings map[uint64]uint64
+	var http3SettingsOrder []uint64
+	var http3PriorityParam uint32
+	var http3PseudoHeaderOrder []string
+	var http3SendGreaseFrames bool
+
+	if d.HTTP3 != nil {
+		http3Settings = make(map[uint64]uint64, len(d.HTTP3.Settings))
+		for name, value := range d.HTTP3.Settings {
+			id, err := parseHTTP3SettingName(name)
+			if err != nil {
+				return ClientProfile{}, err
+			}
+
+			http3Settings[id] = value
+		}
+
+		for _, name := range d.HTTP3.SettingsOrder {
+			id, err := parseHTTP3SettingName(name)
+			if err != nil {
+				return ClientProfile{}, err
+			}
+
+			http3SettingsOrder = append(http3SettingsOrder, id)
+		}
+
+		http3PriorityParam = d.HTTP3.PriorityParam
+		http3PseudoHeaderOrder = d.HTTP3.PseudoHeaderOrder
+		http3SendGreaseFrames = d.HTTP3.SendGreaseFrames
+	}
+
+	return NewClientProfile(clientHelloId, settings, settingsOrder, d.HTTP2.PseudoHeaderOrder, d.HTTP2.ConnectionFlow, priorities, headerPriority, d.HTTP2.StreamID, d.HTTP2.AllowHTTP, http3Settings, http3SettingsOrder, http3PriorityParam, http3PseudoHeaderOrder, http3SendGreaseFrames), nil
+}
+
+func newClientHelloDefinition(spec tls.ClientHelloSpec) (clientHelloDefinition, error) {
+	definition := clientHelloDefinition{
+		CompressionMethods: widen(spec.CompressionMethods),
+	}
+
+	if spec.TLSVersMin != 0 {
+		definition.MinVersion = nameOf(tlsVersionNames, spec.TLSVersMin)
+	}
+
+	if spec.TLSVersMax != 0 {
+		definition.MaxVersion = nameOf(tlsVersionNames, spec.TLSVersMax)
+	}
+
+	for _, cipherSuite := range spec.CipherSuites {
+		definition.CipherSuites = append(definition.CipherSuites, nameOf(dicttls.DictCipherSuiteValueIndexed, cipherSuite))
+	}
+
+	for _, extension := range spec.Extensions {
+		extensionDefinition, err := newExtensionDefinition(extension)
+		if err != nil {
+			return clientHelloDefinition{}, err
+		}
+
+		definition.Extensions = append(definition.Extensions, extensionDefinition)
+	}
+
+	return definition, nil
+}
+
+func (d clientHelloDefinition) toClientHelloSpec() (tls.ClientHelloSpec, error) {
+	spec := tls.ClientHelloSpec{
+		CompressionMethods: narrow(d.CompressionMethods),
+	}
+
+	if len(spec.CompressionMethods) == 0 {
+		spec.CompressionMethods = []uint8{tls.CompressionNone}
+	}
+
+	var err error
+
+	if d.MinVersion != "" {
+		if spec.TLSVersMin, err = valueOf(tlsVersionNames, d.MinVersion); err != nil {
+			return tls.ClientHelloSpec{}, fmt.Errorf("invalid min version: %w", err)
+		}
+	}
+
+	if d.MaxVersion != "" {
+		if spec.TLSVersMax, err = valueOf(tlsVersionNames, d.MaxVersion); err != nil {
+			return tls.ClientHelloSpec{}, fmt.Errorf("invalid max version: %w", err)
+		}
+	}
+
+	if spec.CipherSuites, err = valuesOf(dicttls.DictCipherSuiteValueIndexed, d.CipherSuites); err != nil {
+		return tls.ClientHelloSpec{}, fmt.Errorf("invalid cipher suite: %w", err)
+	}
+
+	for _, extensionDefinition := range d.Extensions {
+		extension, err := extensionDefinition.toExtension()
+		if err != nil {
+			return tls.ClientHelloSpec{}, fmt.Errorf("invalid extension %s: %w", extensionDefinition.Name, err)
+		}
+
+		spec.Extensions = append(spec.Extensions, extension)
+	}
+
+	return spec, nil
+}
+
+func newExtensionDefinition(extension tls.TLSExtension) (extensionDefinition, error) {
+	switch e := extension.(type) {
+	case *tls.UtlsGREASEExtension:
+		return extensionDefinition{Name: extensionNameGREASE, Data: hex.EncodeToString(e.Body)}, nil
+	case *tls.SNIExtension:
+		return extensionDefinition{Name: extensionNameServerName}, nil
+	case *tls.StatusRequestExtension:
+		return extensionDefinition{Name: extensionNameStatusRequest}, nil
+	case *tls.SupportedCurvesExtension:
+		definition := extensionDefinition{Name: extensionNameSupportedGroups}
+		for _, curve := range e.Curves {
+			definition.Groups = append(definition.Groups, nameOf(supportedGroupNames, uint16(curve)))
+		}
+
+		return definition, nil
+	case *tls.SupportedPointsExtension:
+		return extensionDefinition{Name: extensionNamePointFormats, PointFormats: widen(e.SupportedPoints)}, nil
+	case *tls.SignatureAlgorithmsExtension:
+		return extensionDefinition{Name: extensionNameSignatureAlgorithms, SignatureAlgorithms: signatureSchemeNames(e.SupportedSignatureAlgorithms)}, nil
+	case *tls.ALPNExtension:
+		return extensionDefinition{Name: extensionNameALPN, Protocols: e.AlpnProtocols}, nil
+	case *tls.SCTExtension:
+		return extensionDefinition{Name: extensionNameSCT}, nil
+	case *tls.UtlsPaddingExtension:
+		return extensionDefinition{Name: extensionNamePadding, PaddingLength: e.PaddingLen, BoringPadding: e.GetPaddingLen != nil}, nil
+	case *tls.ExtendedMasterSecretExtension:
+		return extensionDefinition{Name: extensionNameExtendedMasterSecret}, nil
+	case *tls.UtlsCompressCertExtension:
+		definition := extensionDefinition{Name: extensionNameCompressCertificate}
+		for _, algorithm := range e.Algorithms {
+			definition.Algorithms = append(definition.Algorithms, nameOf(dicttls.DictCertificateCompressionAlgorithmValueIndexed, uint16(algorithm)))
+		}
+
+		return definition, nil
+	case *tls.FakeRecordSizeLimitExtension:
+		return extensionDefinition{Name: extensionNameRecordSizeLimit, Limit: e.Limit}, nil
+	case *tls.FakeDelegatedCredentialsExtension:
+		return extensionDefinition{Name: extensionNameDelegatedCredentials, SignatureAlgorithms: signatureSchemeNames(e.SupportedSignatureAlgorithms)}, nil
+	case *tls.SessionTicketExtension:
+		return extensionDefinition{Name: extensionNameSessionTicket}, nil
+	case *tls.UtlsPreSharedKeyExtension:
+		return extensionDefinition{Name: extensionNamePreSharedKey, OmitEmptyPsk: e.OmitEmptyPsk}, nil
+	case *tls.SupportedVersionsExtension:
+		definition := extensionDefinition{Name: extensionNameSupportedVersions}
+		for _, version := range e.Versions {
+			definition.Versions = append(definition.Versions, nameOf(tlsVersionNames, version))
+		}
+
+		return definition, nil
+	case *tls.PSKKeyExchangeModesExtension:
+		return extensionDefinition{Name: extensionNamePSKKeyExchangeModes, Modes: widen(e.Modes)}, nil
+	case *tls.KeyShareExtension:
+		definition := extensionDefinition{Name: extensionNameKeyShare}
+		for _, keyShare := range e.KeyShares {
+			definition.KeyShares = append(definition.KeyShares, keyShareDefinition{
+				Group: nameOf(supportedGroupNames, uint16(keyShare.Group)),
+				Data:  hex.EncodeToString(keyShare.Data),
+			})
+		}
+
+		return definition, nil
+	case *tls.ApplicationSettingsExtension:
+		return extensionDefinition{Name: extensionNameApplicationSettings, Protocols: e.SupportedProtocols}, nil
+	case *tls.ApplicationSettingsExtensionNew:
+		return extensionDefinition{Name: extensionNameApplicationSettingsNew, Protocols: e.SupportedProtocols}, nil
+	case *tls.GREASEEncryptedClientHelloExtension:
+		definition := extensionDefinition{Name: extensionNameGREASEECH, PayloadLengths: e.CandidatePayloadLens}
+		for _, cipherSuite := range e.CandidateCipherSuites {
+			definition.CipherSuites = append(definition.CipherSuites, hpkeCipherSuiteDefinition{
+				KDF:  nameOf(dicttls.DictKDFIdentifierValueIndexed, cipherSuite.KdfId),
+				AEAD: nameOf(dicttls.DictAEADIdentifierValueIndexed, cipherSuite.AeadId),
+			})
+		}
+
+		return definition, nil
+	case *tls.RenegotiationInfoExtension:
+		return extensionDefinition{Name: extensionNameRenegotiationInfo, Renegotiation: int(e.Renegotiation)}, nil
+	case *tls.GenericExtension:
+		return extensionDefinition{Name: extensionNameGeneric, ID: e.Id, Data: hex.EncodeToString(e.Data)}, nil
+	}
+
+	// extensions without state can be stored with their raw payload
+	raw := make([]byte, extension.Len())
+	if _, err := extension.Read(raw); err != nil && !errors.Is(err, io.EOF) {
+		return extensionDefinition{}, fmt.Errorf("%w: %T", ErrUnsupportedExtension, extension)
+	}
+
+	if len(raw) < 4 {
+		return extensionDefinition{}, fmt.Errorf("%w: %T", ErrUnsupportedExtension, extension)
+	}
+
+	return extensionDefinition{
+		Name: extensionNameGeneric,
+		ID:   uint16(raw[0])<<8 | uint16(raw[1]),
+		Data: hex.EncodeToString(raw[4:]),
+	}, nil
+}
+
+func (d extensionDefinition) toExtension() (tls.TLSExtension, error) {
+	switch d.Name {
+	case extensionNameGREASE:
+		body, err := hex.DecodeString(d.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.UtlsGREASEExtension{Body: body}, nil
+	case extensionNameServerName:
+		return &tls.SNIExtension{}, nil
+	case extensionNameStatusRequest:
+		return &tls.StatusRequestExtension{}, nil
+	case extensionNameSupportedGroups:
+		groups, err := valuesOf(supportedGroupNames, d.Groups)
+		if err != nil {
+			return nil, err
+		}
+
+		curves := make([]tls.CurveID, 0, len(groups))
+		for _, group := range groups {
+			curves = append(curves, tls.CurveID(group))
+		}
+
+		return &tls.SupportedCurvesExtension{Curves: curves}, nil
+	case extensionNamePointFormats:
+		return &tls.SupportedPointsExtension{SupportedPoints: narrow(d.PointFormats)}, nil
+	case extensionNameSignatureAlgorithms:
+		signatureAlgorithms, err := signatureSchemeValues(d.SignatureAlgorithms)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: signatureAlgorithms}, nil
+	case extensionNameALPN:
+		return &tls.ALPNExtension{AlpnProtocols: d.Protocols}, nil
+	case extensionNameSCT:
+		return &tls.SCTExtension{}, nil
+	case extensionNamePadding:
+		if d.BoringPadding {
+			return &tls.UtlsPaddingExtension{GetPaddingLen: tls.BoringPaddingStyle}, nil
+		}
+
+		return &tls.UtlsPaddingExtension{PaddingLen: d.PaddingLength, WillPad: d.PaddingLength > 0}, nil
+	case extensionNameExtendedMasterSecret:
+		return &tls.ExtendedMasterSecretExtension{}, nil
+	case extensionNameCompressCertificate:
+		values, err := valuesOf(dicttls.DictCertificateCompressionAlgorithmValueIndexed, d.Algorithms)
+		if err != nil {
+			return nil, err
+		}
+
+		algorithms := make([]tls.CertCompressionAlgo, 0, len(values))
+		for _, value := range values {
+			algorithms = append(algorithms, tls.CertCompressionAlgo(value))
+		}
+
+		return &tls.UtlsCompressCertExtension{Algorithms: algorithms}, nil
+	case extensionNameRecordSizeLimit:
+		return &tls.FakeRecordSizeLimitExtension{Limit: d.Limit}, nil
+	case extensionNameDelegatedCredentials:
+		signatureAlgorithms, err := signatureSchemeValues(d.SignatureAlgorithms)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.DelegatedCredentialsExtension{SupportedSignatureAlgorithms: signatureAlgorithms}, nil
+	case extensionNameSessionTicket:
+		return &tls.SessionTicketExtension{}, nil
+	case extensionNamePreSharedKey:
+		return &tls.UtlsPreSharedKeyExtension{OmitEmptyPsk: d.OmitEmptyPsk}, nil
+	case extensionNameSupportedVersions:
+		versions, err := valuesOf(tlsVersionNames, d.Versions)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.SupportedVersionsExtension{Versions: versions}, nil
+	case extensionNamePSKKeyExchangeModes:
+		return &tls.PSKKeyExchangeModesExtension{Modes: narrow(d.Modes)}, nil
+	case extensionNameKeyShare:
+		keyShares := make([]tls.KeyShare, 0, len(d.KeyShares))
+		for _, keyShare := range d.KeyShares {
+			group, err := valueOf(supportedGroupNames, keyShare.Group)
+			if err != nil {
+				return nil, err
+			}
+
+			data, err := hex.DecodeString(keyShare.Data)
+			if err != nil {
+				return nil, err
+			}
+
+			keyShares = append(keyShares, tls.KeyShare{Group: tls.CurveID(group), Data: data})
+		}
+
+		return &tls.KeyShareExtension{KeyShares: keyShares}, nil
+	case extensionNameApplicationSettings:
+		return &tls.ApplicationSettingsExtension{SupportedProtocols: d.Protocols}, nil
+	case extensionNameApplicationSettingsNew:
+		return &tls.ApplicationSettingsExtensionNew{SupportedProtocols: d.Protocols}, nil
+	case extensionNameGREASEECH:
+		cipherSuites := make([]tls.HPKESymmetricCipherSuite, 0, len(d.CipherSuites))
+		for _, cipherSuite := range d.CipherSuites {
+			kdf, err := valueOf(dicttls.DictKDFIdentifierValueIndexed, cipherSuite.KDF)
+			if err != nil {
+				return nil, err
+			}
+
+			aead, err := valueOf(dicttls.DictAEADIdentifierValueIndexed, cipherSuite.AEAD)
+			if err != nil {
+				return nil, err
+			}
+
+			cipherSuites = append(cipherSuites, tls.HPKESymmetricCipherSuite{KdfId: kdf, AeadId: aead})
+		}
+
+		return &tls.GREASEEncryptedClientHelloExtension{CandidateCipherSuites: cipherSuites, CandidatePayloadLens: d.PayloadLengths}, nil
+	case extensionNameRenegotiationInfo:
+		return &tls.RenegotiationInfoExtension{Renegotiation: tls.RenegotiationSupport(d.Renegotiation)}, nil
+	case extensionNameGeneric:
+		data, err := hex.DecodeString(d.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.GenericExtension{Id: d.ID, Data: data}, nil
+	default:
+		return nil, fmt.Errorf("unknown extension name %q", d.Name)
+	}
+}
+
+func newPriorityParamDefinition(priorityParam http2.PriorityParam) *priorityParamDefinition {
+	return &priorityParamDefinition{
+		StreamDep: priorityParam.StreamDep,
+		Exclusive: priorityParam.Exclusive,
+		Weight:    priorityParam.Weight,
+	}
+}
+
+func (d priorityParamDefinition) toPriorityParam() http2.PriorityParam {
+	return http2.PriorityParam{
+		StreamDep: d.StreamDep,
+		Exclusive: d.Exclusive,
+		Weight:    d.Weight,
+	}
+}
+
+func parseHTTP2SettingName(name string) (http2.SettingID, error) {
+	for id := http2.SettingID(1); id <= http2.SettingNoRFC7540Priorities; id++ {
+		if id.String() == name {
+			return id, nil
+		}
+	}
+
+	var id uint16
+	if _, err := fmt.Sscanf(name, unknownSettingF, &id); err != nil {
+		return 0, fmt.Errorf("unknown http2 setting %q", name)
+	}
+
+	return http2.SettingID(id), nil
+}
+
+func http3SettingName(id uint64) string {
+	if name, ok := http3SettingNames[id]; ok {
+		return name
+	}
+
+	return strconv.FormatUint(id, 10)
+}
+
+func parseHTTP3SettingName(name string) (uint64, error) {
+	for id, settingName := range http3SettingNames {
+		if settingName == name {
+			return id, nil
+		}
+	}
+
+	id, err := strconv.ParseUint(name, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unknown http3 setting %q", name)
+	}
+
+	return id, nil
+}
+
+func signatureSchemeNames(schemes []tls.SignatureScheme) []string {
+	names := make([]string, 0, len(schemes))
+	for _, scheme := range schemes {
+		names = append(names, nameOf(dicttls.DictSignatureSchemeValueIndexed, uint16(scheme)))
+	}
+
+	return names
+}
+
+func signatureSchemeValues(names []string) ([]tls.SignatureScheme, error) {
+	values, err := valuesOf(dicttls.DictSignatureSchemeValueIndexed, names)
+	if err != nil {
+		return nil, err
+	}
+
+	schemes := make([]tls.SignatureScheme, 0, len(values))
+	for _, value := range values {
+		schemes = append(schemes, tls.SignatureScheme(value))
+	}
+
+	return schemes, nil
+}
+
+// nameOf returns the name of the value, "GREASE" for grease values or the hex representation for unknown values.
+func nameOf(names map[uint16]string, value uint16) string {
+	if IsGreaseValue(value) {
+		return greaseName
+	}
+
+	if name, ok := names[value]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("0x%04x", value)
+}
+
+// valueOf is the counterpart of nameOf.
+func valueOf(names map[uint16]string, name string) (uint16, error) {
+	if name == greaseName {
+		return tls.GREASE_PLACEHOLDER, nil
+	}
+
+	for value, candidate := range names {
+		if candidate == name {
+			return value, nil
+		}
+	}
+
+	if strings.HasPrefix(name, "0x") {
+		value, err := strconv.ParseUint(name[2:], 16, 16)
+		if err == nil {
+			return uint16(value), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown value %q", name)
+}
+
+func valuesOf(names map[uint16]string, values []string) ([]uint16, error) {
+	result := make([]uint16, 0, len(values))
+
+	for _, name := range values {
+		value, err := valueOf(names, name)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, value)
+	}
+
+	return result, nil
+}
+
+func mergeNames(maps ...map[uint16]string) map[uint16]string {
+	merged := make(map[uint16]string)
+
+	for _, names := range maps {
+		for value, name := range names {
+			merged[value] = name
+		}
+	}
+
+	return merged
+}
+
+// widen converts byte lists so that they are serialized as numbers instead of base64.
+func widen(values []uint8) []uint16 {
+	if values == nil {
+		return nil
+	}
+
+	result := make([]uint16, 0, len(values))
+	for _, value := range values {
+		result = append(result, uint16(value))
+	}
+
+	return result
+}
+
+func narrow(values []uint16) []uint8 {
+	if values == nil {
+		return nil
+	}
+
+	result := make([]uint8, 0, len(values))
+	for _, value := range values {
+		result = append(result, uint8(value))
+	}
+
+	return result
+}
@@ -0,0 +1,497 @@
+package profiles
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bogdanfinn/fhttp/http2"
+	tls "github.com/bogdanfinn/utls"
+	"github.com/bogdanfinn/utls/dicttls"
+)
+
+// the identifiers are used to write the constants like the profiles in this package do. Unknown values are written as number.
+var (
+	cipherSuiteIdentifiers = func() map[uint16]string {
+		identifiers := map[uint16]string{
+			tls.GREASE_PLACEHOLDER: "tls.GREASE_PLACEHOLDER",
+		}
+
+		for _, cipherSuite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			identifiers[cipherSuite.ID] = "tls." + cipherSuite.Name
+		}
+
+		return identifiers
+	}()
+
+	curveIdentifiers = map[uint16]string{
+		tls.GREASE_PLACEHOLDER:            "tls.GREASE_PLACEHOLDER",
+		uint16(tls.X25519):                "tls.X25519",
+		uint16(tls.CurveP256):             "tls.CurveP256",
+		uint16(tls.CurveP384):             "tls.CurveP384",
+		uint16(tls.CurveP521):             "tls.CurveP521",
+		uint16(tls.X25519MLKEM768):        "tls.X25519MLKEM768",
+		uint16(tls.X25519Kyber768Draft00): "tls.X25519Kyber768Draft00",
+		uint16(tls.FAKEFFDHE2048):         "tls.FAKEFFDHE2048",
+		uint16(tls.FAKEFFDHE3072):         "tls.FAKEFFDHE3072",
+	}
+
+	signatureSchemeIdentifiers = map[uint16]string{
+		uint16(tls.ECDSAWithP256AndSHA256): "tls.ECDSAWithP256AndSHA256",
+		uint16(tls.ECDSAWithP384AndSHA384): "tls.ECDSAWithP384AndSHA384",
+		uint16(tls.ECDSAWithP521AndSHA512): "tls.ECDSAWithP521AndSHA512",
+		uint16(tls.PSSWithSHA256):          "tls.PSSWithSHA256",
+		uint16(tls.PSSWithSHA384):          "tls.PSSWithSHA384",
+		uint16(tls.PSSWithSHA512):          "tls.PSSWithSHA512",
+		uint16(tls.PKCS1WithSHA256):        "tls.PKCS1WithSHA256",
+		uint16(tls.PKCS1WithSHA384):        "tls.PKCS1WithSHA384",
+		uint16(tls.PKCS1WithSHA512):        "tls.PKCS1WithSHA512",
+		uint16(tls.PKCS1WithSHA1):          "tls.PKCS1WithSHA1",
+		uint16(tls.ECDSAWithSHA1):          "tls.ECDSAWithSHA1",
+		uint16(tls.Ed25519):                "tls.Ed25519",
+	}
+
+	versionIdentifiers = map[uint16]string{
+		tls.GREASE_PLACEHOLDER: "tls.GREASE_PLACEHOLDER",
+		tls.VersionTLS13:       "tls.VersionTLS13",
+		tls.VersionTLS12:       "tls.VersionTLS12",
+		tls.VersionTLS11:       "tls.VersionTLS11",
+		tls.VersionTLS10:       "tls.VersionTLS10",
+	}
+
+	certCompressionIdentifiers = map[uint16]string{
+		uint16(tls.CertCompressionZlib):   "tls.CertCompressionZlib",
+		uint16(tls.CertCompressionBrotli): "tls.CertCompressionBrotli",
+		uint16(tls.CertCompressionZstd):   "tls.CertCompressionZstd",
+	}
+
+	pointFormatIdentifiers = map[uint16]string{
+		uint16(tls.PointFormatUncompressed): "tls.PointFormatUncompressed",
+	}
+
+	pskModeIdentifiers = map[uint16]string{
+		uint16(tls.PskModeDHE):   "tls.PskModeDHE",
+		uint16(tls.PskModePlain): "tls.PskModePlain",
+	}
+
+	compressionMethodIdentifiers = map[uint16]string{
+		uint16(tls.CompressionNone): "tls.CompressionNone",
+	}
+
+	renegotiationIdentifiers = map[tls.RenegotiationSupport]string{
+		tls.RenegotiateNever:          "tls.RenegotiateNever",
+		tls.RenegotiateOnceAsClient:   "tls.RenegotiateOnceAsClient",
+		tls.RenegotiateFreelyAsClient: "tls.RenegotiateFreelyAsClient",
+	}
+
+	kdfIdentifiers = map[uint16]string{
+		dicttls.HKDF_SHA256: "dicttls.HKDF_SHA256",
+		dicttls.HKDF_SHA384: "dicttls.HKDF_SHA384",
+		dicttls.HKDF_SHA512: "dicttls.HKDF_SHA512",
+	}
+
+	aeadIdentifiers = map[uint16]string{
+		dicttls.AEAD_AES_128_GCM:       "dicttls.AEAD_AES_128_GCM",
+		dicttls.AEAD_AES_256_GCM:       "dicttls.AEAD_AES_256_GCM",
+		dicttls.AEAD_CHACHA20_POLY1305: "dicttls.AEAD_CHACHA20_POLY1305",
+	}
+
+	http2SettingIdentifiers = map[http2.SettingID]string{
+		http2.SettingHeaderTableSize:       "http2.SettingHeaderTableSize",
+		http2.SettingEnablePush:            "http2.SettingEnablePush",
+		http2.SettingMaxConcurrentStreams:  "http2.SettingMaxConcurrentStreams",
+		http2.SettingInitialWindowSize:     "http2.SettingInitialWindowSize",
+		http2.SettingMaxFrameSize:          "http2.SettingMaxFrameSize",
+		http2.SettingMaxHeaderListSize:     "http2.SettingMaxHeaderListSize",
+		http2.SettingEnableConnectProtocol: "http2.SettingEnableConnectProtocol",
+		http2.SettingNoRFC7540Priorities:   "http2.SettingNoRFC7540Priorities",
+	}
+)
+
+// WriteProfileSource writes the Go source of a ClientProfile variable declaration in the style of the profiles of this package,
+// for example to add a captured profile to a code base. The generated code uses the unexported fields of ClientProfile,
+// therefore it has to be placed in this package.
+func WriteProfileSource(w io.Writer, variableName string, profile ClientProfile) error {
+	if !token.IsIdentifier(variableName) {
+		return fmt.Errorf("invalid variable name %q", variableName)
+	}
+
+	spec, err := profile.GetClientHelloSpec()
+	if err != nil {
+		return fmt.Errorf("failed to get client hello spec: %w", err)
+	}
+
+	s := &sourceWriter{}
+	s.printf("var %s = ClientProfile{\n", variableName)
+	s.printf("clientHelloId: tls.ClientHelloID{\n")
+	s.printf("Client: %s,\n", strconv.Quote(profile.clientHelloId.Client))
+	s.printf("RandomExtensionOrder: %t,\n", profile.clientHelloId.RandomExtensionOrder)
+	s.printf("Version: %s,\n", strconv.Quote(profile.clientHelloId.Version))
+	s.printf("Seed: nil,\n")
+	s.printf("SpecFactory: func() (tls.ClientHelloSpec, error) {\n")
+	s.printf("return tls.ClientHelloSpec{\n")
+
+	if spec.TLSVersMin != 0 {
+		s.printf("TLSVersMin: %s,\n", identifierOf(versionIdentifiers, spec.TLSVersMin))
+	}
+
+	if spec.TLSVersMax != 0 {
+		s.printf("TLSVersMax: %s,\n", identifierOf(versionIdentifiers, spec.TLSVersMax))
+	}
+
+	s.printf("CipherSuites: []uint16{\n")
+	s.list(cipherSuiteIdentifiers, spec.CipherSuites)
+	s.printf("},\n")
+	s.printf("CompressionMethods: []byte{\n")
+	s.list(compressionMethodIdentifiers, widen(spec.CompressionMethods))
+	s.printf("},\n")
+	s.printf("Extensions: []tls.TLSExtension{\n")
+
+	for _, extension := range spec.Extensions {
+		if err := s.extension(extension); err != nil {
+			return err
+		}
+	}
+
+	s.printf("},\n")
+	s.printf("}, nil\n")
+	s.printf("},\n")
+	s.printf("},\n")
+
+	if len(profile.settingsOrder) > 0 {
+		s.printf("settings: map[http2.SettingID]uint32{\n")
+		for _, id := range profile.settingsOrder {
+			s.printf("%s: %d,\n", http2SettingIdentifier(id), profile.settings[id])
+		}
+		s.printf("},\n")
+
+		s.printf("settingsOrder: []http2.SettingID{\n")
+		for _, id := range profile.settingsOrder {
+			s.printf("%s,\n", http2SettingIdentifier(id))
+		}
+		s.printf("},\n")
+	} else if len(profile.settings) > 0 {
+		ids := make([]http2.SettingID, 0, len(profile.settings))
+		for id := range profile.settings {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+
+		s.printf("settings: map[http2.SettingID]uint32{\n")
+		for _, id := range ids {
+			s.printf("%s: %d,\n", http2SettingIdentifier(id), profile.settings[id])
+		}
+		s.printf("},\n")
+	}
+
+	if len(profile.pseudoHeaderOrder) > 0 {
+		s.printf("pseudoHeaderOrder: []string{\n")
+		for _, pseudoHeader := range profile.pseudoHeaderOrder {
+			s.printf("%s,\n", strconv.Quote(pseudoHeader))
+		}
+		s.printf("},\n")
+	}
+
+	if profile.connectionFlow != 0 {
+		s.printf("connectionFlow: %d,\n", profile.connectionFlow)
+	}
+
+	if profile.headerPriority != nil {
+		s.printf("headerPriority: &http2.PriorityParam{\n")
+		s.priorityParam(*profile.headerPriority)
+		s.printf("},\n")
+	}
+
+	if len(profile.priorities) > 0 {
+		s.printf("priorities: []http2.Priority{\n")
+		for _, priority := range profile.priorities {
+			s.printf("{StreamID: %d, PriorityParam: http2.PriorityParam{\n", priority.StreamID)
+			s.priorityParam(priority.PriorityParam)
+			s.printf("}},\n")
+		}
+		s.printf("},\n")
+	}
+
+	if profile.streamID != 0 {
+		s.printf("streamID: %d,\n", profile.streamID)
+	}
+
+	if profile.allowHTTP {
+		s.printf("allowHTTP: true,\n")
+	}
+
+	if len(profile.http3Settings) > 0 {
+		// the settings without a value in the map are listed in the order only, like in the profiles of this package
+		ids := make([]uint64, 0, len(profile.http3Settings))
+		for _, id := range profile.http3SettingsOrder {
+			if _, ok := profile.http3Settings[id]; ok && !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+
+		var unordered []uint64
+		for id := range profile.http3Settings {
+			if !slices.Contains(ids, id) {
+				unordered = append(unordered, id)
+			}
+		}
+		slices.Sort(unordered)
+
+		s.printf("http3Settings: map[uint64]uint64{\n")
+		for _, id := range append(ids, unordered...) {
+			s.printf("0x%x: %d,%s\n", id, profile.http3Settings[id], http3SettingComment(id))
+		}
+		s.printf("},\n")
+	}
+
+	if len(profile.http3SettingsOrder) > 0 {
+		s.printf("http3SettingsOrder: []uint64{\n")
+		for _, id := range profile.http3SettingsOrder {
+			s.printf("0x%x,%s\n", id, http3SettingComment(id))
+		}
+		s.printf("},\n")
+	}
+
+	if profile.http3PriorityParam != 0 {
+		s.printf("http3PriorityParam: %d,\n", profile.http3PriorityParam)
+	}
+
+	if len(profile.http3PseudoHeaderOrder) > 0 {
+		s.printf("http3PseudoHeaderOrder: []string{\n")
+		s.strings(profile.http3PseudoHeaderOrder)
+		s.printf("},\n")
+	}
+
+	if profile.http3SendGreaseFrames {
+		s.printf("http3SendGreaseFrames: true,\n")
+	}
+
+	s.printf("}\n")
+
+	source, err := format.Source(s.buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format profile source: %w", err)
+	}
+
+	_, err = w.Write(source)
+
+	return err
+}
+
+type sourceWriter struct {
+	buf bytes.Buffer
+}
+
+func (s *sourceWriter) printf(format string, args ...any) {
+	fmt.Fprintf(&s.buf, format, args...)
+}
+
+func (s *sourceWriter) list(identifiers map[uint16]string, values []uint16) {
+	for _, value := range values {
+		s.printf("%s,\n", identifierOf(identifiers, value))
+	}
+}
+
+func (s *sourceWriter) strings(values []string) {
+	for _, value := range values {
+		s.printf("%s,\n", strconv.Quote(value))
+	}
+}
+
+func (s *sourceWriter) priorityParam(priorityParam http2.PriorityParam) {
+	s.printf("StreamDep: %d,\n", priorityParam.StreamDep)
+	s.printf("Exclusive: %t,\n", priorityParam.Exclusive)
+	s.printf("Weight: %d,\n", priorityParam.Weight)
+}
+
+func (s *sourceWriter) signatureAlgorithms(schemes []tls.SignatureScheme) {
+	for _, scheme := range schemes {
+		s.printf("%s,\n", identifierOf(signatureSchemeIdentifiers, uint16(scheme)))
+	}
+}
+
+func (s *sourceWriter) extension(extension tls.TLSExtension) error {
+	switch e := extension.(type) {
+	case *tls.UtlsGREASEExtension:
+		s.printf("&tls.UtlsGREASEExtension{},\n")
+	case *tls.SNIExtension:
+		s.printf("&tls.SNIExtension{},\n")
+	case *tls.StatusRequestExtension:
+		s.printf("&tls.StatusRequestExtension{},\n")
+	case *tls.SupportedCurvesExtension:
+		s.printf("&tls.SupportedCurvesExtension{Curves: []tls.CurveID{\n")
+		for _, curve := range e.Curves {
+			s.printf("%s,\n", identifierOf(curveIdentifiers, uint16(curve)))
+		}
+		s.printf("}},\n")
+	case *tls.SupportedPointsExtension:
+		s.printf("&tls.SupportedPointsExtension{SupportedPoints: []byte{\n")
+		s.list(pointFormatIdentifiers, widen(e.SupportedPoints))
+		s.printf("}},\n")
+	case *tls.SignatureAlgorithmsExtension:
+		s.printf("&tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{\n")
+		s.signatureAlgorithms(e.SupportedSignatureAlgorithms)
+		s.printf("}},\n")
+	case *tls.ALPNExtension:
+		s.printf("&tls.ALPNExtension{AlpnProtocols: []string{\n")
+		s.strings(e.AlpnProtocols)
+		s.printf("}},\n")
+	case *tls.SCTExtension:
+		s.printf("&tls.SCTExtension{},\n")
+	case *tls.UtlsPaddingExtension:
+		if e.GetPaddingLen != nil {
+			s.printf("&tls.UtlsPaddingExtension{GetPaddingLen: tls.BoringPaddingStyle},\n")
+		} else {
+			s.printf("&tls.UtlsPaddingExtension{PaddingLen: %d, WillPad: %t},\n", e.PaddingLen, e.WillPad)
+		}
+	case *tls.ExtendedMasterSecretExtension:
+		s.printf("&tls.ExtendedMasterSecretExtension{},\n")
+	case *tls.UtlsCompressCertExtension:
+		s.printf("&tls.UtlsCompressCertExtension{Algorithms: []tls.CertCompressionAlgo{\n")
+		for _, algorithm := range e.Algorithms {
+			s.printf("%s,\n", identifierOf(certCompressionIdentifiers, uint16(algorithm)))
+		}
+		s.printf("}},\n")
+	case *tls.FakeRecordSizeLimitExtension:
+		s.printf("&tls.FakeRecordSizeLimitExtension{Limit: 0x%04x},\n", e.Limit)
+	case *tls.DelegatedCredentialsExtension:
+		s.printf("&tls.DelegatedCredentialsExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{\n")
+		s.signatureAlgorithms(e.SupportedSignatureAlgorithms)
+		s.printf("}},\n")
+	case *tls.SessionTicketExtension:
+		s.printf("&tls.SessionTicketExtension{},\n")
+	case *tls.UtlsPreSharedKeyExtension:
+		s.printf("&tls.UtlsPreSharedKeyExtension{OmitEmptyPsk: %t},\n", e.OmitEmptyPsk)
+	case *tls.SupportedVersionsExtension:
+		s.printf("&tls.SupportedVersionsExtension{Versions: []uint16{\n")
+		s.list(versionIdentifiers, e.Versions)
+		s.printf("}},\n")
+	case *tls.PSKKeyExchangeModesExtension:
+		s.printf("&tls.PSKKeyExchangeModesExtension{Modes: []uint8{\n")
+		s.list(pskModeIdentifiers, widen(e.Modes))
+		s.printf("}},\n")
+	case *tls.KeyShareExtension:
+		s.printf("&tls.KeyShareExtension{KeyShares: []tls.KeyShare{\n")
+		for _, keyShare := range e.KeyShares {
+			if IsGreaseValue(uint16(keyShare.Group)) {
+				s.printf("{Group: tls.CurveID(tls.GREASE_PLACEHOLDER), Data: []byte{0}},\n")
+			} else {
+				s.printf("{Group: %s},\n", identifierOf(curveIdentifiers, uint16(keyShare.Group)))
+			}
+		}
+		s.printf("}},\n")
+	case *tls.ApplicationSettingsExtension:
+		s.printf("&tls.ApplicationSettingsExtension{\nSupportedProtocols: []string{%s},\n},\n", quoteAll(e.SupportedProtocols))
+	case *tls.ApplicationSettingsExtensionNew:
+		s.printf("&tls.ApplicationSettingsExtensionNew{\nSupportedProtocols: []string{%s},\n},\n", quoteAll(e.SupportedProtocols))
+	case *tls.GREASEEncryptedClientHelloExtension:
+		if isBoringGREASEECHConfig(e) {
+			s.printf("tls.BoringGREASEECH(),\n")
+			break
+		}
+
+		s.printf("&tls.GREASEEncryptedClientHelloExtension{\n")
+		s.printf("CandidateCipherSuites: []tls.HPKESymmetricCipherSuite{\n")
+		for _, cipherSuite := range e.CandidateCipherSuites {
+			s.printf("{\n")
+			s.printf("KdfId: %s,\n", identifierOf(kdfIdentifiers, cipherSuite.KdfId))
+			s.printf("AeadId: %s,\n", identifierOf(aeadIdentifiers, cipherSuite.AeadId))
+			s.printf("},\n")
+		}
+		s.printf("},\n")
+		s.printf("CandidatePayloadLens: []uint16{")
+		for i, payloadLength := range e.CandidatePayloadLens {
+			if i > 0 {
+				s.printf(", ")
+			}
+			s.printf("%d", payloadLength)
+		}
+		s.printf("},\n")
+		s.printf("},\n")
+	case *tls.RenegotiationInfoExtension:
+		renegotiation, ok := renegotiationIdentifiers[e.Renegotiation]
+		if !ok {
+			renegotiation = fmt.Sprintf("tls.RenegotiationSupport(%d)", e.Renegotiation)
+		}
+
+		s.printf("&tls.RenegotiationInfoExtension{\nRenegotiation: %s,\n},\n", renegotiation)
+	default:
+		// everything else is written with its raw payload like the serialization does
+		definition, err := newExtensionDefinition(extension)
+		if err != nil {
+			return err
+		}
+
+		if definition.Name != extensionNameGeneric {
+			return fmt.Errorf("%w: %T", ErrUnsupportedExtension, extension)
+		}
+
+		data, err := hex.DecodeString(definition.Data)
+		if err != nil {
+			return err
+		}
+
+		s.printf("&tls.GenericExtension{Id: 0x%04x, Data: %s},\n", definition.ID, byteSliceLiteral(data))
+	}
+
+	return nil
+}
+
+// isBoringGREASEECHConfig reports whether the extension has the configuration of tls.BoringGREASEECH.
+func isBoringGREASEECHConfig(extension *tls.GREASEEncryptedClientHelloExtension) bool {
+	boring := tls.BoringGREASEECH()
+
+	return slices.Equal(extension.CandidateCipherSuites, boring.CandidateCipherSuites) && slices.Equal(extension.CandidatePayloadLens, boring.CandidatePayloadLens)
+}
+
+func identifierOf(identifiers map[uint16]string, value uint16) string {
+	if IsGreaseValue(value) {
+		return "tls.GREASE_PLACEHOLDER"
+	}
+
+	if identifier, ok := identifiers[value]; ok {
+		return identifier
+	}
+
+	return fmt.Sprintf("0x%04x", value)
+}
+
+func http2SettingIdentifier(id http2.SettingID) string {
+	if identifier, ok := http2SettingIdentifiers[id]; ok {
+		return identifier
+	}
+
+	return fmt.Sprintf("http2.SettingID(%d)", id)
+}
+
+func http3SettingComment(id uint64) string {
+	if name, ok := http3SettingNames[id]; ok {
+		return " // SETTINGS_" + name
+	}
+
+	return ""
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, strconv.Quote(value))
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+func byteSliceLiteral(data []byte) string {
+	values := make([]string, 0, len(data))
+	for _, b := range data {
+		values = append(values, fmt.Sprintf("0x%02x", b))
+	}
+
+	return "[]byte{" + strings.Join(values, ", ") + "}"
+}
@@ -0,0 +1,300 @@
+package profiles
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bogdanfinn/fhttp/http2"
+	tls "github.com/bogdanfinn/utls"
+)
+
+// Severity classifies an Issue found by Validate.
+type Severity string
+
+const (
+	// SeverityError marks a profile which can not be sent by the browser it claims to be, or which breaks the handshake.
+	SeverityError Severity = "error"
+	// SeverityWarning marks a profile which works, but is unusual for the browser it claims to be.
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a single inconsistency of a ClientProfile.
+type Issue struct {
+	Severity Severity
+	// Check is a stable identifier of the check which found the issue, e.g. "h2-settings".
+	Check   string
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s [%s]: %s", i.Severity, i.Check, i.Message)
+}
+
+const (
+	maxHTTP2WindowSize      = 1<<31 - 1
+	minHTTP2MaxFrameSize    = 1 << 14
+	maxHTTP2MaxFrameSize    = 1<<24 - 1
+	pskProfileVersionSuffix = "PSK"
+)
+
+var http2PseudoHeaders = []string{":method", ":authority", ":scheme", ":path"}
+
+// http3TransportSettings are sent by the HTTP/3 transport itself, so they can be part of the settings order without a value.
+var http3TransportSettings = map[uint64]bool{
+	0x6:  true, // MAX_FIELD_SECTION_SIZE
+	0x33: true, // H3_DATAGRAM
+}
+
+// Validate checks the ClientHelloSpec of the profile against its HTTP/2 and HTTP/3 parameters and against invariants
+// every browser holds, for example that every key share group is advertised in the supported groups.
+// A profile without issues returns an empty slice.
+func Validate(profile ClientProfile) []Issue {
+	v := &validator{profile: profile}
+
+	spec, err := profile.GetClientHelloSpec()
+	if err != nil {
+		v.errorf("client-hello-spec", "failed to get client hello spec: %s", err)
+	} else {
+		v.validateClientHello(spec)
+	}
+
+	v.validateHTTP2(spec)
+	v.validateHTTP3(spec)
+
+	return v.issues
+}
+
+type validator struct {
+	profile ClientProfile
+	issues  []Issue
+}
+
+func (v *validator) errorf(check string, format string, args ...any) {
+	v.issues = append(v.issues, Issue{Severity: SeverityError, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(check string, format string, args ...any) {
+	v.issues = append(v.issues, Issue{Severity: SeverityWarning, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validateClientHello(spec tls.ClientHelloSpec) {
+	if len(spec.CipherSuites) == 0 {
+		v.errorf("cipher-suites", "no cipher suites")
+	}
+
+	seen := make(map[string]bool)
+	for i, extension := range spec.Extensions {
+		name := fmt.Sprintf("%T", extension)
+
+		switch extension.(type) {
+		case *tls.UtlsGREASEExtension:
+			// chrome sends two GREASE extensions
+		case *tls.UtlsPreSharedKeyExtension, *tls.FakePreSharedKeyExtension:
+			if i != len(spec.Extensions)-1 {
+				v.errorf("pre-shared-key", "pre shared key extension must be the last extension")
+			}
+		default:
+			if seen[name] {
+				v.errorf("duplicate-extension", "extension %s is sent more than once", name)
+			}
+		}
+
+		seen[name] = true
+	}
+
+	supportedGroups := supportedGroupsOf(spec)
+	keyShareGroups, hasKeyShare := keyShareGroupsOf(spec)
+	for _, group := range keyShareGroups {
+		if !IsGreaseValue(uint16(group)) && !slices.Contains(supportedGroups, group) {
+			v.errorf("key-share", "key share group %s is not part of the supported groups", nameOf(supportedGroupNames, uint16(group)))
+		}
+	}
+
+	supportsTLS13 := supportsTLS13(spec)
+	if supportsTLS13 && !hasKeyShare {
+		v.errorf("key-share", "tls 1.3 is supported without key share extension")
+	}
+
+	if !supportsTLS13 && hasKeyShare {
+		v.warnf("key-share", "key share extension is sent without tls 1.3 in the supported versions")
+	}
+
+	hasPreSharedKey := seen["*tls.UtlsPreSharedKeyExtension"] || seen["*tls.FakePreSharedKeyExtension"]
+	if hasPreSharedKey && !seen["*tls.PSKKeyExchangeModesExtension"] {
+		v.errorf("pre-shared-key", "pre shared key extension is sent without psk key exchange modes extension")
+	}
+
+	if strings.HasSuffix(v.profile.clientHelloId.Version, pskProfileVersionSuffix) && !hasPreSharedKey {
+		v.errorf("pre-shared-key", "profile version %s has no pre shared key extension", v.profile.clientHelloId.Version)
+	}
+
+	alpn := alpnProtocolsOf(spec)
+	for _, extension := range spec.Extensions {
+		var protocols []string
+		switch ext := extension.(type) {
+		case *tls.ApplicationSettingsExtension:
+			protocols = ext.SupportedProtocols
+		case *tls.ApplicationSettingsExtensionNew:
+			protocols = ext.SupportedProtocols
+		default:
+			continue
+		}
+
+		for _, protocol := range protocols {
+			if !slices.Contains(alpn, protocol) {
+				v.errorf("application-settings", "application settings protocol %q is not advertised in alpn", protocol)
+			}
+		}
+	}
+
+	hasGreaseExtension := seen["*tls.UtlsGREASEExtension"]
+	hasGreaseCipherSuite := len(spec.CipherSuites) > 0 && IsGreaseValue(spec.CipherSuites[0])
+	if hasGreaseExtension != hasGreaseCipherSuite {
+		v.warnf("grease", "GREASE is used inconsistently between cipher suites and extensions")
+	}
+
+	if chromiumClients[strings.ToLower(v.profile.clientHelloId.Client)] && !hasGreaseExtension {
+		v.warnf("grease", "chromium based profile without GREASE extension")
+	}
+}
+
+func (v *validator) validateHTTP2(spec tls.ClientHelloSpec) {
+	settings := v.profile.settings
+	advertisesH2 := slices.Contains(alpnProtocolsOf(spec), http2.NextProtoTLS)
+
+	if advertisesH2 && len(settings) == 0 {
+		v.errorf("h2-settings", "alpn advertises h2 but the profile has no http2 settings")
+	}
+
+	if advertisesH2 && len(v.profile.pseudoHeaderOrder) == 0 {
+		v.errorf("h2-pseudo-header-order", "alpn advertises h2 but the profile has no pseudo header order")
+	}
+
+	if len(alpnProtocolsOf(spec)) > 0 && !advertisesH2 && len(settings) > 0 {
+		v.warnf("h2-settings", "the profile has http2 settings but alpn does not advertise h2")
+	}
+
+	for _, id := range v.profile.settingsOrder {
+		if _, ok := settings[id]; !ok {
+			v.errorf("h2-settings", "settings order contains %s without value", id)
+		}
+	}
+
+	for id := range settings {
+		if len(v.profile.settingsOrder) > 0 && !slices.Contains(v.profile.settingsOrder, id) {
+			v.errorf("h2-settings", "setting %s is missing in the settings order", id)
+		}
+	}
+
+	if value, ok := settings[http2.SettingEnablePush]; ok && value > 1 {
+		v.errorf("h2-settings", "%s must be 0 or 1, got %d", http2.SettingEnablePush, value)
+	}
+
+	if value, ok := settings[http2.SettingInitialWindowSize]; ok && value > maxHTTP2WindowSize {
+		v.errorf("h2-settings", "%s exceeds the maximum window size, got %d", http2.SettingInitialWindowSize, value)
+	}
+
+	if value, ok := settings[http2.SettingMaxFrameSize]; ok && (value < minHTTP2MaxFrameSize || value > maxHTTP2MaxFrameSize) {
+		v.errorf("h2-settings", "%s must be between %d and %d, got %d", http2.SettingMaxFrameSize, minHTTP2MaxFrameSize, maxHTTP2MaxFrameSize, value)
+	}
+
+	if v.profile.connectionFlow > maxHTTP2WindowSize {
+		v.errorf("h2-connection-flow", "connection flow exceeds the maximum window size, got %d", v.profile.connectionFlow)
+	}
+
+	if len(v.profile.pseudoHeaderOrder) > 0 && !isPseudoHeaderPermutation(v.profile.pseudoHeaderOrder) {
+		v.errorf("h2-pseudo-header-order", "pseudo header order %v is not a permutation of %v", v.profile.pseudoHeaderOrder, http2PseudoHeaders)
+	}
+
+	if v.profile.streamID%2 == 0 && v.profile.streamID != 0 {
+		v.errorf("h2-stream-id", "client initiated streams must have an odd stream id, got %d", v.profile.streamID)
+	}
+
+	for _, priority := range v.profile.priorities {
+		if priority.StreamID == priority.PriorityParam.StreamDep {
+			v.errorf("h2-priorities", "stream %d depends on itself", priority.StreamID)
+		}
+	}
+}
+
+func (v *validator) validateHTTP3(spec tls.ClientHelloSpec) {
+	hasHTTP3 := len(v.profile.http3Settings) > 0 || len(v.profile.http3SettingsOrder) > 0 || len(v.profile.http3PseudoHeaderOrder) > 0
+	if !hasHTTP3 {
+		return
+	}
+
+	// the QUIC handshake is only defined for tls 1.3
+	if len(spec.Extensions) > 0 && !supportsTLS13(spec) {
+		v.errorf("h3-tls-version", "the profile has http3 settings but does not support tls 1.3 which is required by QUIC")
+	}
+
+	for _, id := range v.profile.http3SettingsOrder {
+		if _, ok := v.profile.http3Settings[id]; !ok && !http3TransportSettings[id] {
+			v.errorf("h3-settings", "http3 settings order contains %s without value", http3SettingName(id))
+		}
+	}
+
+	if len(v.profile.http3PseudoHeaderOrder) > 0 && !isPseudoHeaderPermutation(v.profile.http3PseudoHeaderOrder) {
+		v.errorf("h3-pseudo-header-order", "http3 pseudo header order %v is not a permutation of %v", v.profile.http3PseudoHeaderOrder, http2PseudoHeaders)
+	}
+}
+
+func isPseudoHeaderPermutation(order []string) bool {
+	if len(order) != len(http2PseudoHeaders) {
+		return false
+	}
+
+	for _, pseudoHeader := range http2PseudoHeaders {
+		if !slices.Contains(order, pseudoHeader) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func supportedGroupsOf(spec tls.ClientHelloSpec) []tls.CurveID {
+	for _, extension := range spec.Extensions {
+		if ext, ok := extension.(*tls.SupportedCurvesExtension); ok {
+			return ext.Curves
+		}
+	}
+
+	return nil
+}
+
+func keyShareGroupsOf(spec tls.ClientHelloSpec) ([]tls.CurveID, bool) {
+	for _, extension := range spec.Extensions {
+		if ext, ok := extension.(*tls.KeyShareExtension); ok {
+			groups := make([]tls.CurveID, 0, len(ext.KeyShares))
+			for _, keyShare := range ext.KeyShares {
+				groups = append(groups, keyShare.Group)
+			}
+
+			return groups, true
+		}
+	}
+
+	return nil, false
+}
+
+func alpnProtocolsOf(spec tls.ClientHelloSpec) []string {
+	for _, extension := range spec.Extensions {
+		if ext, ok := extension.(*tls.ALPNExtension); ok {
+			return ext.AlpnProtocols
+		}
+	}
+
+	return nil
+}
+
+func supportsTLS13(spec tls.ClientHelloSpec) bool {
+	for _, extension := range spec.Extensions {
+		if ext, ok := extension.(*tls.SupportedVersionsExtension); ok {
+			return slices.Contains(ext.Versions, tls.VersionTLS13)
+		}
+	}
+
+	return spec.TLSVersMax >= tls.VersionTLS13
+}
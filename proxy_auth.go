@@ -0,0 +1,432 @@
+package tls_client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	http "github.com/bogdanfinn/fhttp"
+	// md4 is deprecated because MD4 is broken, but the NT hash of NTLMv2 is defined as the MD4 of the password
+	//lint:ignore SA1019 NTLM requires MD4
+	"golang.org/x/crypto/md4"
+)
+
+const (
+	// maxProxyAuthRounds limits the CONNECT requests answering 407 challenges. NTLM needs two rounds.
+	maxProxyAuthRounds = 3
+	// maxProxyAuthBodySize limits the body of a 407 response which is drained to reuse the proxy connection
+	maxProxyAuthBodySize = 64 << 10
+)
+
+var errNTLMOverHttp2 = errors.New("NTLM proxy authentication is bound to the proxy connection and is not supported by h2 proxies")
+
+// ProxyAuthenticator answers the challenges of proxies which respond to CONNECT with 407 Proxy Authentication Required.
+// Credentials of the proxy url are still sent as Basic auth with the first CONNECT request.
+type ProxyAuthenticator interface {
+	// Scheme is the authentication scheme of the Proxy-Authenticate challenges the authenticator answers, e.g. "Digest".
+	Scheme() string
+	// Authorize returns the Proxy-Authorization header value for the CONNECT request. challenge is the Proxy-Authenticate
+	// challenge without the scheme, it is empty when connection based schemes like NTLM start the handshake.
+	Authorize(proxyHost string, req *http.Request, challenge string) (string, error)
+}
+
+// proxyAuthorization returns the Proxy-Authorization header value of the first authenticator which answers a challenge
+// of the 407 response. It returns an empty string if no authenticator matches.
+func proxyAuthorization(authenticators []ProxyAuthenticator, proxyHost string, req *http.Request, resp *http.Response) (string, error) {
+	challenges := resp.Header.Values("Proxy-Authenticate")
+
+	for _, authenticator := range authenticators {
+		for _, challenge := range challenges {
+			scheme, params, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+			if !strings.EqualFold(scheme, authenticator.Scheme()) {
+				continue
+			}
+
+			// every round of an h2 CONNECT is a new stream, which the proxy cannot bind to the previous rounds
+			if _, ok := authenticator.(*ntlmProxyAuthenticator); ok && req.ProtoMajor == 2 {
+				return "", errNTLMOverHttp2
+			}
+
+			authorization, err := authenticator.Authorize(proxyHost, req, strings.TrimSpace(params))
+			if err != nil {
+				return "", fmt.Errorf("failed to answer %s proxy challenge: %w", scheme, err)
+			}
+
+			return authorization, nil
+		}
+	}
+
+	return "", nil
+}
+
+type digestProxyAuthenticator struct {
+	username string
+	password string
+}
+
+// NewDigestProxyAuthenticator answers Digest challenges (RFC 7616) with the MD5 and SHA-256 algorithms and qop auth.
+func NewDigestProxyAuthenticator(username string, password string) ProxyAuthenticator {
+	return &digestProxyAuthenticator{username: username, password: password}
+}
+
+func (a *digestProxyAuthenticator) Scheme() string {
+	return "Digest"
+}
+
+func (a *digestProxyAuthenticator) Authorize(_ string, req *http.Request, challenge string) (string, error) {
+	params := parseAuthParams(challenge)
+
+	realm := params["realm"]
+	nonce := params["nonce"]
+	if nonce == "" {
+		return "", errors.New("digest challenge without nonce")
+	}
+
+	algorithm := params["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %s", algorithm)
+	}
+
+	digest := func(values ...string) string {
+		h := newHash()
+		h.Write([]byte(strings.Join(values, ":")))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	cnonceBytes := make([]byte, 16)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return "", err
+	}
+	cnonce := hex.EncodeToString(cnonceBytes)
+
+	ha1 := digest(a.username, realm, a.password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = digest(ha1, nonce, cnonce)
+	}
+
+	// CONNECT requests use the authority as request target
+	uri := req.Host
+	ha2 := digest(req.Method, uri)
+
+	var qop string
+	if qopOptions, ok := params["qop"]; ok {
+		for _, option := range strings.Split(qopOptions, ",") {
+			if strings.TrimSpace(option) == "auth" {
+				qop = "auth"
+			}
+		}
+
+		if qop == "" {
+			return "", fmt.Errorf("unsupported digest qop %s", qopOptions)
+		}
+	}
+
+	// every CONNECT request uses a fresh client nonce, so the nonce count is always 1
+	const nonceCount = "00000001"
+
+	var response string
+	if qop != "" {
+		response = digest(ha1, nonce, nonceCount, cnonce, qop, ha2)
+	} else {
+		response = digest(ha1, nonce, ha2)
+	}
+
+	fields := []string{
+		fmt.Sprintf("username=%q", a.username),
+		fmt.Sprintf("realm=%q", realm),
+		fmt.Sprintf("nonce=%q", nonce),
+		fmt.Sprintf("uri=%q", uri),
+		"algorithm=" + algorithm,
+		fmt.Sprintf("response=%q", response),
+	}
+
+	if qop != "" {
+		fields = append(fields, "qop="+qop, "nc="+nonceCount, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+
+	if opaque, ok := params["opaque"]; ok {
+		fields = append(fields, fmt.Sprintf("opaque=%q", opaque))
+	}
+
+	return "Digest " + strings.Join(fields, ", "), nil
+}
+
+// parseAuthParams parses the comma separated auth-params of a challenge, values may be quoted strings.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+
+	for s != "" {
+		s = strings.TrimLeft(s, " ,")
+
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		rest = strings.TrimLeft(rest, " ")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+
+				b.WriteByte(rest[i])
+			}
+
+			value = b.String()
+			s = rest[min(i+1, len(rest)):]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+
+		params[name] = value
+	}
+
+	return params
+}
+
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmNegotiateOEM                     = 0x00000002
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateNTLM                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiate56                      = 0x80000000
+
+	ntlmAvTimestamp = 7
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+type ntlmProxyAuthenticator struct {
+	domain   string
+	username string
+	password string
+}
+
+// NewNTLMProxyAuthenticator answers NTLM challenges with NTLMv2 responses. NTLM authenticates the proxy connection,
+// so it only works with proxies which keep the connection open between the challenges. Challenges of h2 proxies,
+// which receive every CONNECT request on a new stream, fail with an error.
+// A username of the form DOMAIN\user sets the domain if domain is empty.
+func NewNTLMProxyAuthenticator(domain string, username string, password string) ProxyAuthenticator {
+	if domain == "" {
+		if d, u, ok := strings.Cut(username, `\`); ok {
+			domain, username = d, u
+		}
+	}
+
+	return &ntlmProxyAuthenticator{domain: domain, username: username, password: password}
+}
+
+func (a *ntlmProxyAuthenticator) Scheme() string {
+	return "NTLM"
+}
+
+func (a *ntlmProxyAuthenticator) Authorize(_ string, _ *http.Request, challenge string) (string, error) {
+	if challenge == "" {
+		return "NTLM " + base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()), nil
+	}
+
+	challengeMessage, err := base64.StdEncoding.DecodeString(challenge)
+	if err != nil {
+		return "", fmt.Errorf("invalid ntlm challenge: %w", err)
+	}
+
+	authenticateMessage, err := ntlmAuthenticateMessage(challengeMessage, a.domain, a.username, a.password)
+	if err != nil {
+		return "", err
+	}
+
+	return "NTLM " + base64.StdEncoding.EncodeToString(authenticateMessage), nil
+}
+
+func ntlmNegotiateMessage() []byte {
+	message := append([]byte{}, ntlmSignature...)
+	message = binary.LittleEndian.AppendUint32(message, 1)
+	message = binary.LittleEndian.AppendUint32(message, ntlmNegotiateUnicode|ntlmNegotiateOEM|ntlmRequestTarget|ntlmNegotiateNTLM|
+		ntlmNegotiateAlwaysSign|ntlmNegotiateExtendedSessionSecurity|ntlmNegotiate128|ntlmNegotiate56)
+
+	// empty domain and workstation
+	return append(message, make([]byte, 16)...)
+}
+
+// ntlmAuthenticateMessage answers the challenge message with an NTLMv2 response.
+func ntlmAuthenticateMessage(challengeMessage []byte, domain string, username string, password string) ([]byte, error) {
+	if len(challengeMessage) < 32 || !bytes.Equal(challengeMessage[:8], ntlmSignature) || binary.LittleEndian.Uint32(challengeMessage[8:12]) != 2 {
+		return nil, errors.New("invalid ntlm challenge message")
+	}
+
+	flags := binary.LittleEndian.Uint32(challengeMessage[20:24])
+	serverChallenge := challengeMessage[24:32]
+
+	var targetInfo []byte
+	if flags&ntlmNegotiateTargetInfo != 0 && len(challengeMessage) >= 48 {
+		length := int(binary.LittleEndian.Uint16(challengeMessage[40:42]))
+		offset := int(binary.LittleEndian.Uint32(challengeMessage[44:48]))
+		if offset+length > len(challengeMessage) {
+			return nil, errors.New("invalid ntlm target info")
+		}
+
+		targetInfo = challengeMessage[offset : offset+length]
+	}
+
+	timestamp, hasTimestamp := ntlmTargetInfoTimestamp(targetInfo)
+	if !hasTimestamp {
+		// FILETIME: 100 nanosecond intervals since January 1, 1601
+		timestamp = make([]byte, 8)
+		binary.LittleEndian.PutUint64(timestamp, uint64(time.Now().UnixNano()/100+116444736000000000))
+	}
+
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+
+	ntHash := md4.New()
+	ntHash.Write(ntlmUnicode(password))
+
+	ntlmV2Hash := hmacMD5(ntHash.Sum(nil), ntlmUnicode(strings.ToUpper(username)+domain))
+
+	blob := []byte{0x01, 0x01, 0, 0, 0, 0, 0, 0}
+	blob = append(blob, timestamp...)
+	blob = append(blob, clientChallenge...)
+	blob = append(blob, 0, 0, 0, 0)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+
+	ntResponse := append(hmacMD5(ntlmV2Hash, serverChallenge, blob), blob...)
+
+	// with a timestamp in the target info the LMv2 response must be empty
+	lmResponse := make([]byte, 24)
+	if !hasTimestamp {
+		lmResponse = append(hmacMD5(ntlmV2Hash, serverChallenge, clientChallenge), clientChallenge...)
+	}
+
+	payloads := [][]byte{lmResponse, ntResponse, ntlmUnicode(domain), ntlmUnicode(username), nil, nil}
+
+	const headerLen = 64
+
+	message := append([]byte{}, ntlmSignature...)
+	message = binary.LittleEndian.AppendUint32(message, 3)
+
+	offset := headerLen
+	for _, payload := range payloads {
+		message = binary.LittleEndian.AppendUint16(message, uint16(len(payload)))
+		message = binary.LittleEndian.AppendUint16(message, uint16(len(payload)))
+		message = binary.LittleEndian.AppendUint32(message, uint32(offset))
+		offset += len(payload)
+	}
+
+	message = binary.LittleEndian.AppendUint32(message, flags&^ntlmNegotiateOEM|ntlmNegotiateUnicode)
+
+	for _, payload := range payloads {
+		message = append(message, payload...)
+	}
+
+	return message, nil
+}
+
+// ntlmTargetInfoTimestamp returns the server timestamp of the AV pairs in the target info.
+func ntlmTargetInfoTimestamp(targetInfo []byte) ([]byte, bool) {
+	for len(targetInfo) >= 4 {
+		id := binary.LittleEndian.Uint16(targetInfo[0:2])
+		length := int(binary.LittleEndian.Uint16(targetInfo[2:4]))
+		if 4+length > len(targetInfo) {
+			break
+		}
+
+		if id == ntlmAvTimestamp && length == 8 {
+			return targetInfo[4 : 4+length], true
+		}
+
+		targetInfo = targetInfo[4+length:]
+	}
+
+	return nil, false
+}
+
+func ntlmUnicode(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+
+	b := make([]byte, 0, 2*len(encoded))
+	for _, r := range encoded {
+		b = binary.LittleEndian.AppendUint16(b, r)
+	}
+
+	return b
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+
+	return mac.Sum(nil)
+}
+
+// NegotiateTokenFunc returns the next SPNEGO token for the proxy, e.g. from a Kerberos or SSPI implementation.
+// challenge is nil for the initial token.
+type NegotiateTokenFunc func(proxyHost string, challenge []byte) ([]byte, error)
+
+type negotiateProxyAuthenticator struct {
+	tokenFunc NegotiateTokenFunc
+}
+
+// NewNegotiateProxyAuthenticator answers Negotiate challenges (RFC 4559) with the tokens of tokenFunc.
+func NewNegotiateProxyAuthenticator(tokenFunc NegotiateTokenFunc) ProxyAuthenticator {
+	return &negotiateProxyAuthenticator{tokenFunc: tokenFunc}
+}
+
+func (a *negotiateProxyAuthenticator) Scheme() string {
+	return "Negotiate"
+}
+
+func (a *negotiateProxyAuthenticator) Authorize(proxyHost string, _ *http.Request, challenge string) (string, error) {
+	var challengeToken []byte
+	if challenge != "" {
+		var err error
+		challengeToken, err = base64.StdEncoding.DecodeString(challenge)
+		if err != nil {
+			return "", fmt.Errorf("invalid negotiate challenge: %w", err)
+		}
+	}
+
+	token, err := a.tokenFunc(proxyHost, challengeToken)
+	if err != nil {
+		return "", err
+	}
+
+	return "Negotiate " + base64.StdEncoding.EncodeToString(token), nil
+}
@@ -0,0 +1,100 @@
+package tls_client
+
+import (
+	"net"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/bogdanfinn/tls-client/bandwidth"
+	tls "github.com/bogdanfinn/utls"
+)
+
+// ProxyError is returned if the proxy does not establish the tunnel. Rotating proxy providers often explain
+// the rejection in the headers of the response, e.g. with the session id or the exit ip.
+type ProxyError struct {
+	// StatusCode and Status are the ones of the response to the CONNECT request.
+	StatusCode int
+	Status     string
+	Header     http.Header
+}
+
+func newProxyError(resp *http.Response) *ProxyError {
+	return &ProxyError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+	}
+}
+
+func (e *ProxyError) Error() string {
+	return "Proxy responded with non 200 code: " + e.Status
+}
+
+// proxyEstablishedTunnel reports whether the proxy established the tunnel, which any 2xx response to a CONNECT
+// request does (RFC 9110, section 9.3.6).
+func proxyEstablishedTunnel(resp *http.Response) bool {
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// proxyTunnel is implemented by the connections of tunnels through http and https proxies.
+type proxyTunnel interface {
+	// proxyConnectResponse returns the response of the proxy which established the tunnel.
+	proxyConnectResponse() *http.Response
+}
+
+// newProxyConnectResponse copies the status and the headers of the response to a CONNECT request. The body of the
+// response is the tunnel itself, so it is left out.
+func newProxyConnectResponse(resp *http.Response) *http.Response {
+	return &http.Response{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		ProtoMajor: resp.ProtoMajor,
+		ProtoMinor: resp.ProtoMinor,
+		Header:     resp.Header,
+		Body:       http.NoBody,
+	}
+}
+
+// connectTunnelConn is the connection to an http/1.1 proxy after the proxy established the tunnel.
+type connectTunnelConn struct {
+	net.Conn
+	connectResponse *http.Response
+}
+
+func (c *connectTunnelConn) proxyConnectResponse() *http.Response {
+	return c.connectResponse
+}
+
+// proxyConnectResponseOf returns the response of the proxy which established the tunnel conn was dialed through.
+// It returns nil if conn was not dialed through an http or https proxy.
+func proxyConnectResponseOf(conn net.Conn) *http.Response {
+	if tunnel, ok := findConn[proxyTunnel](conn); ok {
+		return tunnel.proxyConnectResponse()
+	}
+
+	return nil
+}
+
+// findConn unwraps the TLS, the bandwidth tracking and the ECH status connections around conn until it finds a T.
+func findConn[T any](conn net.Conn) (T, bool) {
+	for conn != nil {
+		if found, ok := conn.(T); ok {
+			return found, true
+		}
+
+		switch c := conn.(type) {
+		case *tls.UConn:
+			conn = c.NetConn()
+		case *bandwidth.BTConn:
+			conn = c.Conn
+		case *echConn:
+			conn = c.Conn
+		default:
+			conn = nil
+		}
+	}
+
+	var zero T
+
+	return zero, false
+}
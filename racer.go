@@ -34,6 +34,10 @@ type protocolRacer struct {
 	http3PriorityParam     uint32
 	http3PseudoHeaderOrder []string
 	http3SendGreaseFrames  bool
+	packetDialer           packetDialer
+	resolver               Resolver
+	resolveOverrides       resolveOverrides
+	ipNetwork              string
 }
 
 func newProtocolRacer(
@@ -52,6 +56,10 @@ func newProtocolRacer(
 	http3PriorityParam uint32,
 	http3PseudoHeaderOrder []string,
 	http3SendGreaseFrames bool,
+	packetDialer packetDialer,
+	resolver Resolver,
+	resolveOverrides resolveOverrides,
+	ipNetwork string,
 ) *protocolRacer {
 	return &protocolRacer{
 		protocolCache:          make(map[string]string),
@@ -70,6 +78,10 @@ func newProtocolRacer(
 		http3PriorityParam:     http3PriorityParam,
 		http3PseudoHeaderOrder: http3PseudoHeaderOrder,
 		http3SendGreaseFrames:  http3SendGreaseFrames,
+		packetDialer:           packetDialer,
+		resolver:               resolver,
+		resolveOverrides:       resolveOverrides,
+		ipNetwork:              ipNetwork,
 	}
 }
 
@@ -259,6 +271,10 @@ func (pr *protocolRacer) getHTTP3Config() *http3Config {
 		http3PriorityParam:     pr.http3PriorityParam,
 		http3PseudoHeaderOrder: pr.http3PseudoHeaderOrder,
 		http3SendGreaseFrames:  pr.http3SendGreaseFrames,
+		packetDialer:           pr.packetDialer,
+		resolver:               pr.resolver,
+		ipNetwork:              pr.ipNetwork,
+		resolveOverrides:       pr.resolveOverrides,
 	}
 }
 
@@ -0,0 +1,111 @@
+package tls_client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// resolveOverrides map "host:port" to the addresses which are dialed instead of the host, see WithResolveOverrides.
+type resolveOverrides map[string][]net.IP
+
+// resolveOverridesKey returns the lower case "host:port" of addr.
+func resolveOverridesKey(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return strings.ToLower(addr)
+	}
+
+	return net.JoinHostPort(strings.ToLower(host), port)
+}
+
+// validate returns an error for the first key which is not a "host:port" with a valid port.
+func (o resolveOverrides) validate() error {
+	for key, ips := range o {
+		_, portStr, err := net.SplitHostPort(key)
+		if err != nil {
+			return fmt.Errorf("the resolve override %q is no host:port: %w", key, err)
+		}
+
+		if port, err := strconv.Atoi(portStr); err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("the resolve override %q has an invalid port", key)
+		}
+
+		if len(ips) == 0 {
+			return fmt.Errorf("the resolve override %q has no addresses", key)
+		}
+	}
+
+	return nil
+}
+
+func (o resolveOverrides) contains(addr string) bool {
+	_, ok := o[resolveOverridesKey(addr)]
+
+	return ok
+}
+
+// addrs returns the addresses addr is overridden with which belong to the network, e.g. only IPv4 addresses for tcp4.
+func (o resolveOverrides) addrs(network string, addr string) ([]string, bool) {
+	ips, ok := o[resolveOverridesKey(addr)]
+	if !ok {
+		return nil, false
+	}
+
+	_, port, _ := net.SplitHostPort(addr)
+
+	var addrs []string
+	for _, ip := range ips {
+		isIPv4 := ip.To4() != nil
+		if (strings.HasSuffix(network, "4") && !isIPv4) || (strings.HasSuffix(network, "6") && isIPv4) {
+			continue
+		}
+
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+
+	return addrs, true
+}
+
+// dialOverridden dials the addresses addr is overridden with one after another, or addr if it is not overridden.
+func dialOverridden[T any](ctx context.Context, overrides resolveOverrides, network, addr string, dial func(ctx context.Context, network, addr string) (T, error)) (T, error) {
+	addrs, ok := overrides.addrs(network, addr)
+	if !ok {
+		return dial(ctx, network, addr)
+	}
+
+	var zero T
+
+	if len(addrs) == 0 {
+		return zero, fmt.Errorf("the resolve override of %s has no %s address", addr, network)
+	}
+
+	var firstErr error
+	for _, overriddenAddr := range addrs {
+		conn, err := dial(ctx, network, overriddenAddr)
+		if err == nil {
+			return conn, nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return zero, firstErr
+}
+
+// dialOrigin dials the addresses addr is overridden with, or the address hints of the record before addr.
+func (rt *roundTripper) dialOrigin(ctx context.Context, network, addr string, record *HTTPSRecord) (net.Conn, error) {
+	if rt.resolveOverrides.contains(addr) {
+		return dialOverridden(ctx, rt.resolveOverrides, network, addr, rt.dialer.DialContext)
+	}
+
+	return rt.dialHTTPSRecord(ctx, network, addr, record)
+}
@@ -0,0 +1,56 @@
+package tls_client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestDialOverridden(t *testing.T) {
+	overrides := resolveOverrides{
+		resolveOverridesKey("Example.com:443"): {net.ParseIP("::1"), net.IPv4(192, 0, 2, 1), net.IPv4(127, 0, 0, 1)},
+	}
+
+	testCases := []struct {
+		network       string
+		addr          string
+		expectedDials []string
+	}{
+		// the addresses are dialed in order until a dial succeeds
+		{"tcp", "example.com:443", []string{"[::1]:443", "192.0.2.1:443", "127.0.0.1:443"}},
+		{"tcp4", "EXAMPLE.COM:443", []string{"192.0.2.1:443", "127.0.0.1:443"}},
+		// other ports and hosts are dialed as they are
+		{"tcp", "example.com:80", []string{"example.com:80"}},
+		{"udp", "example.org:443", []string{"example.org:443"}},
+	}
+
+	for _, testCase := range testCases {
+		var dials []string
+
+		addr, err := dialOverridden(context.Background(), overrides, testCase.network, testCase.addr, func(_ context.Context, _, addr string) (string, error) {
+			dials = append(dials, addr)
+			if addr == "[::1]:443" || addr == "192.0.2.1:443" {
+				return "", errors.New("connection refused")
+			}
+
+			return addr, nil
+		})
+
+		if err != nil || !reflect.DeepEqual(dials, testCase.expectedDials) || addr != dials[len(dials)-1] {
+			t.Errorf("%s %s: dialed %v (%v), expected %v", testCase.network, testCase.addr, dials, err, testCase.expectedDials)
+		}
+	}
+
+	// the dial fails if no address belongs to the network
+	overrides = resolveOverrides{"example.com:443": {net.IPv4(127, 0, 0, 1)}}
+
+	_, err := dialOverridden(context.Background(), overrides, "tcp6", "example.com:443", func(_ context.Context, _, addr string) (string, error) {
+		t.Errorf("unexpected dial of %s", addr)
+		return addr, nil
+	})
+	if err == nil {
+		t.Error("expected an error without IPv6 addresses")
+	}
+}
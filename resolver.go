@@ -0,0 +1,587 @@
+package tls_client
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls "github.com/bogdanfinn/utls"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// dohMaxResponseSize is the maximum size of a dns message
+	dohMaxResponseSize = 64 * 1024
+	dohContentType     = "application/dns-message"
+	dotDefaultPort     = "853"
+	// cachePruneInterval is the minimum time between two prunes of the expired addresses of a caching resolver
+	cachePruneInterval = time.Minute
+)
+
+// Resolver resolves the hosts the client connects to, see WithResolver. *net.Resolver implements it.
+type Resolver interface {
+	// LookupIP returns the addresses of the host for the network "ip", "ip4" or "ip6".
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// TTLResolver is a Resolver which knows how long the addresses it returns may be cached.
+type TTLResolver interface {
+	Resolver
+	// LookupIPWithTTL is LookupIP which additionally returns the lowest TTL of the records of the addresses.
+	LookupIPWithTTL(ctx context.Context, network, host string) ([]net.IP, time.Duration, error)
+}
+
+// DNSResolver is a TTLResolver which also resolves the HTTPS records of hosts with the same DNS server,
+// so it can be used with both WithResolver and WithHTTPSResolver.
+type DNSResolver interface {
+	TTLResolver
+	HTTPSResolver
+}
+
+// lookupIPWithTTL resolves the host with the resolver and returns the TTL of a TTLResolver or defaultTTL.
+func lookupIPWithTTL(ctx context.Context, resolver Resolver, network, host string, defaultTTL time.Duration) ([]net.IP, time.Duration, error) {
+	if ttlResolver, ok := resolver.(TTLResolver); ok {
+		return ttlResolver.LookupIPWithTTL(ctx, network, host)
+	}
+
+	ips, err := resolver.LookupIP(ctx, network, host)
+
+	return ips, defaultTTL, err
+}
+
+// lookupNetwork returns the network of the lookup for the addresses of the dial network.
+func lookupNetwork(network string) string {
+	switch network {
+	case "tcp4", "udp4":
+		return "ip4"
+	case "tcp6", "udp6":
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// ipNetwork returns the network of the lookup for the addresses of the IP versions which are not disabled.
+func ipNetwork(disableIPV4, disableIPV6 bool) string {
+	switch {
+	case disableIPV6:
+		return "ip4"
+	case disableIPV4:
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// dialResolved dials addr with the dialer after resolving its host with the resolver. The addresses are dialed one
+// after another within the timeout of the dialer, like the dialer does if it resolves the host itself.
+func dialResolved(ctx context.Context, dialer *net.Dialer, resolver Resolver, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if resolver == nil || err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	if dialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialer.Timeout)
+		defer cancel()
+	}
+
+	ips, err := resolver.LookupIP(ctx, lookupNetwork(network), host)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if firstErr == nil {
+		firstErr = &net.OpError{Op: "dial", Net: network, Err: newDNSNotFoundError(host)}
+	}
+
+	return nil, firstErr
+}
+
+// resolveAddr replaces the host of addr with its first address of the network.
+func resolveAddr(ctx context.Context, resolver Resolver, network, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return addr, err
+	}
+
+	ips, err := resolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return "", err
+	}
+
+	if len(ips) == 0 {
+		return "", newDNSNotFoundError(host)
+	}
+
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+func newDNSNotFoundError(host string) error {
+	return &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// dnsMessageResolver resolves hosts with A and AAAA queries and their HTTPS records with HTTPS queries,
+// which are sent by exchange.
+type dnsMessageResolver struct {
+	exchange func(ctx context.Context, query []byte) ([]byte, error)
+	https    *dnsHTTPSResolver
+}
+
+func newDNSMessageResolver(exchange func(ctx context.Context, query []byte) ([]byte, error)) *dnsMessageResolver {
+	return &dnsMessageResolver{exchange: exchange, https: newDNSHTTPSResolver(exchange)}
+}
+
+// LookupHTTPS caches the records for their TTL, unlike the addresses, see NewCachingResolver.
+func (r *dnsMessageResolver) LookupHTTPS(ctx context.Context, host string) ([]HTTPSRecord, error) {
+	return r.https.LookupHTTPS(ctx, host)
+}
+
+func (r *dnsMessageResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	ips, _, err := r.LookupIPWithTTL(ctx, network, host)
+
+	return ips, err
+}
+
+// LookupIPWithTTL queries the A and the AAAA records of the host in parallel for the network "ip".
+// The IPv4 addresses come first.
+func (r *dnsMessageResolver) LookupIPWithTTL(ctx context.Context, network, host string) ([]net.IP, time.Duration, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, 0, nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	var queryTypes []dnsmessage.Type
+	switch network {
+	case "ip":
+		queryTypes = []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	case "ip4":
+		queryTypes = []dnsmessage.Type{dnsmessage.TypeA}
+	case "ip6":
+		queryTypes = []dnsmessage.Type{dnsmessage.TypeAAAA}
+	default:
+		return nil, 0, fmt.Errorf("unsupported network %q", network)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dnsQueryTimeout)
+		defer cancel()
+	}
+
+	type result struct {
+		ips []net.IP
+		ttl time.Duration
+		err error
+	}
+
+	results := make([]result, len(queryTypes))
+
+	var wg sync.WaitGroup
+	for i, queryType := range queryTypes {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ips, ttl, err := r.lookup(ctx, host, queryType)
+			results[i] = result{ips: ips, ttl: ttl, err: err}
+		}()
+	}
+
+	wg.Wait()
+
+	var ips []net.IP
+	var firstErr error
+
+	ttl := time.Duration(-1)
+
+	for _, result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
+
+			continue
+		}
+
+		ips = append(ips, result.ips...)
+
+		if len(result.ips) > 0 && (ttl < 0 || result.ttl < ttl) {
+			ttl = result.ttl
+		}
+	}
+
+	if len(ips) == 0 {
+		if firstErr != nil {
+			return nil, 0, firstErr
+		}
+
+		return nil, 0, newDNSNotFoundError(host)
+	}
+
+	return ips, ttl, nil
+}
+
+// lookup returns the addresses of the records of the type and their lowest TTL.
+func (r *dnsMessageResolver) lookup(ctx context.Context, host string, queryType dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	query, err := newDNSQuery(host, queryType)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response, err := r.exchange(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var parser dnsmessage.Parser
+
+	header, err := parser.Start(response)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, newDNSNotFoundError(host)
+	default:
+		return nil, 0, fmt.Errorf("dns server responded with %s for the %s records of %s", header.RCode, queryType, host)
+	}
+
+	if err := parser.SkipAllQuestions(); err != nil {
+		return nil, 0, err
+	}
+
+	var ips []net.IP
+
+	ttl := time.Duration(-1)
+
+	for {
+		answerHeader, err := parser.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch {
+		case answerHeader.Type == dnsmessage.TypeA && queryType == dnsmessage.TypeA:
+			resource, err := parser.AResource()
+			if err != nil {
+				return nil, 0, err
+			}
+
+			ips = append(ips, net.IP(resource.A[:]))
+		case answerHeader.Type == dnsmessage.TypeAAAA && queryType == dnsmessage.TypeAAAA:
+			resource, err := parser.AAAAResource()
+			if err != nil {
+				return nil, 0, err
+			}
+
+			ips = append(ips, net.IP(resource.AAAA[:]))
+		default:
+			if err := parser.SkipAnswer(); err != nil {
+				return nil, 0, err
+			}
+
+			// the TTL of the CNAME records of the host limit the TTL of the addresses as well
+			if answerHeader.Type != dnsmessage.TypeCNAME {
+				continue
+			}
+		}
+
+		if recordTTL := time.Duration(answerHeader.TTL) * time.Second; ttl < 0 || recordTTL < ttl {
+			ttl = recordTTL
+		}
+	}
+
+	return ips, max(ttl, 0), nil
+}
+
+type dohResolver struct {
+	serverUrl url.URL
+	client    HttpClient
+}
+
+// NewDoHResolver returns a Resolver which sends its queries to the DNS-over-HTTPS server url (RFC 8484), e.g.
+// "https://dns.google/dns-query", with GET requests of the client. The queries therefore have the fingerprint and go
+// through the proxy of the client. The client resolves the host of the server itself, so it should not use the
+// returned resolver. A nil client uses a new client with the default options.
+// The resolver also looks up HTTPS records for WithHTTPSResolver.
+func NewDoHResolver(serverUrl string, client HttpClient) (DNSResolver, error) {
+	parsedUrl, err := url.Parse(serverUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsedUrl.Scheme != "https" || parsedUrl.Host == "" {
+		return nil, fmt.Errorf("invalid DNS-over-HTTPS server url %q, make sure to specify a full url like https://dns.google/dns-query", serverUrl)
+	}
+
+	if client == nil {
+		client, err = NewHttpClient(nil, DefaultOptions...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	doh := &dohResolver{serverUrl: *parsedUrl, client: client}
+
+	return newDNSMessageResolver(doh.exchange), nil
+}
+
+func (r *dohResolver) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	// the id is 0 so that the responses can be cached by http caches (RFC 8484, section 4.1)
+	query[0], query[1] = 0, 0
+
+	requestUrl := r.serverUrl
+	values := requestUrl.Query()
+	values.Set("dns", base64.RawURLEncoding.EncodeToString(query))
+	requestUrl.RawQuery = values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = http.Header{
+		"accept":            {dohContentType},
+		http.HeaderOrderKey: {"accept"},
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS server responded with status %d", resp.StatusCode)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != dohContentType {
+		return nil, fmt.Errorf("DNS-over-HTTPS server responded with content type %q", contentType)
+	}
+
+	response, err := io.ReadAll(io.LimitReader(resp.Body, dohMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return checkDNSResponseID(query, response)
+}
+
+// DoTResolverOptions configure the TLS connections of a DNS-over-TLS resolver.
+type DoTResolverOptions struct {
+	// ServerName is verified against the certificate of the server. It defaults to the host of the server address.
+	ServerName string
+	// RootCAs verify the certificate of the server, nil uses the system roots.
+	RootCAs *x509.CertPool
+	// Dialer dials the TCP connections to the server, e.g. the GetDialer of a client with a proxy.
+	// Nil dials the server directly, so the queries do not go through the proxy of the client which uses the resolver.
+	Dialer proxy.ContextDialer
+}
+
+type dotResolver struct {
+	server  string
+	options DoTResolverOptions
+}
+
+// NewDoTResolver returns a Resolver which sends its queries to the DNS-over-TLS server at the address "host:port"
+// (RFC 7858), the port defaults to 853. Every query is sent on a new connection. Nil options use the defaults.
+// The server is dialed directly unless DoTResolverOptions.Dialer is set. The resolver also looks up HTTPS records for
+// WithHTTPSResolver.
+func NewDoTResolver(server string, options *DoTResolverOptions) DNSResolver {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, dotDefaultPort)
+	}
+
+	dot := &dotResolver{server: server}
+	if options != nil {
+		dot.options = *options
+	}
+
+	if dot.options.ServerName == "" {
+		dot.options.ServerName, _, _ = net.SplitHostPort(server)
+	}
+
+	if dot.options.Dialer == nil {
+		dot.options.Dialer = &net.Dialer{}
+	}
+
+	return newDNSMessageResolver(dot.exchange)
+}
+
+func (r *dotResolver) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	rawConn, err := r.options.Dialer.DialContext(ctx, "tcp", r.server)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := tls.Client(rawConn, &tls.Config{ServerName: r.options.ServerName, RootCAs: r.options.RootCAs, NextProtos: []string{"dot"}})
+	defer conn.Close()
+
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+
+	return dnsExchangeConn(ctx, conn, true, query)
+}
+
+type staticResolver struct {
+	hosts    map[string][]net.IP
+	fallback Resolver
+}
+
+// NewStaticResolver returns a Resolver which resolves the hosts of the map to their addresses, like a hosts file, and
+// all other hosts with the fallback. A nil fallback uses the system resolver.
+func NewStaticResolver(hosts map[string][]net.IP, fallback Resolver) TTLResolver {
+	if fallback == nil {
+		fallback = net.DefaultResolver
+	}
+
+	resolver := &staticResolver{hosts: make(map[string][]net.IP, len(hosts)), fallback: fallback}
+	for host, ips := range hosts {
+		resolver.hosts[strings.TrimSuffix(strings.ToLower(host), ".")] = ips
+	}
+
+	return resolver
+}
+
+func (r *staticResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	ips, _, err := r.LookupIPWithTTL(ctx, network, host)
+
+	return ips, err
+}
+
+// LookupIPWithTTL returns the static addresses with a TTL of 0, as there is no need to cache them.
+func (r *staticResolver) LookupIPWithTTL(ctx context.Context, network, host string) ([]net.IP, time.Duration, error) {
+	staticIPs, ok := r.hosts[strings.TrimSuffix(strings.ToLower(host), ".")]
+	if !ok {
+		return lookupIPWithTTL(ctx, r.fallback, network, host, 0)
+	}
+
+	var ips []net.IP
+	for _, ip := range staticIPs {
+		isIPv4 := ip.To4() != nil
+		if network == "ip" || (network == "ip4" && isIPv4) || (network == "ip6" && !isIPv4) {
+			ips = append(ips, ip)
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, 0, newDNSNotFoundError(host)
+	}
+
+	return ips, 0, nil
+}
+
+type cachedIPs struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+type cachingResolver struct {
+	resolver   Resolver
+	defaultTTL time.Duration
+
+	mu        sync.Mutex
+	cache     map[string]cachedIPs
+	nextPrune time.Time
+
+	now func() time.Time
+}
+
+// NewCachingResolver returns a Resolver which caches the addresses of the resolver. The addresses of a TTLResolver
+// are cached for their TTL, the ones of other resolvers for defaultTTL. Failed lookups are not cached.
+// Every client should have its own cache, so that the cache does not link the clients.
+func NewCachingResolver(resolver Resolver, defaultTTL time.Duration) TTLResolver {
+	return &cachingResolver{
+		resolver:   resolver,
+		defaultTTL: defaultTTL,
+		cache:      make(map[string]cachedIPs),
+		now:        time.Now,
+	}
+}
+
+func (r *cachingResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	ips, _, err := r.LookupIPWithTTL(ctx, network, host)
+
+	return ips, err
+}
+
+// LookupIPWithTTL returns the remaining TTL of cached addresses.
+func (r *cachingResolver) LookupIPWithTTL(ctx context.Context, network, host string) ([]net.IP, time.Duration, error) {
+	key := network + "/" + strings.TrimSuffix(strings.ToLower(host), ".")
+
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+
+	if now := r.now(); ok && now.Before(cached.expires) {
+		return cached.ips, cached.expires.Sub(now), nil
+	}
+
+	ips, ttl, err := lookupIPWithTTL(ctx, r.resolver, network, host, r.defaultTTL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r.mu.Lock()
+	if ttl > 0 {
+		now := r.now()
+		r.prune(now)
+		r.cache[key] = cachedIPs{ips: ips, expires: now.Add(ttl)}
+	} else {
+		delete(r.cache, key)
+	}
+	r.mu.Unlock()
+
+	return ips, ttl, nil
+}
+
+// prune removes the expired addresses, at most once per cachePruneInterval. The caller has to hold mu.
+func (r *cachingResolver) prune(now time.Time) {
+	if now.Before(r.nextPrune) {
+		return
+	}
+
+	r.nextPrune = now.Add(cachePruneInterval)
+
+	for key, cached := range r.cache {
+		if !now.Before(cached.expires) {
+			delete(r.cache, key)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package tls_client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	quic "github.com/bogdanfinn/quic-go-utls"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	tls "github.com/bogdanfinn/utls"
+)
+
+// fakeResolver returns the addresses with the TTL, or the error, and counts the lookups.
+type fakeResolver struct {
+	ips     []net.IP
+	ttl     time.Duration
+	err     error
+	lookups int
+}
+
+func (r *fakeResolver) LookupIPWithTTL(_ context.Context, _, _ string) ([]net.IP, time.Duration, error) {
+	r.lookups++
+
+	return r.ips, r.ttl, r.err
+}
+
+func (r *fakeResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	ips, _, err := r.LookupIPWithTTL(ctx, network, host)
+
+	return ips, err
+}
+
+// plainResolver hides the TTL of the resolver.
+type plainResolver struct {
+	Resolver
+}
+
+func TestStaticResolver(t *testing.T) {
+	fallback := &fakeResolver{ips: []net.IP{net.IPv4(192, 0, 2, 1)}, ttl: time.Minute}
+
+	resolver := NewStaticResolver(map[string][]net.IP{
+		"Example.com": {net.IPv4(127, 0, 0, 1), net.ParseIP("::1")},
+		"v4.example":  {net.IPv4(127, 0, 0, 1)},
+	}, fallback)
+
+	testCases := []struct {
+		network     string
+		host        string
+		expectedIPs []net.IP
+	}{
+		{"ip", "example.com.", []net.IP{net.IPv4(127, 0, 0, 1), net.ParseIP("::1")}},
+		{"ip4", "EXAMPLE.COM", []net.IP{net.IPv4(127, 0, 0, 1)}},
+		{"ip6", "example.com", []net.IP{net.ParseIP("::1")}},
+		{"ip", "example.org", []net.IP{net.IPv4(192, 0, 2, 1)}},
+	}
+
+	for _, testCase := range testCases {
+		ips, err := resolver.LookupIP(context.Background(), testCase.network, testCase.host)
+		if err != nil || !reflect.DeepEqual(ips, testCase.expectedIPs) {
+			t.Errorf("%s %s: got %v (%v), expected %v", testCase.network, testCase.host, ips, err, testCase.expectedIPs)
+		}
+	}
+
+	// the fallback is not asked for hosts of the map, even if they have no address of the network
+	_, err := resolver.LookupIP(context.Background(), "ip6", "v4.example")
+
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	if fallback.lookups != 1 {
+		t.Errorf("expected 1 lookup of the fallback, got %d", fallback.lookups)
+	}
+}
+
+func TestCachingResolver(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	upstream := &fakeResolver{ips: []net.IP{net.IPv4(127, 0, 0, 1)}, ttl: time.Minute}
+
+	resolver := NewCachingResolver(upstream, time.Hour).(*cachingResolver)
+	resolver.now = func() time.Time { return now }
+
+	for range 2 {
+		if _, err := resolver.LookupIP(context.Background(), "ip", "example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if upstream.lookups != 1 {
+		t.Fatalf("expected the addresses to be cached, got %d lookups", upstream.lookups)
+	}
+
+	// the remaining TTL is returned
+	now = now.Add(20 * time.Second)
+
+	if _, ttl, _ := resolver.LookupIPWithTTL(context.Background(), "ip", "example.com"); ttl != 40*time.Second {
+		t.Fatalf("expected a remaining TTL of 40s, got %s", ttl)
+	}
+
+	// the addresses of other networks are cached separately
+	_, _ = resolver.LookupIP(context.Background(), "ip4", "example.com")
+
+	if upstream.lookups != 2 {
+		t.Fatalf("expected a lookup for the other network, got %d lookups", upstream.lookups)
+	}
+
+	now = now.Add(40 * time.Second)
+	upstream.err = errors.New("server failure")
+
+	if _, err := resolver.LookupIP(context.Background(), "ip", "example.com"); err == nil {
+		t.Fatal("expected the expired addresses to be looked up again")
+	}
+
+	// failed lookups are not cached
+	upstream.err = nil
+
+	if _, err := resolver.LookupIP(context.Background(), "ip", "example.com"); err != nil || upstream.lookups != 4 {
+		t.Fatalf("expected the failed lookup to be repeated, got %d lookups (%v)", upstream.lookups, err)
+	}
+}
+
+func TestCachingResolver_DefaultTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	upstream := &fakeResolver{ips: []net.IP{net.IPv4(127, 0, 0, 1)}}
+
+	// resolvers without TTL are cached for the default TTL
+	resolver := NewCachingResolver(plainResolver{upstream}, time.Minute).(*cachingResolver)
+	resolver.now = func() time.Time { return now }
+
+	_, _ = resolver.LookupIP(context.Background(), "ip", "example.com")
+	now = now.Add(59 * time.Second)
+	_, _ = resolver.LookupIP(context.Background(), "ip", "example.com")
+
+	if upstream.lookups != 1 {
+		t.Fatalf("expected the addresses to be cached for the default TTL, got %d lookups", upstream.lookups)
+	}
+
+	now = now.Add(time.Second)
+	_, _ = resolver.LookupIP(context.Background(), "ip", "example.com")
+
+	if upstream.lookups != 2 {
+		t.Fatalf("expected the addresses to expire after the default TTL, got %d lookups", upstream.lookups)
+	}
+}
+
+func TestCachingResolver_Prune(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	upstream := &fakeResolver{ips: []net.IP{net.IPv4(127, 0, 0, 1)}, ttl: time.Minute}
+
+	resolver := NewCachingResolver(upstream, time.Hour).(*cachingResolver)
+	resolver.now = func() time.Time { return now }
+
+	_, _ = resolver.LookupIP(context.Background(), "ip", "a.example.com")
+	_, _ = resolver.LookupIP(context.Background(), "ip", "b.example.com")
+
+	// the expired addresses of other hosts are removed when new addresses are cached
+	now = now.Add(cachePruneInterval)
+	_, _ = resolver.LookupIP(context.Background(), "ip", "c.example.com")
+
+	if len(resolver.cache) != 1 {
+		t.Fatalf("expected the expired addresses to be pruned, got %d cached hosts", len(resolver.cache))
+	}
+
+	if _, ok := resolver.cache["ip/c.example.com"]; !ok {
+		t.Fatal("expected the new addresses to be cached")
+	}
+}
+
+func TestDirectQUICDial_Fallback(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// nothing listens on ::1, so the dial falls back to the next address
+	resolver := &fakeResolver{ips: []net.IP{net.ParseIP("::1"), net.IPv4(127, 0, 0, 1)}}
+	dial := newDirectQUICDial(resolver, "ip")
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h3"}}
+	quicConfig := &quic.Config{HandshakeIdleTimeout: 200 * time.Millisecond}
+
+	conn, err := dial(context.Background(), net.JoinHostPort("resolver.test", strconv.Itoa(server.Port())), tlsConfig, quicConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseWithError(0, "")
+
+	if remoteAddr := conn.RemoteAddr().(*net.UDPAddr); !remoteAddr.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("expected a connection to 127.0.0.1, got %s", remoteAddr)
+	}
+}
@@ -0,0 +1,74 @@
+package tls_client
+
+import (
+	"strconv"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// closeCountingTransport counts how often its idle connections are closed.
+type closeCountingTransport struct {
+	http.RoundTripper
+	closed int
+}
+
+func (t *closeCountingTransport) CloseIdleConnections() {
+	t.closed++
+}
+
+func TestChildRoundTripperEviction(t *testing.T) {
+	rt := &roundTripper{childRoundTrippers: make(map[string]*childRoundTripperEntry)}
+
+	transports := make(map[string]*closeCountingTransport)
+
+	getChild := func(key string) *roundTripper {
+		child, err := rt.getChildRoundTripper(key, func() (*roundTripper, error) {
+			transports[key] = &closeCountingTransport{}
+
+			return &roundTripper{cachedTransports: map[string]http.RoundTripper{"addr": transports[key]}}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return child
+	}
+
+	first := getChild("proxy:0")
+	for i := 1; i < maxChildRoundTrippers; i++ {
+		getChild("proxy:" + strconv.Itoa(i))
+	}
+
+	// proxy:0 is used again, so proxy:1 is the least recently used child
+	if getChild("proxy:0") != first {
+		t.Fatal("expected the cached child round tripper")
+	}
+
+	getChild("proxy:new")
+
+	if len(rt.childRoundTrippers) != maxChildRoundTrippers {
+		t.Errorf("expected %d child round trippers, got %d", maxChildRoundTrippers, len(rt.childRoundTrippers))
+	}
+
+	if _, ok := rt.childRoundTrippers["proxy:1"]; ok {
+		t.Error("expected the least recently used child round tripper to be evicted")
+	}
+
+	if transports["proxy:1"].closed != 1 {
+		t.Errorf("expected the idle connections of the evicted child round tripper to be closed once, got %d", transports["proxy:1"].closed)
+	}
+
+	if transports["proxy:0"].closed != 0 {
+		t.Errorf("expected the idle connections of proxy:0 to stay open, got %d closes", transports["proxy:0"].closed)
+	}
+
+	// closing the idle connections of the parent closes the ones of every child
+	rt.CloseIdleConnections()
+
+	for key, transport := range transports {
+		if _, ok := rt.childRoundTrippers[key]; ok && transport.closed != 1 {
+			t.Errorf("expected the idle connections of %s to be closed, got %d closes", key, transport.closed)
+		}
+	}
+}
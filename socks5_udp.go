@@ -0,0 +1,418 @@
+package tls_client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+const (
+	socks5Version             = 0x05
+	socks5AuthNone            = 0x00
+	socks5AuthPassword        = 0x02
+	socks5AuthNoAcceptable    = 0xff
+	socks5PasswordVersion     = 0x01
+	socks5CommandUDPAssociate = 0x03
+	socks5AddrIPv4            = 0x01
+	socks5AddrDomain          = 0x03
+	socks5AddrIPv6            = 0x04
+	socks5ReplySucceeded      = 0x00
+	socks5MaxDatagramSize     = 64 * 1024
+)
+
+var socks5ReplyMessages = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// packetDialer is implemented by proxy dialers which can tunnel UDP datagrams, so HTTP/3 works through the proxy.
+type packetDialer interface {
+	// ListenPacket returns a packet conn which sends its datagrams through the proxy and the address of the target
+	// the datagrams have to be written to.
+	ListenPacket(ctx context.Context, address string) (net.PacketConn, net.Addr, error)
+}
+
+// socks5ContextDialer is a socks5 proxy dialer which additionally supports UDP ASSOCIATE.
+type socks5ContextDialer struct {
+	socksContextDialer
+	proxyUrl url.URL
+	auth     *proxy.Auth
+	dialer   net.Dialer
+	// resolver resolves the hosts of the proxy and of the targets, nil uses the system resolver
+	resolver Resolver
+}
+
+// ListenPacket opens a UDP association with the proxy. The association lasts as long as the returned packet conn is open.
+// With the socks5h scheme hostnames are resolved by the proxy.
+func (d *socks5ContextDialer) ListenPacket(ctx context.Context, address string) (net.PacketConn, net.Addr, error) {
+	targetAddr, err := d.resolveTarget(ctx, address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	control, err := dialResolved(ctx, &d.dialer, d.resolver, "tcp", d.proxyUrl.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = control.SetDeadline(deadline)
+	}
+
+	relayAddr, err := socks5UDPAssociate(control, d.auth)
+	if err != nil {
+		_ = control.Close()
+		return nil, nil, fmt.Errorf("socks5 udp associate failed: %w", err)
+	}
+
+	_ = control.SetDeadline(time.Time{})
+
+	// servers reply with an unspecified address if the relay listens on the address the control connection uses
+	if relayAddr.IP.IsUnspecified() {
+		if controlAddr, ok := control.RemoteAddr().(*net.TCPAddr); ok {
+			relayAddr.IP = controlAddr.IP
+		}
+	}
+
+	udpConn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		_ = control.Close()
+		return nil, nil, err
+	}
+
+	packetConn := &socks5PacketConn{
+		conn:    udpConn,
+		control: control,
+		relay:   relayAddr,
+		buf:     make([]byte, socks5MaxDatagramSize),
+	}
+
+	go packetConn.closeWithControl()
+
+	return packetConn, targetAddr, nil
+}
+
+func (d *socks5ContextDialer) resolveTarget(ctx context.Context, address string) (net.Addr, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in address %s: %w", address, err)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+
+	if d.proxyUrl.Scheme == "socks5h" {
+		return &socks5DomainAddr{host: host, port: port}, nil
+	}
+
+	var resolver Resolver = net.DefaultResolver
+	if d.resolver != nil {
+		resolver = d.resolver
+	}
+
+	ips, err := resolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	return &net.UDPAddr{IP: ips[0], Port: port}, nil
+}
+
+// socks5UDPAssociate authenticates on the control connection and requests a UDP association.
+// It returns the address of the relay the datagrams have to be sent to.
+func socks5UDPAssociate(control net.Conn, auth *proxy.Auth) (*net.UDPAddr, error) {
+	methods := []byte{socks5AuthNone}
+	if auth != nil {
+		methods = append(methods, socks5AuthPassword)
+	}
+
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := control.Write(greeting); err != nil {
+		return nil, err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(control, reply); err != nil {
+		return nil, err
+	}
+
+	if reply[0] != socks5Version {
+		return nil, fmt.Errorf("unexpected socks version %d", reply[0])
+	}
+
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if auth == nil {
+			return nil, errors.New("proxy requires authentication")
+		}
+
+		if len(auth.User) > 255 || len(auth.Password) > 255 {
+			return nil, errors.New("socks5 username or password too long")
+		}
+
+		request := []byte{socks5PasswordVersion, byte(len(auth.User))}
+		request = append(request, auth.User...)
+		request = append(request, byte(len(auth.Password)))
+		request = append(request, auth.Password...)
+		if _, err := control.Write(request); err != nil {
+			return nil, err
+		}
+
+		if _, err := io.ReadFull(control, reply); err != nil {
+			return nil, err
+		}
+
+		if reply[1] != 0x00 {
+			return nil, errors.New("proxy rejected the username or password")
+		}
+	case socks5AuthNoAcceptable:
+		return nil, errors.New("proxy accepts none of the offered authentication methods")
+	default:
+		return nil, fmt.Errorf("proxy selected unsupported authentication method %d", reply[1])
+	}
+
+	// the client address is not known before the first datagram is sent, so it is left unspecified
+	request := []byte{socks5Version, socks5CommandUDPAssociate, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0}
+	if _, err := control.Write(request); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(control, header); err != nil {
+		return nil, err
+	}
+
+	if header[1] != socks5ReplySucceeded {
+		message, ok := socks5ReplyMessages[header[1]]
+		if !ok {
+			message = fmt.Sprintf("unknown reply %d", header[1])
+		}
+
+		return nil, errors.New(message)
+	}
+
+	relay, err := readSocks5Addr(control)
+	if err != nil {
+		return nil, err
+	}
+
+	relayAddr, ok := relay.(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("proxy replied with relay hostname %s", relay)
+	}
+
+	return relayAddr, nil
+}
+
+// readSocks5Addr reads the address type, the address and the port.
+func readSocks5Addr(r io.Reader) (net.Addr, error) {
+	addrType := make([]byte, 1)
+	if _, err := io.ReadFull(r, addrType); err != nil {
+		return nil, err
+	}
+
+	var host []byte
+	switch addrType[0] {
+	case socks5AddrIPv4:
+		host = make([]byte, net.IPv4len)
+	case socks5AddrIPv6:
+		host = make([]byte, net.IPv6len)
+	case socks5AddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(r, length); err != nil {
+			return nil, err
+		}
+
+		host = make([]byte, length[0])
+	default:
+		return nil, fmt.Errorf("unknown socks5 address type %d", addrType[0])
+	}
+
+	if _, err := io.ReadFull(r, host); err != nil {
+		return nil, err
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return nil, err
+	}
+
+	if addrType[0] == socks5AddrDomain {
+		return &socks5DomainAddr{host: string(host), port: int(binary.BigEndian.Uint16(port))}, nil
+	}
+
+	return &net.UDPAddr{IP: host, Port: int(binary.BigEndian.Uint16(port))}, nil
+}
+
+func appendSocks5Addr(b []byte, addr net.Addr) ([]byte, error) {
+	var host string
+	var port int
+
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		if ip4 := a.IP.To4(); ip4 != nil {
+			b = append(b, socks5AddrIPv4)
+			b = append(b, ip4...)
+		} else {
+			b = append(b, socks5AddrIPv6)
+			b = append(b, a.IP.To16()...)
+		}
+
+		return binary.BigEndian.AppendUint16(b, uint16(a.Port)), nil
+	case *socks5DomainAddr:
+		host = a.host
+		port = a.port
+	default:
+		return nil, fmt.Errorf("unsupported address type %T", addr)
+	}
+
+	if len(host) > 255 {
+		return nil, fmt.Errorf("hostname %s too long", host)
+	}
+
+	b = append(b, socks5AddrDomain, byte(len(host)))
+	b = append(b, host...)
+
+	return binary.BigEndian.AppendUint16(b, uint16(port)), nil
+}
+
+// socks5DomainAddr is a target address which is resolved by the proxy.
+type socks5DomainAddr struct {
+	host string
+	port int
+}
+
+func (a *socks5DomainAddr) Network() string {
+	return "udp"
+}
+
+func (a *socks5DomainAddr) String() string {
+	return net.JoinHostPort(a.host, strconv.Itoa(a.port))
+}
+
+// socks5PacketConn wraps every datagram in the socks5 UDP request header and exchanges it with the relay of the proxy.
+// It intentionally does not expose the methods of the underlying *net.UDPConn, otherwise QUIC would write to it directly.
+type socks5PacketConn struct {
+	conn    *net.UDPConn
+	control net.Conn
+	relay   *net.UDPAddr
+
+	readMu sync.Mutex
+	buf    []byte
+
+	closeOnce sync.Once
+}
+
+func (c *socks5PacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for {
+		n, from, err := c.conn.ReadFromUDP(c.buf)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		// only the relay is allowed to send datagrams to the association
+		if !from.IP.Equal(c.relay.IP) || from.Port != c.relay.Port {
+			continue
+		}
+
+		// RSV (2 bytes), FRAG (1 byte), address and port
+		if n < 4 || c.buf[2] != 0x00 {
+			// fragmented datagrams are not supported, QUIC recovers from the loss
+			continue
+		}
+
+		datagram := c.buf[3:n]
+		reader := bytes.NewReader(datagram)
+
+		addr, err := readSocks5Addr(reader)
+		if err != nil {
+			continue
+		}
+
+		return copy(p, datagram[len(datagram)-reader.Len():]), addr, nil
+	}
+}
+
+func (c *socks5PacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	datagram, err := appendSocks5Addr(make([]byte, 3, 3+1+1+255+2+len(p)), addr)
+	if err != nil {
+		return 0, err
+	}
+
+	datagram = append(datagram, p...)
+
+	if _, err := c.conn.WriteToUDP(datagram, c.relay); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (c *socks5PacketConn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		err = c.conn.Close()
+		_ = c.control.Close()
+	})
+
+	return err
+}
+
+func (c *socks5PacketConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *socks5PacketConn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *socks5PacketConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *socks5PacketConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetReadBuffer lets QUIC increase the buffer of the underlying socket.
+func (c *socks5PacketConn) SetReadBuffer(size int) error {
+	return c.conn.SetReadBuffer(size)
+}
+
+// SetWriteBuffer lets QUIC increase the buffer of the underlying socket.
+func (c *socks5PacketConn) SetWriteBuffer(size int) error {
+	return c.conn.SetWriteBuffer(size)
+}
+
+// closeWithControl closes the packet conn once the proxy closes the control connection, which ends the association.
+func (c *socks5PacketConn) closeWithControl() {
+	_, _ = io.Copy(io.Discard, c.control)
+	_ = c.Close()
+}
@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"io"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+// newAltSvcOrigin starts an https origin which advertises the alternative service in the Alt-Svc header of every response.
+func newAltSvcOrigin(t *testing.T, altSvc string) *httptest.Server {
+	t.Helper()
+
+	origin := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		w.Header().Set("Alt-Svc", altSvc)
+		_, _ = w.Write([]byte("origin"))
+	}))
+	origin.EnableHTTP2 = true
+	origin.StartTLS()
+	t.Cleanup(origin.Close)
+
+	return origin
+}
+
+func newAltSvcClient(t *testing.T, server *echoserver.Server, origin *httptest.Server, storage tls_client.AltSvcStorage) tls_client.HttpClient {
+	t.Helper()
+
+	// the alternative service has to present a certificate for the origin, the echo server has one for 127.0.0.1
+	rootCAs := server.RootCAs().Clone()
+	rootCAs.AddCert(origin.Certificate())
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: rootCAs}),
+		tls_client.WithAltSvcCache(storage),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func doOriginRequest(t *testing.T, client tls_client.HttpClient, url string) string {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func TestAltSvc_UpgradeToHTTP3(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	origin := newAltSvcOrigin(t, `h3=":`+strconv.Itoa(server.Port())+`"; ma=60`)
+	client := newAltSvcClient(t, server, origin, nil)
+
+	// the first request discovers the alternative service
+	assert.Equal(t, "origin", doOriginRequest(t, client, origin.URL))
+
+	req, err := http.NewRequest(http.MethodGet, origin.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echoResponse := doEchoRequest(t, client, req)
+	assert.Equal(t, "h3", echoResponse.HTTPVersion)
+}
+
+func TestAltSvc_FileStorage(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	origin := newAltSvcOrigin(t, `h3=":`+strconv.Itoa(server.Port())+`"`)
+	path := filepath.Join(t.TempDir(), "alt-svc.json")
+
+	storage, err := tls_client.NewFileAltSvcStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "origin", doOriginRequest(t, newAltSvcClient(t, server, origin, storage), origin.URL))
+
+	// a new client with the persisted alternatives uses HTTP/3 right away
+	storage, err = tls_client.NewFileAltSvcStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, origin.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echoResponse := doEchoRequest(t, newAltSvcClient(t, server, origin, storage), req)
+	assert.Equal(t, "h3", echoResponse.HTTPVersion)
+}
+
+func TestAltSvc_BrokenAlternativeFallsBackToTCP(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// nothing answers QUIC on the port of the alternative
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unusedPort := udpConn.LocalAddr().(*net.UDPAddr).Port
+	_ = udpConn.Close()
+
+	origin := newAltSvcOrigin(t, `h3=":`+strconv.Itoa(unusedPort)+`"`)
+	client := newAltSvcClient(t, server, origin, nil)
+
+	assert.Equal(t, "origin", doOriginRequest(t, client, origin.URL))
+
+	// the second request tries the alternative and is retried over TCP even though it is not idempotent, because the
+	// QUIC connection failed before it was sent
+	req, err := http.NewRequest(http.MethodPost, origin.URL, strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Do(req)
+	if assert.NoError(t, err) {
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// the third request skips the broken alternative
+	assert.Equal(t, "origin", doOriginRequest(t, client, origin.URL))
+}
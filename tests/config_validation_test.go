@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"net"
 	"strings"
 	"testing"
@@ -188,6 +189,67 @@ func TestConfigValidation_ProxyUrlAndDialerFactory(t *testing.T) {
 	t.Logf("✓ Correctly rejected config with error: %v", err)
 }
 
+func TestConfigValidation_ProxyChainWithoutLastProxy(t *testing.T) {
+	options := []tls_client.HttpClientOption{
+		tls_client.WithClientProfile(profiles.Chrome_133),
+		tls_client.WithProxyChain("socks5://jump.example.com:1080", ""),
+	}
+
+	_, err := tls_client.NewHttpClient(nil, options...)
+	if err == nil {
+		t.Fatal("Expected error when the last proxy of a proxy chain is empty, but got nil")
+	}
+
+	expectedMsg := "a proxy chain needs a proxy URL as its last proxy"
+	if !strings.Contains(err.Error(), expectedMsg) {
+		t.Fatalf("Expected error message to contain '%s', got: %v", expectedMsg, err)
+	}
+
+	t.Logf("✓ Correctly rejected config with error: %v", err)
+}
+
+func TestConfigValidation_HappyEyeballsWithDialContext(t *testing.T) {
+	options := []tls_client.HttpClientOption{
+		tls_client.WithClientProfile(profiles.Chrome_133),
+		tls_client.WithHappyEyeballs(nil),
+		tls_client.WithDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, nil
+		}),
+	}
+
+	_, err := tls_client.NewHttpClient(nil, options...)
+	if err == nil {
+		t.Fatal("Expected error when Happy Eyeballs is combined with a custom dial context, but got nil")
+	}
+
+	expectedMsg := "Happy Eyeballs cannot be used with a custom dial context"
+	if !strings.Contains(err.Error(), expectedMsg) {
+		t.Fatalf("Expected error message to contain '%s', got: %v", expectedMsg, err)
+	}
+
+	t.Logf("✓ Correctly rejected config with error: %v", err)
+}
+
+func TestConfigValidation_AltSvcCacheWithDisableHTTP3(t *testing.T) {
+	options := []tls_client.HttpClientOption{
+		tls_client.WithClientProfile(profiles.Chrome_133),
+		tls_client.WithAltSvcCache(nil),
+		tls_client.WithDisableHttp3(),
+	}
+
+	_, err := tls_client.NewHttpClient(nil, options...)
+	if err == nil {
+		t.Fatal("Expected error when the Alt-Svc cache is enabled with HTTP/3 disabled, but got nil")
+	}
+
+	expectedMsg := "the Alt-Svc cache cannot be used when HTTP/3 is disabled"
+	if !strings.Contains(err.Error(), expectedMsg) {
+		t.Fatalf("Expected error message to contain '%s', got: %v", expectedMsg, err)
+	}
+
+	t.Logf("✓ Correctly rejected config with error: %v", err)
+}
+
 func TestConfigValidation_ServerNameOverwriteWithInsecure(t *testing.T) {
 	options := []tls_client.HttpClientOption{
 		tls_client.WithClientProfile(profiles.Chrome_133),
@@ -282,3 +344,65 @@ func TestConfigValidation_OrderIndependent(t *testing.T) {
 		}
 	})
 }
+
+func TestConfigValidation_ECHConfigListWithoutECHProfile(t *testing.T) {
+	options := []tls_client.HttpClientOption{
+		tls_client.WithClientProfile(profiles.Safari_16_0),
+		tls_client.WithECHConfigList([]byte{0x00, 0x00}),
+	}
+
+	_, err := tls_client.NewHttpClient(nil, options...)
+	if err == nil {
+		t.Fatal("Expected error when ECH config lists are used with a client profile without ECH, but got nil")
+	}
+
+	expectedMsg := "ECH config lists need a client profile which sends the encrypted client hello extension"
+	if !strings.Contains(err.Error(), expectedMsg) {
+		t.Fatalf("Expected error message to contain '%s', got: %v", expectedMsg, err)
+	}
+
+	t.Logf("✓ Correctly rejected config with error: %v", err)
+}
+
+func TestConfigValidation_ResolverWithDialContext(t *testing.T) {
+	options := []tls_client.HttpClientOption{
+		tls_client.WithClientProfile(profiles.Chrome_133),
+		tls_client.WithResolver(net.DefaultResolver),
+		tls_client.WithDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, nil
+		}),
+	}
+
+	_, err := tls_client.NewHttpClient(nil, options...)
+	if err == nil {
+		t.Fatal("Expected error when a resolver is combined with a custom dial context, but got nil")
+	}
+
+	expectedMsg := "a resolver cannot be used with a custom dial context"
+	if !strings.Contains(err.Error(), expectedMsg) {
+		t.Fatalf("Expected error message to contain '%s', got: %v", expectedMsg, err)
+	}
+
+	t.Logf("✓ Correctly rejected config with error: %v", err)
+}
+
+func TestConfigValidation_ResolveOverridesWithoutPort(t *testing.T) {
+	options := []tls_client.HttpClientOption{
+		tls_client.WithClientProfile(profiles.Chrome_133),
+		tls_client.WithResolveOverrides(map[string][]net.IP{
+			"example.com": {net.IPv4(127, 0, 0, 1)},
+		}),
+	}
+
+	_, err := tls_client.NewHttpClient(nil, options...)
+	if err == nil {
+		t.Fatal("Expected error when a resolve override has no port, but got nil")
+	}
+
+	expectedMsg := "the resolve override \"example.com\" is no host:port"
+	if !strings.Contains(err.Error(), expectedMsg) {
+		t.Fatalf("Expected error message to contain '%s', got: %v", expectedMsg, err)
+	}
+
+	t.Logf("✓ Correctly rejected config with error: %v", err)
+}
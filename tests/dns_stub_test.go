@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStub is a local dns server which answers queries over UDP and TCP with the records of its zone.
+type dnsStub struct {
+	addr string
+	// zone maps lower case names with trailing dot to their records, a name without records is answered with NXDOMAIN
+	zone map[string][]dnsmessage.Resource
+	// truncate answers every query over UDP with a truncated response without records
+	truncate atomic.Bool
+	// queries is the number of queries over UDP and TCP
+	queries atomic.Int32
+}
+
+func newDNSStub(t *testing.T, zone map[string][]dnsmessage.Resource) *dnsStub {
+	t.Helper()
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = udpConn.Close() })
+
+	tcpListener, err := net.Listen("tcp", udpConn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tcpListener.Close() })
+
+	stub := &dnsStub{
+		addr: udpConn.LocalAddr().String(),
+		zone: zone,
+	}
+
+	go func() {
+		buf := make([]byte, 64*1024)
+
+		for {
+			n, addr, err := udpConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			if response := stub.answer(buf[:n], stub.truncate.Load()); response != nil {
+				_, _ = udpConn.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := tcpListener.Accept()
+			if err != nil {
+				return
+			}
+
+			go stub.serveStream(conn)
+		}
+	}()
+
+	return stub
+}
+
+// listenTLS answers queries over TLS with the config like a DNS-over-TLS server and returns the address of the listener.
+func (s *dnsStub) listenTLS(t *testing.T, config *tls.Config) string {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serveStream(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// serveStream answers the length prefixed queries on conn until it is closed.
+func (s *dnsStub) serveStream(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+
+		query := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		if response := s.answer(query, false); response != nil {
+			_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...))
+		}
+	}
+}
+
+func (s *dnsStub) answer(query []byte, truncate bool) []byte {
+	s.queries.Add(1)
+
+	var parser dnsmessage.Parser
+
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil
+	}
+
+	question, err := parser.Question()
+	if err != nil {
+		return nil
+	}
+
+	response := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 header.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   header.RecursionDesired,
+			RecursionAvailable: true,
+			Truncated:          truncate,
+		},
+		Questions: []dnsmessage.Question{question},
+	}
+
+	records, ok := s.zone[question.Name.String()]
+	if !ok {
+		response.RCode = dnsmessage.RCodeNameError
+	}
+
+	if !truncate {
+		for _, record := range records {
+			if record.Header.Type == question.Type || record.Header.Type == dnsmessage.TypeCNAME {
+				response.Answers = append(response.Answers, record)
+			}
+		}
+	}
+
+	packed, err := response.Pack()
+	if err != nil {
+		return nil
+	}
+
+	return packed
+}
+
+// newHTTPSResource returns an HTTPS record of the name with the params, which have to be sorted by key.
+func newHTTPSResource(name string, priority uint16, target string, params ...dnsmessage.SVCParam) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  dnsmessage.TypeHTTPS,
+			Class: dnsmessage.ClassINET,
+			TTL:   300,
+		},
+		Body: &dnsmessage.HTTPSResource{SVCBResource: dnsmessage.SVCBResource{
+			Priority: priority,
+			Target:   dnsmessage.MustNewName(target),
+			Params:   params,
+		}},
+	}
+}
+
+// newAddressResource returns an A record of the name for an IPv4 address and an AAAA record for an IPv6 address.
+func newAddressResource(name string, ttl uint32, ip net.IP) dnsmessage.Resource {
+	header := dnsmessage.ResourceHeader{
+		Name:  dnsmessage.MustNewName(name),
+		Class: dnsmessage.ClassINET,
+		TTL:   ttl,
+	}
+
+	if ipv4 := ip.To4(); ipv4 != nil {
+		header.Type = dnsmessage.TypeA
+		return dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte(ipv4)}}
+	}
+
+	header.Type = dnsmessage.TypeAAAA
+	return dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())}}
+}
+
+// svcParamALPN returns the alpn param with the protocols.
+func svcParamALPN(protocols ...string) dnsmessage.SVCParam {
+	var value []byte
+	for _, protocol := range protocols {
+		value = append(value, byte(len(protocol)))
+		value = append(value, protocol...)
+	}
+
+	return dnsmessage.SVCParam{Key: dnsmessage.SVCParamALPN, Value: value}
+}
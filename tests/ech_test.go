@@ -0,0 +1,129 @@
+package tests
+
+import (
+	stdtls "crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+// newECHServer returns a server with the ECH keys which answers with its server name and whether ECH was accepted.
+func newECHServer(t *testing.T, keys ...stdtls.EncryptedClientHelloKey) (*httptest.Server, *x509.CertPool) {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		_, _ = fmt.Fprintf(w, "%s %v", r.TLS.ServerName, r.TLS.ECHAccepted)
+	}))
+	server.TLS = &stdtls.Config{EncryptedClientHelloKeys: keys}
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server, server.Client().Transport.(*stdhttp.Transport).TLSClientConfig.RootCAs
+}
+
+// doECHRequest sends a request to the server and returns the body and the ECH status of the connection.
+func doECHRequest(t *testing.T, server *httptest.Server, options ...tls_client.HttpClientOption) (string, tls_client.ECHStatus) {
+	t.Helper()
+
+	// the certificate of the test server is valid for example.com, which is also the public name of the ECH configs
+	client, err := tls_client.NewHttpClient(nil, append([]tls_client.HttpClientOption{
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithServerNameOverwrite("example.com"),
+	}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var echStatus tls_client.ECHStatus
+	client.AddPostResponseHook(func(ctx *tls_client.PostResponseContext) error {
+		echStatus = ctx.ECHStatus
+		return nil
+	})
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body), echStatus
+}
+
+func TestECH_Accepted(t *testing.T) {
+	echKey, echConfigList := newECHKey(t, "example.com")
+	_, staleConfigList := newECHKey(t, "example.com")
+
+	echKey.SendAsRetry = false
+	server, rootCAs := newECHServer(t, echKey)
+
+	// the config list of the host takes precedence over the default one
+	body, echStatus := doECHRequest(t, server,
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: rootCAs}),
+		tls_client.WithECHConfigList(staleConfigList),
+		tls_client.WithHostECHConfigList("127.0.0.1", echConfigList),
+	)
+
+	assert.Equal(t, "example.com true", body)
+	assert.Equal(t, tls_client.ECHStatusAccepted, echStatus)
+}
+
+func TestECH_RetryConfigs(t *testing.T) {
+	echKey, _ := newECHKey(t, "example.com")
+	_, staleConfigList := newECHKey(t, "example.com")
+
+	server, rootCAs := newECHServer(t, echKey)
+
+	// the server rejects the stale config and the connection is retried with the retry configs of the server
+	body, echStatus := doECHRequest(t, server,
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: rootCAs}),
+		tls_client.WithECHConfigList(staleConfigList),
+	)
+
+	assert.Equal(t, "example.com true", body)
+	assert.Equal(t, tls_client.ECHStatusAccepted, echStatus)
+}
+
+func TestECH_RejectedWithoutRetryConfigs(t *testing.T) {
+	_, echConfigList := newECHKey(t, "example.com")
+
+	server, rootCAs := newECHServer(t)
+
+	// a server without ECH sends no retry configs, so the connection is retried without ECH
+	body, echStatus := doECHRequest(t, server,
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: rootCAs}),
+		tls_client.WithECHConfigList(echConfigList),
+	)
+
+	assert.Equal(t, "example.com false", body)
+	assert.Equal(t, tls_client.ECHStatusRejected, echStatus)
+}
+
+func TestECH_GREASE(t *testing.T) {
+	echKey, _ := newECHKey(t, "example.com")
+
+	server, rootCAs := newECHServer(t, echKey)
+
+	body, echStatus := doECHRequest(t, server, tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: rootCAs}))
+
+	assert.Equal(t, "example.com false", body)
+	assert.Equal(t, tls_client.ECHStatusGREASE, echStatus)
+}
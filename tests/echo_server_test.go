@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEchoServer_HTTP2(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_133),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL()+"/api/all", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header = http.Header{
+		"header2": {"value2"},
+		"header1": {"value1"},
+		http.HeaderOrderKey: {
+			"header1",
+			"header2",
+		},
+	}
+
+	echoResponse := doEchoRequest(t, client, req)
+
+	report, err := profiles.Chrome_133.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "h2", echoResponse.HTTPVersion)
+	assert.Equal(t, "/api/all", echoResponse.Path)
+	assert.Equal(t, "localhost", echoResponse.TLS.ServerName)
+	assert.Equal(t, report.JA3N, echoResponse.TLS.JA3N)
+	assert.Equal(t, report.JA4, echoResponse.TLS.JA4)
+	assert.Equal(t, report.Akamai, echoResponse.HTTP2.AkamaiFingerprint)
+	assert.Equal(t, report.AkamaiHash, echoResponse.HTTP2.AkamaiFingerprintHash)
+
+	var headers []string
+	for _, frame := range echoResponse.HTTP2.SentFrames {
+		if frame.FrameType == "HEADERS" {
+			headers = frame.Headers
+		}
+	}
+
+	if assert.GreaterOrEqual(t, len(headers), 6) {
+		assert.Equal(t, "header1: value1", headers[4])
+		assert.Equal(t, "header2: value2", headers[5])
+	}
+}
+
+func TestEchoServer_HTTP1(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Firefox_102),
+		tls_client.WithForceHttp1(),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header = http.Header{
+		"X-Second": {"value2"},
+		"X-First":  {"value1"},
+		http.HeaderOrderKey: {
+			"X-First",
+			"X-Second",
+		},
+	}
+
+	echoResponse := doEchoRequest(t, client, req)
+
+	assert.Equal(t, "HTTP/1.1", echoResponse.HTTPVersion)
+	assert.Equal(t, "TLS 1.3", echoResponse.TLS.TLSVersionNegotiated)
+	assert.NotContains(t, echoResponse.TLS.ALPNProtocols, "h2")
+	assert.Contains(t, echoResponse.HTTP1.Headers, "X-First: value1")
+	assert.Contains(t, echoResponse.HTTP1.Headers, "X-Second: value2")
+}
+
+func TestEchoServer_HTTP3(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_144),
+		tls_client.WithProtocolRacing(),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echoResponse := doEchoRequest(t, client, req)
+	if echoResponse.HTTPVersion != "h3" {
+		t.Skipf("protocol racing selected %s", echoResponse.HTTPVersion)
+	}
+
+	assert.Equal(t, "localhost", echoResponse.TLS.ServerName)
+	assert.Contains(t, echoResponse.TLS.ALPNProtocols, "h3")
+	assert.NotEmpty(t, echoResponse.TLS.JA4)
+	assert.NotEmpty(t, echoResponse.HTTP3.Settings)
+	assert.Contains(t, echoResponse.HTTP3.Headers, ":method: GET")
+}
+
+func doEchoRequest(t *testing.T, client tls_client.HttpClient, req *http.Request) echoserver.Response {
+	t.Helper()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	readBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echoResponse := echoserver.Response{}
+	if err := json.Unmarshal(readBytes, &echoResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	return echoResponse
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bogdanfinn/tls-client/profiles"
+	tls "github.com/bogdanfinn/utls"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprintReport_Firefox(t *testing.T) {
+	expected := clientFingerprints[firefox][tls.HelloFirefox_102.Str()]
+
+	report, err := profiles.Firefox_102.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expected[ja3String], report.JA3)
+	assert.Equal(t, expected[ja3Hash], report.JA3Hash)
+	assert.Equal(t, expected[akamaiFingerprint], report.Akamai)
+	assert.Equal(t, expected[akamaiFingerprintHash], report.AkamaiHash)
+}
+
+func TestFingerprintReport_Chrome(t *testing.T) {
+	expected := clientFingerprints[chrome][profiles.Chrome_133.GetClientHelloStr()]
+
+	report, err := profiles.Chrome_133.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// chrome shuffles its extensions, therefore only the sorted ja3n is stable.
+	// the profile advertises h3 in the alpn extension unless http3 is disabled on the client
+	assert.Equal(t, sortJa3Extensions(expected[ja3String]), report.JA3N)
+	assert.Equal(t, expected[akamaiFingerprint], report.Akamai)
+	assert.Equal(t, expected[akamaiFingerprintHash], report.AkamaiHash)
+	assert.True(t, strings.HasPrefix(report.JA4, "t13d1516h3_8daaf6152771_"), report.JA4)
+	assert.True(t, strings.HasPrefix(report.JA4R, "t13d1516h3_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_"), report.JA4R)
+}
+
+func TestFingerprintReport_AllMappedProfiles(t *testing.T) {
+	for name, profile := range profiles.MappedTLSClients {
+		report, err := profile.GetFingerprintReport()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		assert.NotEmpty(t, report.JA3, name)
+		assert.NotEmpty(t, report.JA4, name)
+	}
+}
+
+func sortJa3Extensions(ja3 string) string {
+	parts := strings.Split(ja3, ",")
+	extensions := strings.Split(parts[2], "-")
+
+	sort.Slice(extensions, func(i, j int) bool {
+		a, _ := strconv.Atoi(extensions[i])
+		b, _ := strconv.Atoi(extensions[j])
+
+		return a < b
+	})
+
+	parts[2] = strings.Join(extensions, "-")
+
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHappyEyeballs_ConnectionInfo(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithHappyEyeballs(&tls_client.HappyEyeballsOptions{PreferredFamily: tls_client.AddressFamilyIPv4}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var connectionInfo *tls_client.ConnectionInfo
+	client.AddPostResponseHook(func(ctx *tls_client.PostResponseContext) error {
+		connectionInfo = ctx.ConnectionInfo
+		return nil
+	})
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doEchoRequest(t, client, req)
+
+	// the echo server only listens on 127.0.0.1, so ipv4 wins the race for localhost
+	if assert.NotNil(t, connectionInfo) {
+		assert.Equal(t, tls_client.AddressFamilyIPv4, connectionInfo.Family)
+		assert.Equal(t, "127.0.0.1", connectionInfo.RemoteAddr.IP.String())
+		assert.Equal(t, server.Port(), connectionInfo.RemoteAddr.Port)
+		assert.GreaterOrEqual(t, connectionInfo.Attempts, 1)
+	}
+}
+
+func TestHappyEyeballs_WithoutOption(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hookCalled := false
+	client.AddPostResponseHook(func(ctx *tls_client.PostResponseContext) error {
+		hookCalled = true
+		assert.Nil(t, ctx.ConnectionInfo)
+		return nil
+	})
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doEchoRequest(t, client, req)
+	assert.True(t, hookCalled)
+}
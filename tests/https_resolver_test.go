@@ -0,0 +1,277 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	stdtls "crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var svcParamIPv4HintLocalhost = dnsmessage.SVCParam{Key: dnsmessage.SVCParamIPv4Hint, Value: []byte{127, 0, 0, 1}}
+
+// newECHKey returns an ECH key for the server and the ECHConfigList with its config for the client.
+func newECHKey(t *testing.T, publicName string) (stdtls.EncryptedClientHelloKey, []byte) {
+	t.Helper()
+
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey := privateKey.PublicKey().Bytes()
+
+	// ECHConfigContents with the config id, DHKEM(X25519, HKDF-SHA256) and HKDF-SHA256 with AES-128-GCM
+	contents := []byte{1, 0x00, 0x20}
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(publicKey)))
+	contents = append(contents, publicKey...)
+	contents = append(contents, 0x00, 0x04, 0x00, 0x01, 0x00, 0x01)
+	contents = append(contents, 0, byte(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = append(contents, 0x00, 0x00)
+
+	config := binary.BigEndian.AppendUint16([]byte{0xfe, 0x0d}, uint16(len(contents)))
+	config = append(config, contents...)
+
+	configList := binary.BigEndian.AppendUint16(nil, uint16(len(config)))
+	configList = append(configList, config...)
+
+	return stdtls.EncryptedClientHelloKey{Config: config, PrivateKey: privateKey.Bytes(), SendAsRetry: true}, configList
+}
+
+// newDNSHTTPSResolver returns an HTTPSResolver which queries the DNS server at the address.
+func newDNSHTTPSResolver(t *testing.T, server string) tls_client.HTTPSResolver {
+	t.Helper()
+
+	resolver, err := tls_client.NewDNSHTTPSResolver(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resolver
+}
+
+func TestDNSHTTPSResolver(t *testing.T) {
+	stub := newDNSStub(t, map[string][]dnsmessage.Resource{
+		"example.com.": {
+			newHTTPSResource("example.com.", 2, "svc.example.com.", svcParamALPN("h2")),
+			newHTTPSResource("example.com.", 1, ".",
+				svcParamALPN("h3", "h2"),
+				dnsmessage.SVCParam{Key: dnsmessage.SVCParamPort, Value: []byte{0x20, 0xfb}},
+				svcParamIPv4HintLocalhost,
+				dnsmessage.SVCParam{Key: dnsmessage.SVCParamECH, Value: []byte{0x00, 0x01, 0x02}},
+				dnsmessage.SVCParam{Key: dnsmessage.SVCParamIPv6Hint, Value: net.ParseIP("::1")},
+			),
+		},
+		"alias.example.com.": {
+			newHTTPSResource("alias.example.com.", 0, "example.net."),
+		},
+		"example.net.": {
+			newHTTPSResource("example.net.", 1, ".", svcParamALPN("h2")),
+		},
+	})
+
+	resolver := newDNSHTTPSResolver(t, stub.addr)
+
+	records, err := resolver.LookupHTTPS(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the records are sorted by priority
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, tls_client.HTTPSRecord{
+			Priority:      1,
+			ALPN:          []string{"h3", "h2"},
+			Port:          8443,
+			IPv4Hint:      []net.IP{net.IPv4(127, 0, 0, 1).To4()},
+			IPv6Hint:      []net.IP{net.ParseIP("::1")},
+			ECHConfigList: []byte{0x00, 0x01, 0x02},
+		}, records[0])
+		assert.Equal(t, "svc.example.com", records[1].Target)
+	}
+
+	// the records are cached for their TTL
+	_, err = resolver.LookupHTTPS(context.Background(), "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), stub.queries.Load())
+
+	// an alias is followed to the records of its target
+	records, err = resolver.LookupHTTPS(context.Background(), "alias.example.com")
+	if assert.NoError(t, err) && assert.Len(t, records, 1) {
+		assert.Equal(t, "example.net", records[0].Target)
+		assert.Equal(t, []string{"h2"}, records[0].ALPN)
+	}
+
+	records, err = resolver.LookupHTTPS(context.Background(), "unknown.example.com")
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestDNSHTTPSResolver_TruncatedResponse(t *testing.T) {
+	stub := newDNSStub(t, map[string][]dnsmessage.Resource{
+		"example.com.": {newHTTPSResource("example.com.", 1, ".", svcParamALPN("h2"))},
+	})
+	stub.truncate.Store(true)
+
+	records, err := newDNSHTTPSResolver(t, stub.addr).LookupHTTPS(context.Background(), "example.com")
+	if assert.NoError(t, err) && assert.Len(t, records, 1) {
+		assert.Equal(t, []string{"h2"}, records[0].ALPN)
+	}
+
+	// the truncated response over UDP is repeated over TCP
+	assert.Equal(t, int32(2), stub.queries.Load())
+}
+
+func TestHTTPSRecord_AddressHints(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	testCases := []struct {
+		name                string
+		alpn                []string
+		expectedHTTPVersion string
+	}{
+		{"h2", []string{"h2"}, "h2"},
+		{"h3", []string{"h3", "h2"}, "h3"},
+	}
+
+	for _, testCase := range testCases {
+		// the host only resolves with the address hint of its HTTPS record
+		stub := newDNSStub(t, map[string][]dnsmessage.Resource{
+			"svc.test.": {newHTTPSResource("svc.test.", 1, ".", svcParamALPN(testCase.alpn...), svcParamIPv4HintLocalhost)},
+		})
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithClientProfile(profiles.Chrome_146),
+			tls_client.WithInsecureSkipVerify(),
+			tls_client.WithHTTPSResolver(newDNSHTTPSResolver(t, stub.addr)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "https://svc.test:"+strconv.Itoa(server.Port()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		echoResponse := doEchoRequest(t, client, req)
+		assert.Equal(t, testCase.expectedHTTPVersion, echoResponse.HTTPVersion, testCase.name)
+	}
+}
+
+func TestHTTPSRecord_BehindProxy(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	proxy := newConnectProxy(t)
+
+	testCases := []struct {
+		name            string
+		options         []tls_client.HttpClientOption
+		expectedQueries bool
+	}{
+		{"proxy", nil, false},
+		{"behind proxy", []tls_client.HttpClientOption{tls_client.WithHTTPSResolverBehindProxy()}, true},
+	}
+
+	for _, testCase := range testCases {
+		stub := newDNSStub(t, map[string][]dnsmessage.Resource{
+			"localhost.": {newHTTPSResource("localhost.", 1, ".", svcParamALPN("h2"))},
+		})
+
+		client, err := tls_client.NewHttpClient(nil, append([]tls_client.HttpClientOption{
+			tls_client.WithClientProfile(profiles.Chrome_146),
+			tls_client.WithInsecureSkipVerify(),
+			tls_client.WithProxyUrl(proxy.url),
+			tls_client.WithHTTPSResolver(newDNSHTTPSResolver(t, stub.addr)),
+		}, testCase.options...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "https://localhost:"+strconv.Itoa(server.Port()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = doEchoRequest(t, client, req)
+
+		// the records are not looked up outside of the proxy unless the client opts in
+		assert.Equal(t, testCase.expectedQueries, stub.queries.Load() > 0, testCase.name)
+	}
+}
+
+func TestHTTPSRecord_ECH(t *testing.T) {
+	echKey, echConfigList := newECHKey(t, "public.example.com")
+
+	server := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		_, _ = fmt.Fprintf(w, "%s %v", r.TLS.ServerName, r.TLS.ECHAccepted)
+	}))
+	server.TLS = &stdtls.Config{EncryptedClientHelloKeys: []stdtls.EncryptedClientHelloKey{echKey}}
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	stub := newDNSStub(t, map[string][]dnsmessage.Resource{
+		"example.com.": {newHTTPSResource("example.com.", 1, ".",
+			svcParamALPN("h2"),
+			svcParamIPv4HintLocalhost,
+			dnsmessage.SVCParam{Key: dnsmessage.SVCParamECH, Value: echConfigList},
+		)},
+	})
+
+	rootCAs := server.Client().Transport.(*stdhttp.Transport).TLSClientConfig.RootCAs
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: rootCAs}),
+		tls_client.WithHTTPSResolver(newDNSHTTPSResolver(t, stub.addr)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificate of the test server is valid for example.com
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com:"+port, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server decrypted the inner ClientHello with the server name of the origin
+	assert.Equal(t, "example.com true", string(body))
+}
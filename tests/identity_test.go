@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentity_DefaultHeaders(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithDefaultHeaders(http.Header{
+			"Accept-Language": {"de-DE,de;q=0.9"},
+			"x-custom":        {"custom"},
+		}),
+		tls_client.WithIdentity(profiles.Chrome_146_Identity, profiles.RequestTypeNavigation),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echoResponse := doEchoRequest(t, client, req)
+
+	report, err := profiles.Chrome_146.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, report.JA4, echoResponse.TLS.JA4)
+
+	var headers []string
+	for _, frame := range echoResponse.HTTP2.SentFrames {
+		if frame.FrameType == "HEADERS" {
+			headers = frame.Headers
+		}
+	}
+
+	if len(headers) < 4 {
+		t.Fatalf("missing headers: %v", headers)
+	}
+
+	expected := []string{
+		`sec-ch-ua: "Chromium";v="146", "Not-A.Brand";v="24", "Google Chrome";v="146"`,
+		"sec-ch-ua-mobile: ?0",
+		`sec-ch-ua-platform: "Windows"`,
+		"upgrade-insecure-requests: 1",
+		"user-agent: " + profiles.Chrome_146_Identity.GetUserAgent(),
+		"accept: text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+		"sec-fetch-site: none",
+		"sec-fetch-mode: navigate",
+		"sec-fetch-user: ?1",
+		"sec-fetch-dest: document",
+		"accept-encoding: gzip, deflate, br, zstd",
+		"accept-language: de-DE,de;q=0.9",
+		"priority: u=0, i",
+		"x-custom: custom",
+	}
+
+	assert.Equal(t, expected, headers[4:])
+}
+
+func TestIdentity_RequestType(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithDefaultHeaders(http.Header{"Accept-Language": {"de-DE,de;q=0.9"}}),
+		tls_client.WithIdentity(profiles.Chrome_146_Identity, profiles.RequestTypeNavigation),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(ctx context.Context) map[string]string {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		echoResponse := doEchoRequest(t, client, req)
+
+		headers := make(map[string]string)
+		for _, frame := range echoResponse.HTTP2.SentFrames {
+			if frame.FrameType != "HEADERS" {
+				continue
+			}
+
+			for _, header := range frame.Headers {
+				name, value, _ := strings.Cut(header, ": ")
+				headers[name] = value
+			}
+		}
+
+		return headers
+	}
+
+	headers := request(context.WithValue(context.Background(), tls_client.ContextKeyRequestType{}, profiles.RequestTypeFetch))
+	assert.Equal(t, "cors", headers["sec-fetch-mode"])
+	assert.Equal(t, "*/*", headers["accept"])
+	assert.Equal(t, "de-DE,de;q=0.9", headers["accept-language"])
+
+	// requests without request type use the one of the client
+	headers = request(context.Background())
+	assert.Equal(t, "navigate", headers["sec-fetch-mode"])
+	assert.Equal(t, "de-DE,de;q=0.9", headers["accept-language"])
+}
+
+func TestIdentity_GetHeaders(t *testing.T) {
+	identity := profiles.Firefox_147_Identity
+
+	fetchHeaders := identity.GetHeaders(profiles.RequestTypeFetch)
+	assert.Equal(t, []string{"cors"}, fetchHeaders["sec-fetch-mode"])
+
+	// the returned headers are a copy
+	fetchHeaders["sec-fetch-mode"] = []string{"navigate"}
+	assert.Equal(t, []string{"cors"}, identity.GetHeaders(profiles.RequestTypeFetch)["sec-fetch-mode"])
+
+	// unknown request types fall back to navigation
+	assert.Equal(t, identity.GetHeaders(profiles.RequestTypeNavigation), identity.GetHeaders("websocket"))
+}
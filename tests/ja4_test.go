@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	tls "github.com/bogdanfinn/utls"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJA4(t *testing.T) {
+	testCases := []struct {
+		name           string
+		profile        profiles.ClientProfile
+		keyShareCurves []string
+	}{
+		{"chrome 146", profiles.Chrome_146, []string{"GREASE", "X25519MLKEM768", "X25519"}},
+		{"firefox 147", profiles.Firefox_147, []string{"X25519MLKEM768", "X25519", "P256"}},
+		{"safari ios 18.5", profiles.Safari_IOS_18_5, []string{"GREASE", "X25519"}},
+	}
+
+	for _, testCase := range testCases {
+		expected, err := testCase.profile.GetFingerprintReport()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		specFactory, err := tls_client.GetSpecFactoryFromJa4String(expected.JA4R, nil, testCase.keyShareCurves, nil, nil)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.name, err)
+			continue
+		}
+
+		actual, err := ja4Profile(specFactory).GetFingerprintReport()
+		if err != nil {
+			t.Errorf("%s: %v", testCase.name, err)
+			continue
+		}
+
+		assert.Equal(t, expected.JA4, actual.JA4, testCase.name)
+		assert.Equal(t, expected.JA4R, actual.JA4R, testCase.name)
+	}
+}
+
+func TestJA4_Handshake(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	expected, err := profiles.Chrome_146.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specFactory, err := tls_client.GetSpecFactoryFromJa4String(expected.JA4R, nil, []string{"GREASE", "X25519MLKEM768", "X25519"}, nil, []string{"brotli"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(ja4Profile(specFactory)),
+		tls_client.WithRandomTLSExtensionOrder(),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echoResponse := doEchoRequest(t, client, req)
+
+	assert.Equal(t, expected.JA4, echoResponse.TLS.JA4)
+}
+
+func TestJA4_InvalidInput(t *testing.T) {
+	inputs := []string{
+		// hashed ja4
+		"t13d1517h2_8daaf6152771_dcad5a053991",
+		// wrong cipher count
+		"t13d0302h2_1301,1302_000a",
+		// quic
+		"q13d0101h3_1301_000a",
+		"t13d0101h2_zzzz_000a",
+		"",
+	}
+
+	for _, input := range inputs {
+		_, err := tls_client.GetSpecFactoryFromJa4String(input, nil, nil, nil, nil)
+		assert.Error(t, err, input)
+	}
+
+	// the ja4 string has no alpn extension
+	_, err := tls_client.GetSpecFactoryFromJa4String("t13d010200_1301_000a", nil, nil, nil, nil)
+	assert.NoError(t, err)
+
+	_, err = tls_client.GetSpecFactoryFromJa4String("t13d010200_1301_000a", nil, nil, []string{"h2"}, nil)
+	assert.Error(t, err)
+}
+
+func ja4Profile(specFactory func() (tls.ClientHelloSpec, error)) profiles.ClientProfile {
+	base := profiles.Chrome_146
+
+	return profiles.NewClientProfile(tls.ClientHelloID{
+		Client:      "Custom",
+		Version:     "1",
+		SpecFactory: specFactory,
+	}, base.GetSettings(), base.GetSettingsOrder(), base.GetPseudoHeaderOrder(), base.GetConnectionFlow(), base.GetPriorities(), base.GetHeaderPriority(), base.GetStreamID(), base.GetAllowHTTP(), nil, nil, 0, nil, false)
+}
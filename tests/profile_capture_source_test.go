@@ -0,0 +1,102 @@
+//go:build toolchain
+
+// The tests in this file build and run code with the go command, run them with: go test -tags toolchain ./tests
+
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileCapture_SourceRun(t *testing.T) {
+	captured, source := capturedProfileSource(t)
+
+	expected, err := captured.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expectedHTTP3 bytes.Buffer
+	_, _ = fmt.Fprintf(&expectedHTTP3, "%v %v %d %v %t", captured.GetHttp3Settings(), captured.GetHttp3SettingsOrder(),
+		captured.GetHttp3PriorityParam(), captured.GetHttp3PseudoHeaderOrder(), captured.GetHttp3SendGreaseFrames())
+
+	output := runWithProfileFile(t, profileSourceFile(source), `package main
+
+import (
+	"fmt"
+
+	"github.com/bogdanfinn/tls-client/profiles"
+)
+
+func main() {
+	report, err := profiles.Captured_1.GetFingerprintReport()
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(report.JA3)
+	fmt.Println(report.Akamai)
+	fmt.Printf("%v %v %d %v %t\n", profiles.Captured_1.GetHttp3Settings(), profiles.Captured_1.GetHttp3SettingsOrder(),
+		profiles.Captured_1.GetHttp3PriorityParam(), profiles.Captured_1.GetHttp3PseudoHeaderOrder(), profiles.Captured_1.GetHttp3SendGreaseFrames())
+}
+`)
+
+	assert.Equal(t, []string{expected.JA3, expected.Akamai, expectedHTTP3.String()}, strings.Split(strings.TrimSpace(output), "\n"))
+}
+
+// runWithProfileFile runs the main package with the additional file in the profiles package and returns its output.
+// Both files are only added with an overlay, the source tree stays untouched.
+func runWithProfileFile(t *testing.T, file string, mainFile string) string {
+	t.Helper()
+
+	goBinary, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go command is not available")
+	}
+
+	moduleDir, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	replace := map[string]string{
+		filepath.Join(moduleDir, "profiles", "zz_captured.go"):          filepath.Join(dir, "captured.go"),
+		filepath.Join(moduleDir, "tests", "capturedprofile", "main.go"): filepath.Join(dir, "main.go"),
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "captured.go"), []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(mainFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	overlay, err := json.Marshal(map[string]any{"Replace": replace})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "overlay.json"), overlay, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(goBinary, "run", "-overlay", filepath.Join(dir, "overlay.json"), "./capturedprofile")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to run the generated profile: %v\n%s", err, output)
+	}
+
+	return string(output)
+}
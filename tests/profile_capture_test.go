@@ -0,0 +1,395 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bogdanfinn/fhttp/http2"
+	"github.com/bogdanfinn/fhttp/http2/hpack"
+	"github.com/bogdanfinn/tls-client/profiles"
+	tls "github.com/bogdanfinn/utls"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileCapture(t *testing.T) {
+	testCases := []struct {
+		name    string
+		profile profiles.ClientProfile
+	}{
+		{"chrome 146", profiles.Chrome_146},
+		{"firefox 147", profiles.Firefox_147},
+		{"safari ios 18.5", profiles.Safari_IOS_18_5},
+	}
+
+	for _, testCase := range testCases {
+		clientHello := captureClientHello(t, testCase.profile)
+		preface := captureHTTP2Preface(t, testCase.profile)
+
+		expected, err := testCase.profile.GetFingerprintReport()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// bare handshake message and tls record
+		for _, input := range [][]byte{clientHello, clientHelloRecords(clientHello, len(clientHello))} {
+			captured, err := profiles.NewClientProfileFromCapture("Captured", "1", input, preface)
+			if err != nil {
+				t.Errorf("%s: %v", testCase.name, err)
+				continue
+			}
+
+			actual, err := captured.GetFingerprintReport()
+			if err != nil {
+				t.Errorf("%s: %v", testCase.name, err)
+				continue
+			}
+
+			assert.Equal(t, expected.JA3N, actual.JA3N, testCase.name)
+			assert.Equal(t, expected.JA4, actual.JA4, testCase.name)
+			assert.Equal(t, expected.Akamai, actual.Akamai, testCase.name)
+			assert.Equal(t, testCase.profile.GetHeaderPriority(), captured.GetHeaderPriority(), testCase.name)
+		}
+	}
+}
+
+func TestProfileCapture_SplitRecords(t *testing.T) {
+	clientHello := captureClientHello(t, profiles.Chrome_146)
+
+	captured, err := profiles.NewClientProfileFromCapture("Captured", "1", clientHelloRecords(clientHello, 100), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := profiles.Chrome_146.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := captured.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expected.JA4, actual.JA4)
+
+	_, err = profiles.NewClientProfileFromCapture("Captured", "1", clientHelloRecords(clientHello, 100)[:200], nil)
+	assert.ErrorIs(t, err, profiles.ErrNoClientHello)
+}
+
+func TestProfileCapture_Pcap(t *testing.T) {
+	clientHello := captureClientHello(t, profiles.Chrome_146)
+	record := clientHelloRecords(clientHello, len(clientHello))
+
+	expected, err := profiles.Chrome_146.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, capture := range map[string][]byte{
+		"pcap":   pcapFile(tcpPackets(record)),
+		"pcapng": pcapngFile(tcpPackets(record)),
+	} {
+		actualRecord, err := profiles.ReadClientHelloFromPcap(bytes.NewReader(capture))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		assert.Equal(t, record, actualRecord, name)
+
+		captured, err := profiles.NewClientProfileFromPcap("Captured", "1", bytes.NewReader(capture), captureHTTP2Preface(t, profiles.Chrome_146))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		actual, err := captured.GetFingerprintReport()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		assert.Equal(t, expected.JA4, actual.JA4, name)
+		assert.Equal(t, expected.Akamai, actual.Akamai, name)
+	}
+
+	_, err = profiles.ReadClientHelloFromPcap(bytes.NewReader(pcapFile(nil)))
+	assert.ErrorIs(t, err, profiles.ErrNoClientHello)
+}
+
+func TestProfileCapture_Source(t *testing.T) {
+	captured, source := capturedProfileSource(t)
+
+	assert.Contains(t, source, "var Captured_1 = ClientProfile{")
+	assert.Contains(t, source, "tls.TLS_AES_128_GCM_SHA256,")
+	assert.Contains(t, source, "tls.BoringGREASEECH(),")
+	assert.Contains(t, source, "http2.SettingInitialWindowSize: 6291456,")
+	assert.Contains(t, source, "connectionFlow: 15663105,")
+	assert.Contains(t, source, "0x1: 65536, // SETTINGS_QPACK_MAX_TABLE_CAPACITY")
+
+	checkProfilesPackage(t, profileSourceFile(source))
+
+	var invalid strings.Builder
+	err := profiles.WriteProfileSource(&invalid, "invalid name", captured)
+	assert.Error(t, err)
+}
+
+// capturedProfileSource returns a profile captured from Chrome 146 and its source as Captured_1.
+func capturedProfileSource(t *testing.T) (profiles.ClientProfile, string) {
+	t.Helper()
+
+	captured, err := profiles.NewClientProfileFromCapture("Captured", "1", captureClientHello(t, profiles.Chrome_146), captureHTTP2Preface(t, profiles.Chrome_146))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a capture has no HTTP/3 settings, they are added to make sure they are written as well
+	captured = profiles.NewClientProfile(captured.GetClientHelloId(), captured.GetSettings(), captured.GetSettingsOrder(),
+		captured.GetPseudoHeaderOrder(), captured.GetConnectionFlow(), captured.GetPriorities(), captured.GetHeaderPriority(),
+		captured.GetStreamID(), captured.GetAllowHTTP(), profiles.Chrome_144.GetHttp3Settings(), profiles.Chrome_144.GetHttp3SettingsOrder(),
+		profiles.Chrome_144.GetHttp3PriorityParam(), profiles.Chrome_144.GetHttp3PseudoHeaderOrder(), profiles.Chrome_144.GetHttp3SendGreaseFrames())
+
+	var source strings.Builder
+	if err := profiles.WriteProfileSource(&source, "Captured_1", captured); err != nil {
+		t.Fatal(err)
+	}
+
+	return captured, source.String()
+}
+
+// profileSourceFile returns the generated source as a file of the profiles package. The generated code uses the
+// unexported fields of ClientProfile, so it only builds as part of the profiles package.
+func profileSourceFile(source string) string {
+	return "package profiles\n\n" +
+		"import (\n\t\"github.com/bogdanfinn/fhttp/http2\"\n\ttls \"github.com/bogdanfinn/utls\"\n\t\"github.com/bogdanfinn/utls/dicttls\"\n)\n\n" +
+		"var _ = http2.SettingHeaderTableSize\nvar _ = tls.GREASE_PLACEHOLDER\nvar _ = dicttls.HKDF_SHA256\n\n" +
+		source
+}
+
+// checkProfilesPackage type checks the profiles package with the additional file. The imports are type checked
+// from their source.
+func checkProfilesPackage(t *testing.T, file string) {
+	t.Helper()
+
+	fset := token.NewFileSet()
+
+	paths, err := filepath.Glob("../profiles/*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []*ast.File
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+
+		parsed, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files = append(files, parsed)
+	}
+
+	parsed, err := parser.ParseFile(fset, "captured.go", file, parser.AllErrors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+
+	if _, err := config.Check("github.com/bogdanfinn/tls-client/profiles", fset, append(files, parsed), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// captureClientHello returns the ClientHello handshake message of the profile like it is sent on the wire.
+func captureClientHello(t *testing.T, profile profiles.ClientProfile) []byte {
+	spec, err := profile.GetClientHelloSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uconn := tls.UClient(nil, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true, OmitEmptyPsk: true}, tls.HelloCustom, false, false, false)
+	if err := uconn.ApplyPreset(&spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := uconn.BuildHandshakeState(); err != nil {
+		t.Fatal(err)
+	}
+
+	return uconn.HandshakeState.Hello.Raw
+}
+
+// captureHTTP2Preface returns the frames the profile sends before the first request is answered.
+func captureHTTP2Preface(t *testing.T, profile profiles.ClientProfile) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(http2.ClientPreface)
+
+	framer := http2.NewFramer(&buf, nil)
+
+	var settings []http2.Setting
+	for _, id := range profile.GetSettingsOrder() {
+		settings = append(settings, http2.Setting{ID: id, Val: profile.GetSettings()[id]})
+	}
+
+	if err := framer.WriteSettings(settings...); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := framer.WriteWindowUpdate(0, profile.GetConnectionFlow()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, priority := range profile.GetPriorities() {
+		if err := framer.WritePriority(priority.StreamID, priority.PriorityParam); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pseudoHeaders := map[string]string{":method": "GET", ":authority": "example.com", ":scheme": "https", ":path": "/"}
+
+	var headerBlock bytes.Buffer
+	encoder := hpack.NewEncoder(&headerBlock)
+	for _, pseudoHeader := range profile.GetPseudoHeaderOrder() {
+		_ = encoder.WriteField(hpack.HeaderField{Name: pseudoHeader, Value: pseudoHeaders[pseudoHeader]})
+	}
+	_ = encoder.WriteField(hpack.HeaderField{Name: "accept", Value: "*/*"})
+
+	streamID := profile.GetStreamID()
+	if streamID == 0 {
+		streamID = 1
+	}
+
+	headers := http2.HeadersFrameParam{StreamID: streamID, BlockFragment: headerBlock.Bytes(), EndStream: true, EndHeaders: true}
+	if profile.GetHeaderPriority() != nil {
+		headers.Priority = *profile.GetHeaderPriority()
+	}
+
+	if err := framer.WriteHeaders(headers); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// clientHelloRecords splits the handshake message into TLS records with at most recordSize bytes of payload.
+func clientHelloRecords(handshake []byte, recordSize int) []byte {
+	var records []byte
+	for len(handshake) > 0 {
+		n := min(recordSize, len(handshake))
+		records = append(records, 0x16, 0x03, 0x01, byte(n>>8), byte(n))
+		records = append(records, handshake[:n]...)
+		handshake = handshake[n:]
+	}
+
+	return records
+}
+
+// tcpPackets returns ethernet frames of a connection which sends the payload in three segments, the last segment first.
+// A packet of an unrelated connection without a ClientHello is captured before.
+func tcpPackets(payload []byte) [][]byte {
+	third := len(payload) / 3
+
+	return [][]byte{
+		ethernetPacket(40000, 1000, []byte("GET / HTTP/1.1\r\n\r\n")),
+		ethernetPacket(50000, 0xfffffff0+uint32(2*third), payload[2*third:]),
+		ethernetPacket(50000, 0xfffffff0, payload[:third]),
+		ethernetPacket(50000, 0xfffffff0+uint32(third), payload[third:2*third]),
+	}
+}
+
+func ethernetPacket(srcPort uint16, seq uint32, payload []byte) []byte {
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:2], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:4], 443)
+	binary.BigEndian.PutUint32(tcp[4:8], seq)
+	tcp[12] = 5 << 4
+	tcp[13] = 0x18
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(len(ip)+len(tcp)+len(payload)))
+	ip[8] = 64
+	ip[9] = 6
+	copy(ip[12:16], []byte{192, 168, 0, 2})
+	copy(ip[16:20], []byte{192, 168, 0, 1})
+
+	ethernet := make([]byte, 14)
+	binary.BigEndian.PutUint16(ethernet[12:14], 0x0800)
+
+	packet := append(ethernet, ip...)
+	packet = append(packet, tcp...)
+
+	return append(packet, payload...)
+}
+
+func pcapFile(packets [][]byte) []byte {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], 65535)
+	binary.LittleEndian.PutUint32(header[20:24], 1)
+
+	file := header
+	for _, packet := range packets {
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[8:12], uint32(len(packet)))
+		binary.LittleEndian.PutUint32(record[12:16], uint32(len(packet)))
+
+		file = append(file, record...)
+		file = append(file, packet...)
+	}
+
+	return file
+}
+
+func pcapngFile(packets [][]byte) []byte {
+	block := func(blockType uint32, body []byte) []byte {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+
+		length := uint32(12 + len(body))
+		b := binary.BigEndian.AppendUint32(nil, blockType)
+		b = binary.BigEndian.AppendUint32(b, length)
+		b = append(b, body...)
+
+		return binary.BigEndian.AppendUint32(b, length)
+	}
+
+	sectionHeader := binary.BigEndian.AppendUint32(nil, 0x1a2b3c4d)
+	sectionHeader = binary.BigEndian.AppendUint16(sectionHeader, 1)
+	sectionHeader = binary.BigEndian.AppendUint16(sectionHeader, 0)
+	sectionHeader = binary.BigEndian.AppendUint64(sectionHeader, 0xffffffffffffffff)
+
+	interfaceDescription := binary.BigEndian.AppendUint16(nil, 1)
+	interfaceDescription = binary.BigEndian.AppendUint16(interfaceDescription, 0)
+	interfaceDescription = binary.BigEndian.AppendUint32(interfaceDescription, 65535)
+
+	file := block(0x0a0d0d0a, sectionHeader)
+	file = append(file, block(1, interfaceDescription)...)
+
+	for _, packet := range packets {
+		enhancedPacket := binary.BigEndian.AppendUint32(nil, 0)
+		enhancedPacket = binary.BigEndian.AppendUint64(enhancedPacket, 0)
+		enhancedPacket = binary.BigEndian.AppendUint32(enhancedPacket, uint32(len(packet)))
+		enhancedPacket = binary.BigEndian.AppendUint32(enhancedPacket, uint32(len(packet)))
+		enhancedPacket = append(enhancedPacket, packet...)
+
+		file = append(file, block(6, enhancedPacket)...)
+	}
+
+	return file
+}
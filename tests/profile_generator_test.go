@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/bogdanfinn/fhttp/http2"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileGenerator_Reproducible(t *testing.T) {
+	first := generateReports(t, profiles.NewGenerator(profiles.Chrome_146, 42), 20)
+	second := generateReports(t, profiles.NewGenerator(profiles.Chrome_146, 42), 20)
+	other := generateReports(t, profiles.NewGenerator(profiles.Chrome_146, 43), 20)
+
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+
+	distinct := make(map[string]bool)
+	for _, report := range first {
+		distinct[report.JA3] = true
+	}
+	assert.Greater(t, len(distinct), 1)
+}
+
+func TestProfileGenerator_WindowSizeSources(t *testing.T) {
+	expected := generateReports(t, profiles.NewGenerator(profiles.Chrome_146, 42), 20)
+
+	// profiles added at runtime are no window size sources, even with the settings of the base profile
+	custom := profiles.NewClientProfile(profiles.Chrome_146.GetClientHelloId(), map[http2.SettingID]uint32{
+		http2.SettingHeaderTableSize:   65536,
+		http2.SettingEnablePush:        0,
+		http2.SettingInitialWindowSize: 1234567,
+		http2.SettingMaxHeaderListSize: 262144,
+	}, profiles.Chrome_146.GetSettingsOrder(), profiles.Chrome_146.GetPseudoHeaderOrder(), 7654321, nil, nil, 0, false, nil, nil, 0, nil, false)
+
+	profiles.MappedTLSClients["chrome_146_custom"] = custom
+	defer delete(profiles.MappedTLSClients, "chrome_146_custom")
+
+	assert.Equal(t, expected, generateReports(t, profiles.NewGenerator(profiles.Chrome_146, 42), 20))
+
+	// the window sizes are only taken from profiles of the same major version
+	baseReport, err := profiles.Chrome_146.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, report := range expected {
+		assert.Equal(t, baseReport.Akamai, report.Akamai)
+	}
+}
+
+func TestProfileGenerator_Consistent(t *testing.T) {
+	baseReport, err := profiles.Firefox_147.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, report := range generateReports(t, profiles.NewGenerator(profiles.Firefox_147, 1), 20) {
+		// firefox does not permute its extensions
+		assert.Equal(t, strings.Split(baseReport.JA3, ",")[2], strings.Split(report.JA3, ",")[2])
+	}
+
+	baseReport, err = profiles.Chrome_146.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseGroups := strings.Split(baseReport.JA3, ",")[3]
+	baseJA4Prefix := strings.Split(baseReport.JA4, "_")[0]
+
+	for _, report := range generateReports(t, profiles.NewGenerator(profiles.Chrome_146, 1), 20) {
+		// the post quantum group is either offered in the supported groups and the key shares or not at all
+		assert.Contains(t, []string{baseGroups, strings.TrimPrefix(baseGroups, "4588-")}, strings.Split(report.JA3, ",")[3])
+		// the number of extensions never changes
+		assert.Equal(t, baseJA4Prefix, strings.Split(report.JA4, "_")[0])
+	}
+}
+
+func TestProfileGenerator_Handshake(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	generator := profiles.NewGenerator(profiles.Chrome_146, 7)
+
+	for i := 0; i < 5; i++ {
+		profile, err := generator.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := profile.GetFingerprintReport()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithClientProfile(profile),
+			tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		echoResponse := doEchoRequest(t, client, req)
+
+		assert.Equal(t, report.JA4, echoResponse.TLS.JA4)
+		assert.Equal(t, report.Akamai, echoResponse.HTTP2.AkamaiFingerprint)
+	}
+}
+
+func generateReports(t *testing.T, generator *profiles.Generator, count int) []profiles.FingerprintReport {
+	t.Helper()
+
+	reports := make([]profiles.FingerprintReport, 0, count)
+	for i := 0; i < count; i++ {
+		profile, err := generator.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := profile.GetFingerprintReport()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileOverride(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chrome, err := profiles.Chrome_146.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	safari, err := profiles.Safari_IOS_18_5.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(clientProfile *profiles.ClientProfile) echoserver.Response {
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if clientProfile != nil {
+			req = req.WithContext(context.WithValue(req.Context(), tls_client.ContextKeyClientProfile{}, *clientProfile))
+		}
+
+		return doEchoRequest(t, client, req)
+	}
+
+	// the requests alternate to make sure a pooled connection of the other profile is never reused
+	for i := 0; i < 2; i++ {
+		response := request(nil)
+		assert.Equal(t, chrome.JA4, response.TLS.JA4)
+		assert.Equal(t, chrome.Akamai, response.HTTP2.AkamaiFingerprint)
+
+		response = request(&profiles.Safari_IOS_18_5)
+		assert.Equal(t, safari.JA4, response.TLS.JA4)
+		assert.Equal(t, safari.Akamai, response.HTTP2.AkamaiFingerprint)
+	}
+
+	// the profile of the client itself does not create a second set of transports
+	response := request(&profiles.Chrome_146)
+	assert.Equal(t, chrome.JA4, response.TLS.JA4)
+
+	// a custom profile with the client hello of the client but other http2 settings is not mistaken for it
+	custom := profiles.NewClientProfile(profiles.Chrome_146.GetClientHelloId(), profiles.Chrome_146.GetSettings(),
+		profiles.Chrome_146.GetSettingsOrder(), profiles.Chrome_146.GetPseudoHeaderOrder(), profiles.Chrome_146.GetConnectionFlow()+1,
+		profiles.Chrome_146.GetPriorities(), profiles.Chrome_146.GetHeaderPriority(), profiles.Chrome_146.GetStreamID(),
+		profiles.Chrome_146.GetAllowHTTP(), profiles.Chrome_146.GetHttp3Settings(), profiles.Chrome_146.GetHttp3SettingsOrder(),
+		profiles.Chrome_146.GetHttp3PriorityParam(), profiles.Chrome_146.GetHttp3PseudoHeaderOrder(), profiles.Chrome_146.GetHttp3SendGreaseFrames())
+
+	customReport, err := custom.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, chrome.Akamai, customReport.Akamai)
+
+	response = request(&custom)
+	assert.Equal(t, chrome.JA4, response.TLS.JA4)
+	assert.Equal(t, customReport.Akamai, response.HTTP2.AkamaiFingerprint)
+
+	response = request(nil)
+	assert.Equal(t, chrome.Akamai, response.HTTP2.AkamaiFingerprint)
+}
+
+func TestProfileOverride_CustomProfilesWithSameId(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	newJa3Profile := func(ja3 string) profiles.ClientProfile {
+		specFactory, err := tls_client.GetSpecFactoryFromJa3String(ja3,
+			[]string{"ECDSAWithP256AndSHA256", "PSSWithSHA256", "PKCS1WithSHA256"}, nil, []string{"1.3", "1.2"},
+			[]string{"X25519"}, []string{"h2", "http/1.1"}, nil, nil, nil, []string{"brotli"}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return ja4Profile(specFactory)
+	}
+
+	first := newJa3Profile("771,4865-4866-4867-49195-49199-49196-49200,0-23-65281-10-11-16-13-51-45-43-27,29-23-24,0")
+	second := newJa3Profile("771,4865-4867-49195,0-65281-10-11-16-13-51-45-43,29,0")
+
+	// both profiles share the client hello id string and the http2 settings
+	assert.Equal(t, first.GetClientHelloStr(), second.GetClientHelloStr())
+
+	firstReport, err := first.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secondReport, err := second.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, firstReport.JA4, secondReport.JA4)
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(first),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(clientProfile *profiles.ClientProfile) echoserver.Response {
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if clientProfile != nil {
+			req = req.WithContext(context.WithValue(req.Context(), tls_client.ContextKeyClientProfile{}, *clientProfile))
+		}
+
+		return doEchoRequest(t, client, req)
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, firstReport.JA4, request(nil).TLS.JA4)
+		assert.Equal(t, secondReport.JA4, request(&second).TLS.JA4)
+		assert.Equal(t, firstReport.JA4, request(&first).TLS.JA4)
+	}
+}
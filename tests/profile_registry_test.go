@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileRegistry_Lookup(t *testing.T) {
+	registry := profiles.DefaultRegistry
+
+	testCases := []struct {
+		name     string
+		lookup   func() (profiles.ClientProfile, error)
+		expected profiles.ClientProfile
+	}{
+		{"by name", func() (profiles.ClientProfile, error) { return registry.Get("chrome_133") }, profiles.Chrome_133},
+		{"exact version", func() (profiles.ClientProfile, error) { return registry.Lookup("chrome", "133", "") }, profiles.Chrome_133},
+		{"latest", func() (profiles.ClientProfile, error) { return registry.Lookup("chrome", profiles.LatestVersion, "") }, profiles.Chrome_146},
+		{"latest identifier", func() (profiles.ClientProfile, error) { return registry.Resolve("chrome_latest") }, profiles.Chrome_146},
+		{"desktop preferred without platform", func() (profiles.ClientProfile, error) { return registry.Lookup("safari", "16.0", "") }, profiles.Safari_16_0},
+		{"platform", func() (profiles.ClientProfile, error) { return registry.Lookup("safari", "16", "ios") }, profiles.Safari_IOS_16_0},
+		{"closest older version", func() (profiles.ClientProfile, error) { return registry.Closest("chrome", "125", "") }, profiles.Chrome_124},
+		{"closest without older version", func() (profiles.ClientProfile, error) { return registry.Closest("chrome", "90", "") }, profiles.Chrome_103},
+	}
+
+	for _, testCase := range testCases {
+		profile, err := testCase.lookup()
+		if err != nil {
+			t.Errorf("%s: %v", testCase.name, err)
+			continue
+		}
+
+		assert.Equal(t, testCase.expected.GetClientHelloStr(), profile.GetClientHelloStr(), testCase.name)
+	}
+}
+
+func TestProfileRegistry_UnknownProfile(t *testing.T) {
+	registry := profiles.DefaultRegistry
+
+	_, err := registry.Get("chrome_1")
+	assert.ErrorIs(t, err, profiles.ErrProfileNotFound)
+
+	_, err = registry.Lookup("chrome", "1", "")
+	assert.ErrorIs(t, err, profiles.ErrProfileNotFound)
+
+	_, err = registry.Closest("netscape", "4", "")
+	assert.ErrorIs(t, err, profiles.ErrProfileNotFound)
+}
+
+func TestProfileRegistry_Register(t *testing.T) {
+	registry := profiles.NewRegistry()
+
+	assert.NoError(t, registry.Register(profiles.ProfileInfo{Name: "chrome_133"}, profiles.Chrome_133))
+	assert.NoError(t, registry.Register(profiles.ProfileInfo{Name: "my_chrome", Browser: "Chrome", Version: "200", Platform: "windows"}, profiles.Chrome_146))
+	assert.Error(t, registry.Register(profiles.ProfileInfo{}, profiles.Chrome_146))
+
+	latest, err := registry.Latest("chrome", "windows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, profiles.Chrome_146.GetClientHelloStr(), latest.GetClientHelloStr())
+
+	// profiles bound to another platform are not considered
+	latest, err = registry.Latest("chrome", "android")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, profiles.Chrome_133.GetClientHelloStr(), latest.GetClientHelloStr())
+}
+
+func TestProfileRegistry_MappedTLSClients(t *testing.T) {
+	registry := profiles.DefaultRegistry
+
+	// profiles added to MappedTLSClients after the registry was created are found as well
+	profiles.MappedTLSClients["chrome_900"] = profiles.Chrome_133
+	t.Cleanup(func() {
+		delete(profiles.MappedTLSClients, "chrome_900")
+	})
+
+	profile, err := registry.Resolve("chrome_900")
+	if assert.NoError(t, err) {
+		assert.Equal(t, profiles.Chrome_133.GetClientHelloStr(), profile.GetClientHelloStr())
+	}
+
+	profile, err = registry.Resolve("chrome_latest")
+	if assert.NoError(t, err) {
+		assert.Equal(t, profiles.Chrome_133.GetClientHelloStr(), profile.GetClientHelloStr())
+	}
+
+	assert.Contains(t, registry.Infos(), profiles.ProfileInfo{Name: "chrome_900", Browser: "chrome", Version: "900"})
+}
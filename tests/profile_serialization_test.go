@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestProfileSerialization_RoundTrip(t *testing.T) {
+	for name, profile := range profiles.MappedTLSClients {
+		jsonProfile, err := json.Marshal(profile)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		loadedFromJson, err := profiles.LoadProfile(bytes.NewReader(jsonProfile))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		yamlProfile, err := yaml.Marshal(profile)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		loadedFromYaml, err := profiles.LoadProfile(bytes.NewReader(yamlProfile))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		for _, loaded := range []profiles.ClientProfile{loadedFromJson, loadedFromYaml} {
+			assertSameFingerprint(t, name, profile, loaded)
+
+			assert.Equal(t, profile.GetClientHelloStr(), loaded.GetClientHelloStr(), name)
+			assert.Equal(t, profile.GetHeaderPriority(), loaded.GetHeaderPriority(), name)
+			assert.Equal(t, profile.GetHttp3SettingsOrder(), loaded.GetHttp3SettingsOrder(), name)
+			assert.Equal(t, profile.GetHttp3PseudoHeaderOrder(), loaded.GetHttp3PseudoHeaderOrder(), name)
+			assert.Equal(t, profile.GetHttp3PriorityParam(), loaded.GetHttp3PriorityParam(), name)
+			assert.Equal(t, profile.GetHttp3SendGreaseFrames(), loaded.GetHttp3SendGreaseFrames(), name)
+		}
+	}
+}
+
+func TestProfileSerialization_LoadYaml(t *testing.T) {
+	definition := `
+client: Custom
+version: "1"
+tls:
+  cipher_suites: [GREASE, TLS_AES_128_GCM_SHA256, TLS_AES_256_GCM_SHA384]
+  extensions:
+    - name: GREASE
+    - name: server_name
+    - name: supported_groups
+      groups: [GREASE, X25519MLKEM768, x25519]
+    - name: key_share
+      key_shares:
+        - group: GREASE
+          data: "00"
+        - group: x25519
+    - name: supported_versions
+      versions: [GREASE, "1.3", "1.2"]
+    - name: generic
+      id: 51764
+      data: "0000"
+http2:
+  settings:
+    HEADER_TABLE_SIZE: 65536
+    INITIAL_WINDOW_SIZE: 6291456
+  settings_order: [HEADER_TABLE_SIZE, INITIAL_WINDOW_SIZE]
+  connection_flow: 15663105
+  pseudo_header_order: [":method", ":authority", ":scheme", ":path"]
+`
+
+	profile, err := profiles.LoadProfile(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := profile.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "771,4865-4866,0-10-51-43-51764,4588-29,", report.JA3)
+	assert.Equal(t, "1:65536;4:6291456|15663105|0|m,a,s,p", report.Akamai)
+
+	_, err = profiles.LoadProfile(strings.NewReader(strings.Replace(definition, "server_name", "unknown_extension", 1)))
+	assert.Error(t, err)
+}
+
+func assertSameFingerprint(t *testing.T, name string, expected profiles.ClientProfile, actual profiles.ClientProfile) {
+	t.Helper()
+
+	expectedReport, err := expected.GetFingerprintReport()
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	actualReport, err := actual.GetFingerprintReport()
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	assert.Equal(t, expectedReport.JA3N, actualReport.JA3N, name)
+	assert.Equal(t, expectedReport.JA4, actualReport.JA4, name)
+	assert.Equal(t, expectedReport.Akamai, actualReport.Akamai, name)
+}
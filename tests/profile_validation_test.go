@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanfinn/fhttp/http2"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/profiles"
+	tls "github.com/bogdanfinn/utls"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate_MappedProfiles(t *testing.T) {
+	for name, profile := range profiles.MappedTLSClients {
+		for _, issue := range profiles.Validate(profile) {
+			assert.NotEqual(t, profiles.SeverityError, issue.Severity, "%s: %s", name, issue)
+		}
+	}
+}
+
+func TestValidate_Inconsistent(t *testing.T) {
+	chrome := profiles.Chrome_146
+
+	withSpec := func(version string, modify func(spec *tls.ClientHelloSpec)) tls.ClientHelloID {
+		return tls.ClientHelloID{
+			Client:  "Chrome",
+			Version: version,
+			SpecFactory: func() (tls.ClientHelloSpec, error) {
+				spec, err := chrome.GetClientHelloSpec()
+				if err != nil {
+					return tls.ClientHelloSpec{}, err
+				}
+
+				modify(&spec)
+
+				return spec, nil
+			},
+		}
+	}
+
+	noChange := func(spec *tls.ClientHelloSpec) {}
+
+	testCases := []struct {
+		name    string
+		profile profiles.ClientProfile
+		check   string
+	}{
+		{
+			"h2 without settings",
+			profiles.NewClientProfile(chrome.GetClientHelloId(), nil, nil, chrome.GetPseudoHeaderOrder(), chrome.GetConnectionFlow(), nil, nil, 0, false, nil, nil, 0, nil, false),
+			"h2-settings",
+		},
+		{
+			"settings order without value",
+			profiles.NewClientProfile(chrome.GetClientHelloId(), map[http2.SettingID]uint32{http2.SettingHeaderTableSize: 65536}, []http2.SettingID{http2.SettingHeaderTableSize, http2.SettingMaxFrameSize}, chrome.GetPseudoHeaderOrder(), chrome.GetConnectionFlow(), nil, nil, 0, false, nil, nil, 0, nil, false),
+			"h2-settings",
+		},
+		{
+			"incomplete pseudo header order",
+			profiles.NewClientProfile(chrome.GetClientHelloId(), chrome.GetSettings(), chrome.GetSettingsOrder(), []string{":method", ":path"}, chrome.GetConnectionFlow(), nil, nil, 0, false, nil, nil, 0, nil, false),
+			"h2-pseudo-header-order",
+		},
+		{
+			"psk variant without pre shared key",
+			profiles.NewClientProfile(withSpec("146_PSK", noChange), chrome.GetSettings(), chrome.GetSettingsOrder(), chrome.GetPseudoHeaderOrder(), chrome.GetConnectionFlow(), nil, nil, 0, false, nil, nil, 0, nil, false),
+			"pre-shared-key",
+		},
+		{
+			"key share group not supported",
+			profiles.NewClientProfile(withSpec("146", func(spec *tls.ClientHelloSpec) {
+				for _, extension := range spec.Extensions {
+					if ext, ok := extension.(*tls.SupportedCurvesExtension); ok {
+						ext.Curves = []tls.CurveID{tls.CurveP256}
+					}
+				}
+			}), chrome.GetSettings(), chrome.GetSettingsOrder(), chrome.GetPseudoHeaderOrder(), chrome.GetConnectionFlow(), nil, nil, 0, false, nil, nil, 0, nil, false),
+			"key-share",
+		},
+		{
+			"h3 settings without tls 1.3",
+			profiles.NewClientProfile(withSpec("146", func(spec *tls.ClientHelloSpec) {
+				for _, extension := range spec.Extensions {
+					if ext, ok := extension.(*tls.SupportedVersionsExtension); ok {
+						ext.Versions = []uint16{tls.VersionTLS12}
+					}
+				}
+			}), chrome.GetSettings(), chrome.GetSettingsOrder(), chrome.GetPseudoHeaderOrder(), chrome.GetConnectionFlow(), nil, nil, 0, false, map[uint64]uint64{1: 65536}, []uint64{1}, 0, nil, false),
+			"h3-tls-version",
+		},
+	}
+
+	for _, testCase := range testCases {
+		var checks []string
+		for _, issue := range profiles.Validate(testCase.profile) {
+			if issue.Severity == profiles.SeverityError {
+				checks = append(checks, issue.Check)
+			}
+		}
+
+		assert.Contains(t, checks, testCase.check, testCase.name)
+	}
+}
+
+func TestValidate_Debug(t *testing.T) {
+	chrome := profiles.Chrome_146
+	profile := profiles.NewClientProfile(chrome.GetClientHelloId(), nil, nil, chrome.GetPseudoHeaderOrder(), chrome.GetConnectionFlow(), nil, nil, 0, false, nil, nil, 0, nil, false)
+
+	logger := &recordingLogger{}
+
+	_, err := tls_client.NewHttpClient(logger, tls_client.WithClientProfile(profile), tls_client.WithDebug())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, logger.warnings, 1)
+	assert.Contains(t, logger.warnings[0], "h2-settings")
+
+	logger = &recordingLogger{}
+
+	_, err = tls_client.NewHttpClient(logger, tls_client.WithClientProfile(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, logger.warnings)
+}
+
+type recordingLogger struct {
+	warnings []string
+}
+
+func (l *recordingLogger) Debug(_ string, _ ...any) {}
+
+func (l *recordingLogger) Info(_ string, _ ...any) {}
+
+func (l *recordingLogger) Warn(format string, args ...any) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Error(_ string, _ ...any) {}
@@ -0,0 +1,429 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	stdtls "crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"unicode/utf16"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+	//lint:ignore SA1019 NTLM requires MD4
+	"golang.org/x/crypto/md4"
+)
+
+var authParamRegexp = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|([^,\s]*))`)
+
+// digestProxyAuth accepts Digest responses with qop auth for the given credentials and counts the challenges.
+func digestProxyAuth(username string, password string, challenges *atomic.Int32) func(w stdhttp.ResponseWriter, r *stdhttp.Request) bool {
+	const realm = "tls-client"
+	const nonce = "dcd98b7102dd2f0e8b11d0f600bfb0c093"
+
+	return func(w stdhttp.ResponseWriter, r *stdhttp.Request) bool {
+		authorization := r.Header.Get("Proxy-Authorization")
+
+		if strings.HasPrefix(authorization, "Digest ") {
+			params := make(map[string]string)
+			for _, match := range authParamRegexp.FindAllStringSubmatch(authorization, -1) {
+				params[match[1]] = match[2] + match[3]
+			}
+
+			md5Hex := func(value string) string {
+				sum := md5.Sum([]byte(value))
+				return hex.EncodeToString(sum[:])
+			}
+
+			ha1 := md5Hex(username + ":" + realm + ":" + password)
+			ha2 := md5Hex(r.Method + ":" + params["uri"])
+			expected := md5Hex(strings.Join([]string{ha1, nonce, params["nc"], params["cnonce"], params["qop"], ha2}, ":"))
+
+			if params["username"] == username && params["uri"] == r.Host && params["response"] == expected {
+				return true
+			}
+		}
+
+		challenges.Add(1)
+
+		w.Header().Add("Proxy-Authenticate", `Basic realm="`+realm+`"`)
+		w.Header().Add("Proxy-Authenticate", fmt.Sprintf(`Digest realm="%s", nonce="%s", qop="auth", algorithm=MD5`, realm, nonce))
+		w.WriteHeader(stdhttp.StatusProxyAuthRequired)
+
+		return false
+	}
+}
+
+// ntlmProxyAuth accepts NTLMv2 responses for the given credentials. The handshake has to happen on a single connection.
+func ntlmProxyAuth(domain string, username string, password string) func(w stdhttp.ResponseWriter, r *stdhttp.Request) bool {
+	serverChallenge := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	var mu sync.Mutex
+	challenged := make(map[string]bool)
+
+	return func(w stdhttp.ResponseWriter, r *stdhttp.Request) bool {
+		token, hasToken := strings.CutPrefix(r.Header.Get("Proxy-Authorization"), "NTLM ")
+		message, _ := base64.StdEncoding.DecodeString(token)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case hasToken && len(message) >= 12 && binary.LittleEndian.Uint32(message[8:12]) == 1:
+			challenged[r.RemoteAddr] = true
+
+			w.Header().Set("Proxy-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(testNtlmChallengeMessage(serverChallenge)))
+			w.WriteHeader(stdhttp.StatusProxyAuthRequired)
+
+			return false
+		case hasToken && len(message) >= 64 && binary.LittleEndian.Uint32(message[8:12]) == 3 && challenged[r.RemoteAddr]:
+			field := func(offset int) []byte {
+				length := int(binary.LittleEndian.Uint16(message[offset:]))
+				start := int(binary.LittleEndian.Uint32(message[offset+4:]))
+				return message[start : start+length]
+			}
+
+			ntResponse := field(20)
+			user := testNtlmDecode(field(36))
+
+			ntHash := md4.New()
+			ntHash.Write(testNtlmUnicode(password))
+
+			mac := hmac.New(md5.New, ntHash.Sum(nil))
+			mac.Write(testNtlmUnicode(strings.ToUpper(user) + testNtlmDecode(field(28))))
+
+			proof := hmac.New(md5.New, mac.Sum(nil))
+			proof.Write(serverChallenge)
+			proof.Write(ntResponse[16:])
+
+			if user == username && testNtlmDecode(field(28)) == domain && bytes.Equal(proof.Sum(nil), ntResponse[:16]) {
+				return true
+			}
+		}
+
+		w.Header().Set("Proxy-Authenticate", "NTLM")
+		w.WriteHeader(stdhttp.StatusProxyAuthRequired)
+
+		return false
+	}
+}
+
+func testNtlmChallengeMessage(serverChallenge []byte) []byte {
+	// MsvAvTimestamp followed by MsvAvEOL
+	targetInfo := []byte{7, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0}
+
+	message := []byte("NTLMSSP\x00")
+	message = binary.LittleEndian.AppendUint32(message, 2)
+	// empty target name
+	message = append(message, 0, 0, 0, 0, 48, 0, 0, 0)
+	message = binary.LittleEndian.AppendUint32(message, 0x00000001|0x00000200|0x00080000|0x00800000)
+	message = append(message, serverChallenge...)
+	message = append(message, make([]byte, 8)...)
+	message = binary.LittleEndian.AppendUint16(message, uint16(len(targetInfo)))
+	message = binary.LittleEndian.AppendUint16(message, uint16(len(targetInfo)))
+	message = binary.LittleEndian.AppendUint32(message, 48)
+
+	return append(message, targetInfo...)
+}
+
+func testNtlmUnicode(s string) []byte {
+	var b []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, r)
+	}
+
+	return b
+}
+
+func testNtlmDecode(b []byte) string {
+	runes := make([]uint16, len(b)/2)
+	for i := range runes {
+		runes[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+
+	return string(utf16.Decode(runes))
+}
+
+func TestProxyAuth_Digest(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	testCases := []struct {
+		name        string
+		withTLS     bool
+		enableHttp2 bool
+	}{
+		{"http/1.1", false, false},
+		{"h2", true, true},
+	}
+
+	for _, testCase := range testCases {
+		var challenges atomic.Int32
+		proxy := newAuthConnectProxy(t, testCase.withTLS, testCase.enableHttp2, digestProxyAuth("user", "pass", &challenges))
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithClientProfile(profiles.Chrome_146),
+			tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+			tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: proxy.rootCAs}),
+			tls_client.WithProxyUrl(proxy.url),
+			tls_client.WithProxyAuthenticators(tls_client.NewDigestProxyAuthenticator("user", "pass")),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		doEchoRequest(t, client, req)
+
+		assert.Equal(t, int32(1), challenges.Load(), testCase.name)
+		assert.Equal(t, int32(1), proxy.connects.Load(), testCase.name)
+		// the challenge is answered on the same proxy connection
+		assert.Equal(t, int32(1), proxy.connections.Load(), testCase.name)
+	}
+}
+
+func TestProxyAuth_DigestRejected(t *testing.T) {
+	testCases := []struct {
+		name        string
+		withTLS     bool
+		enableHttp2 bool
+	}{
+		{"http", false, false},
+		// the rejected stream returns without waiting for the tunnel
+		{"h2", true, true},
+	}
+
+	for _, testCase := range testCases {
+		var challenges atomic.Int32
+		proxy := newAuthConnectProxy(t, testCase.withTLS, testCase.enableHttp2, digestProxyAuth("user", "pass", &challenges))
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithProxyUrl(proxy.url),
+			tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: proxy.rootCAs}),
+			tls_client.WithProxyAuthenticators(tls_client.NewDigestProxyAuthenticator("user", "wrong")),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "https://127.0.0.1:1/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.Do(req)
+		if assert.Error(t, err, testCase.name) {
+			assert.Contains(t, err.Error(), "407", testCase.name)
+		}
+
+		assert.Equal(t, int32(0), proxy.connects.Load(), testCase.name)
+		assert.LessOrEqual(t, challenges.Load(), int32(4), testCase.name)
+	}
+}
+
+func TestProxyAuth_ConnectionCloseRedialsHttp1(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var challenges atomic.Int32
+	digest := digestProxyAuth("user", "pass", &challenges)
+
+	proxy := &connectProxy{authenticate: func(w stdhttp.ResponseWriter, r *stdhttp.Request) bool {
+		// the challenge closes the proxy connection, so the answer is sent on a new one
+		if r.Header.Get("Proxy-Authorization") == "" {
+			w.Header().Set("Connection", "close")
+		}
+
+		return digest(w, r)
+	}}
+
+	// the first proxy connection only offers http/1.1, the following ones prefer h2
+	var handshakes atomic.Int32
+
+	proxyServer := httptest.NewUnstartedServer(stdhttp.HandlerFunc(proxy.serveHTTP))
+	proxyServer.Listener = &proxyListener{Listener: proxyServer.Listener, proxy: proxy}
+	proxyServer.EnableHTTP2 = true
+	proxyServer.TLS = &stdtls.Config{GetConfigForClient: func(*stdtls.ClientHelloInfo) (*stdtls.Config, error) {
+		if handshakes.Add(1) > 1 {
+			return nil, nil
+		}
+
+		return &stdtls.Config{Certificates: proxyServer.TLS.Certificates, NextProtos: []string{"http/1.1"}}, nil
+	}}
+	proxyServer.StartTLS()
+
+	t.Cleanup(func() {
+		proxy.mu.Lock()
+		for _, conn := range proxy.tunnels {
+			_ = conn.Close()
+		}
+		proxy.mu.Unlock()
+
+		proxyServer.Close()
+	})
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(proxyServer.Certificate())
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: rootCAs}),
+		tls_client.WithProxyUrl("https://"+proxyServer.Listener.Addr().String()),
+		tls_client.WithProxyAuthenticators(tls_client.NewDigestProxyAuthenticator("user", "pass")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doEchoRequest(t, client, req)
+
+	assert.Equal(t, int32(1), challenges.Load())
+	assert.Equal(t, int32(2), proxy.connections.Load())
+	assert.Equal(t, int32(1), proxy.connects.Load())
+}
+
+func TestProxyAuth_NTLM(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	proxy := newAuthConnectProxy(t, false, false, ntlmProxyAuth("CORP", "user", "pass"))
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithProxyUrl(proxy.url),
+		tls_client.WithProxyAuthenticators(
+			tls_client.NewDigestProxyAuthenticator("user", "pass"),
+			tls_client.NewNTLMProxyAuthenticator("", `CORP\user`, "pass"),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doEchoRequest(t, client, req)
+
+	assert.Equal(t, int32(1), proxy.connects.Load())
+	assert.Equal(t, int32(1), proxy.connections.Load())
+}
+
+func TestProxyAuth_NTLMOverHttp2(t *testing.T) {
+	proxy := newAuthConnectProxy(t, true, true, ntlmProxyAuth("CORP", "user", "pass"))
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithProxyUrl(proxy.url),
+		tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: proxy.rootCAs}),
+		tls_client.WithProxyAuthenticators(tls_client.NewNTLMProxyAuthenticator("", `CORP\user`, "pass")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://127.0.0.1:1/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the NTLM handshake is not started on a stream the proxy cannot bind to the following ones
+	_, err = client.Do(req)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not supported by h2 proxies")
+	}
+
+	assert.Equal(t, int32(0), proxy.connects.Load())
+}
+
+func TestProxyAuth_Negotiate(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	proxy := newAuthConnectProxy(t, false, false, func(w stdhttp.ResponseWriter, r *stdhttp.Request) bool {
+		switch r.Header.Get("Proxy-Authorization") {
+		case "Negotiate " + base64.StdEncoding.EncodeToString([]byte("initial")):
+			w.Header().Set("Proxy-Authenticate", "Negotiate "+base64.StdEncoding.EncodeToString([]byte("challenge")))
+		case "Negotiate " + base64.StdEncoding.EncodeToString([]byte("response")):
+			return true
+		default:
+			w.Header().Set("Proxy-Authenticate", "Negotiate")
+		}
+
+		w.WriteHeader(stdhttp.StatusProxyAuthRequired)
+
+		return false
+	})
+
+	var proxyHosts []string
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithProxyUrl(proxy.url),
+		tls_client.WithProxyAuthenticators(tls_client.NewNegotiateProxyAuthenticator(func(proxyHost string, challenge []byte) ([]byte, error) {
+			proxyHosts = append(proxyHosts, proxyHost)
+
+			if challenge == nil {
+				return []byte("initial"), nil
+			}
+
+			if string(challenge) != "challenge" {
+				return nil, fmt.Errorf("unexpected challenge %q", challenge)
+			}
+
+			return []byte("response"), nil
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doEchoRequest(t, client, req)
+
+	assert.Equal(t, []string{"127.0.0.1", "127.0.0.1"}, proxyHosts)
+	assert.Equal(t, int32(1), proxy.connects.Load())
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"net/url"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyChain_Socks5ThenConnect(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	testCases := []struct {
+		name        string
+		withTLS     bool
+		enableHttp2 bool
+	}{
+		{"http proxy", false, false},
+		{"h2 proxy", true, true},
+	}
+
+	for _, testCase := range testCases {
+		jumpProxy := newSocks5Proxy(t, "user", "pass")
+		proxy := startConnectProxy(t, testCase.withTLS, testCase.enableHttp2, nil)
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithClientProfile(profiles.Chrome_146),
+			tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+			tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: proxy.rootCAs}),
+			tls_client.WithProxyChain(jumpProxy.url, proxy.url),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		echoResponse := doEchoRequest(t, client, req)
+
+		proxyUrl, err := url.Parse(proxy.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the jump host only connects to the next proxy, which opens the tunnel to the target
+		assert.Equal(t, []string{proxyUrl.Host}, jumpProxy.targets, testCase.name)
+		assert.Equal(t, int32(1), proxy.connects.Load(), testCase.name)
+		assert.Equal(t, int32(0), jumpProxy.associations.Load(), testCase.name)
+		assert.Equal(t, "h2", echoResponse.HTTPVersion, testCase.name)
+		assert.Equal(t, proxy.url, client.GetProxy(), testCase.name)
+	}
+}
+
+func TestProxyChain_SetProxy(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	jumpProxy := newSocks5Proxy(t, "", "")
+	proxy := newConnectProxy(t)
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxyChainSetter, ok := client.(tls_client.ProxyChainSetter)
+	if !ok {
+		t.Fatal("expected the client to support proxy chains")
+	}
+
+	if err := proxyChainSetter.SetProxyChain(jumpProxy.url, proxy.url); err != nil {
+		t.Fatal(err)
+	}
+
+	// a masque proxy dials QUIC itself and can not be reached through the jump host, so the client keeps the chain
+	_ = proxyChainSetter.SetProxyChain(jumpProxy.url, "masque://127.0.0.1:4433")
+	assert.Equal(t, proxy.url, client.GetProxy())
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doEchoRequest(t, client, req)
+
+	assert.Equal(t, int32(1), jumpProxy.connects.Load())
+	assert.Equal(t, int32(1), proxy.connects.Load())
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+// http3 settings which quic-go parses itself and does not report in http3.Settings.Other
+var parsedHttp3Settings = map[uint64]bool{0x6: true, 0x8: true, 0x33: true}
+
+func TestMasqueProxy_HTTP3(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	proxy := newMasqueProxy(t)
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithProtocolRacing(),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: proxy.rootCAs}),
+		tls_client.WithProxyUrl(proxy.url),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echoResponse := doEchoRequest(t, client, req)
+
+	// both racing protocols are tunneled through a single proxy connection
+	assert.Equal(t, int32(1), proxy.connections.Load())
+	assert.Equal(t, int32(1), proxy.udpTunnels.Load())
+	assert.Greater(t, proxy.datagrams.Load(), int32(0))
+
+	// the proxy connection carries the http3 fingerprint of the client profile
+	settings := proxy.receivedSettings()
+	if assert.NotNil(t, settings) {
+		assert.True(t, settings.EnableDatagrams)
+
+		for id, value := range profiles.Chrome_146.GetHttp3Settings() {
+			if parsedHttp3Settings[id] {
+				continue
+			}
+
+			assert.Equal(t, value, settings.Other[id], "setting %#x", id)
+		}
+	}
+
+	if echoResponse.HTTPVersion != "h3" {
+		t.Logf("protocol racing selected %s", echoResponse.HTTPVersion)
+		return
+	}
+
+	assert.NotEmpty(t, echoResponse.HTTP3.Settings)
+}
+
+func TestMasqueProxy_TCP(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	proxy := newMasqueProxy(t)
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: proxy.rootCAs}),
+		tls_client.WithProxyUrl(proxy.url),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chrome, err := profiles.Chrome_146.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echoResponse := doEchoRequest(t, client, req)
+
+	assert.Equal(t, "h2", echoResponse.HTTPVersion)
+	assert.Equal(t, chrome.JA4, echoResponse.TLS.JA4)
+	assert.Equal(t, int32(1), proxy.connects.Load())
+	assert.Equal(t, int32(0), proxy.udpTunnels.Load())
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyOverride(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	first := newConnectProxy(t)
+	second := newConnectProxy(t)
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(proxyUrl string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if proxyUrl != "" {
+			req = req.WithContext(context.WithValue(req.Context(), tls_client.ContextKeyProxy{}, proxyUrl))
+		}
+
+		doEchoRequest(t, client, req)
+	}
+
+	// the requests alternate to make sure a pooled connection of another proxy is never reused
+	for i := 0; i < 2; i++ {
+		request(first.url)
+		request(second.url)
+		request("")
+	}
+
+	assert.Equal(t, int32(1), first.connects.Load())
+	assert.Equal(t, int32(1), second.connects.Load())
+}
+
+func TestProxyOverride_ProxyPool(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	pooled := newConnectProxy(t)
+	override := newConnectProxy(t)
+
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{{Url: pooled.url}}, tls_client.ProxyPoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithProxyPool(pool),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doEchoRequest(t, client, req.WithContext(context.WithValue(req.Context(), tls_client.ContextKeyProxy{}, override.url)))
+
+	assert.Equal(t, int32(0), pooled.connects.Load())
+	assert.Equal(t, int32(1), override.connects.Load())
+}
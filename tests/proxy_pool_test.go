@@ -0,0 +1,402 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyPool_RoundRobin(t *testing.T) {
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{
+		{Url: "http://127.0.0.1:1001"},
+		{Url: "http://127.0.0.1:1002"},
+		{Url: "http://127.0.0.1:1003"},
+	}, tls_client.ProxyPoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var selected []string
+	for i := 0; i < 4; i++ {
+		proxyUrl, err := pool.Select("example.com", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		selected = append(selected, proxyUrl)
+	}
+
+	assert.Equal(t, []string{"http://127.0.0.1:1001", "http://127.0.0.1:1002", "http://127.0.0.1:1003", "http://127.0.0.1:1001"}, selected)
+}
+
+func TestProxyPool_Weighted(t *testing.T) {
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{
+		{Url: "http://127.0.0.1:1001", Weight: 9},
+		{Url: "http://127.0.0.1:1002", Weight: 1},
+	}, tls_client.ProxyPoolOptions{Strategy: tls_client.ProxySelectionWeighted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		proxyUrl, err := pool.Select("example.com", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counts[proxyUrl]++
+	}
+
+	assert.Greater(t, counts["http://127.0.0.1:1001"], 800)
+	assert.Greater(t, counts["http://127.0.0.1:1002"], 0)
+}
+
+func TestProxyPool_Stickiness(t *testing.T) {
+	proxies := []tls_client.PoolProxy{{Url: "http://127.0.0.1:1001"}, {Url: "http://127.0.0.1:1002"}}
+
+	pool, err := tls_client.NewProxyPool(proxies, tls_client.ProxyPoolOptions{Stickiness: tls_client.ProxyStickinessHost})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := pool.Select("a.example.com", "")
+	second, _ := pool.Select("b.example.com", "")
+	assert.NotEqual(t, first, second)
+
+	again, _ := pool.Select("a.example.com", "")
+	assert.Equal(t, first, again)
+
+	pool, err = tls_client.NewProxyPool(proxies, tls_client.ProxyPoolOptions{Stickiness: tls_client.ProxyStickinessSession})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ = pool.Select("a.example.com", "session-1")
+	again, _ = pool.Select("b.example.com", "session-1")
+	assert.Equal(t, first, again)
+
+	second, _ = pool.Select("a.example.com", "session-2")
+	assert.NotEqual(t, first, second)
+}
+
+func TestProxyPool_Eviction(t *testing.T) {
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{
+		{Url: "http://127.0.0.1:1001"},
+		{Url: "http://127.0.0.1:1002"},
+	}, tls_client.ProxyPoolOptions{
+		Stickiness:  tls_client.ProxyStickinessHost,
+		MaxFailures: 2,
+		Cooldown:    100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := pool.Select("example.com", "")
+
+	pool.ReportFailure(first)
+	assert.Len(t, pool.Available(), 2)
+
+	pool.ReportFailure(first)
+	assert.Equal(t, []string{"http://127.0.0.1:1002"}, pool.Available())
+
+	// the sticky proxy is evicted, so the host moves to another proxy
+	selected, _ := pool.Select("example.com", "")
+	assert.Equal(t, "http://127.0.0.1:1002", selected)
+
+	pool.ReportFailure(selected)
+	pool.ReportFailure(selected)
+
+	_, err = pool.Select("example.com", "")
+	assert.ErrorIs(t, err, tls_client.ErrNoProxyAvailable)
+
+	time.Sleep(150 * time.Millisecond)
+	assert.Len(t, pool.Available(), 2)
+}
+
+func TestProxyPool_StickyTTL(t *testing.T) {
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{
+		{Url: "http://127.0.0.1:1001"},
+		{Url: "http://127.0.0.1:1002"},
+	}, tls_client.ProxyPoolOptions{
+		Stickiness: tls_client.ProxyStickinessHost,
+		StickyTTL:  50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := pool.Select("example.com", "")
+	again, _ := pool.Select("example.com", "")
+	assert.Equal(t, first, again)
+
+	// the host did not send a request for longer than the ttl, so it gets the next proxy
+	time.Sleep(100 * time.Millisecond)
+
+	second, _ := pool.Select("example.com", "")
+	assert.NotEqual(t, first, second)
+}
+
+func TestProxyPool_HealthCheck(t *testing.T) {
+	var healthy atomic.Bool
+
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{{Url: "http://127.0.0.1:1001"}}, tls_client.ProxyPoolOptions{
+		MaxFailures:         1,
+		Cooldown:            time.Hour,
+		HealthCheckInterval: 20 * time.Millisecond,
+		HealthCheck: func(ctx context.Context, proxyUrl string) error {
+			if healthy.Load() {
+				return nil
+			}
+
+			return errors.New("proxy down")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	assert.Eventually(t, func() bool { return len(pool.Available()) == 0 }, time.Second, 10*time.Millisecond)
+
+	healthy.Store(true)
+	assert.Eventually(t, func() bool { return len(pool.Available()) == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestProxyPool_HealthCheckClientDialer(t *testing.T) {
+	proxy := newConnectProxy(t)
+
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(proxy.url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{{Url: "http://proxy.test:" + port}}, tls_client.ProxyPoolOptions{
+		MaxFailures:         1,
+		Cooldown:            time.Hour,
+		HealthCheckInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// the host of the proxy only resolves with the resolver of the client
+	_, err = tls_client.NewHttpClient(nil,
+		tls_client.WithResolver(tls_client.NewStaticResolver(map[string][]net.IP{"proxy.test": {net.IPv4(127, 0, 0, 1)}}, nil)),
+		tls_client.WithProxyPool(pool),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Eventually(t, func() bool { return proxy.connections.Load() > 0 }, time.Second, 10*time.Millisecond)
+	assert.Len(t, pool.Available(), 1)
+}
+
+func TestProxyPool_ClientSessionPerCookieJar(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	first := newConnectProxy(t)
+	second := newConnectProxy(t)
+
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{{Url: first.url}, {Url: second.url}}, tls_client.ProxyPoolOptions{Stickiness: tls_client.ProxyStickinessSession})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithCookieJar(tls_client.NewCookieJar()),
+		tls_client.WithProxyPool(pool),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func() {
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = doEchoRequest(t, client, req)
+	}
+
+	request()
+	request()
+
+	assert.Equal(t, int32(1), first.connects.Load())
+	assert.Equal(t, int32(0), second.connects.Load())
+
+	// a new cookie jar is a new session, which gets the next proxy
+	client.SetCookieJar(tls_client.NewCookieJar())
+	request()
+
+	assert.Equal(t, int32(1), second.connects.Load())
+}
+
+func TestProxyPool_Client(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	first := newConnectProxy(t)
+	second := newConnectProxy(t)
+
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{{Url: first.url}, {Url: second.url}}, tls_client.ProxyPoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithProxyPool(pool),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chrome, err := profiles.Chrome_146.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response := doEchoRequest(t, client, req)
+		assert.Equal(t, chrome.JA4, response.TLS.JA4)
+	}
+
+	// every proxy has its own transport, the connections are reused per proxy
+	assert.Equal(t, int32(1), first.connects.Load())
+	assert.Equal(t, int32(1), second.connects.Load())
+
+	assert.Error(t, client.SetProxy(first.url))
+}
+
+func TestProxyPool_ClientFailover(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	working := newConnectProxy(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing listens on the port of the broken proxy anymore
+	brokenUrl := "http://" + listener.Addr().String()
+	listener.Close()
+
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{{Url: brokenUrl}, {Url: working.url}}, tls_client.ProxyPoolOptions{MaxFailures: 1, Cooldown: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithProxyPool(pool),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Do(req)
+	assert.Error(t, err)
+	assert.Equal(t, []string{working.url}, pool.Available())
+
+	req, err = http.NewRequest(http.MethodGet, server.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doEchoRequest(t, client, req)
+	assert.Equal(t, int32(1), working.connects.Load())
+}
+
+func TestProxyPool_ClientTargetFailure(t *testing.T) {
+	working := newConnectProxy(t)
+
+	// the target accepts the connection of the proxy and closes it, so the TLS handshake fails behind a working proxy
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			_ = conn.Close()
+		}
+	}()
+
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{{Url: working.url}}, tls_client.ProxyPoolOptions{MaxFailures: 1, Cooldown: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithProxyPool(pool),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://"+listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Do(req)
+	assert.Error(t, err)
+	assert.Equal(t, []string{working.url}, pool.Available())
+}
+
+func TestConfigValidation_ProxyPoolWithProxyUrl(t *testing.T) {
+	pool, err := tls_client.NewProxyPool([]tls_client.PoolProxy{{Url: "http://127.0.0.1:1001"}}, tls_client.ProxyPoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tls_client.NewHttpClient(nil, tls_client.WithProxyPool(pool), tls_client.WithProxyUrl("http://127.0.0.1:1002"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyProtocol_V1(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	relay := newProxyProtocolRelay(t, server.Addr())
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithProxyProtocolHeader(&tls_client.ProxyProtocolHeader{Version: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, relayPort, _ := net.SplitHostPort(relay.addr)
+
+	req, err := http.NewRequest(http.MethodGet, "https://127.0.0.1:"+relayPort, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echoResponse := doEchoRequest(t, client, req)
+	assert.Equal(t, "h2", echoResponse.HTTPVersion)
+
+	headers := relay.receivedHeaders()
+	if assert.Len(t, headers, 1) {
+		// the addresses of the connection are sent by default
+		header := string(headers[0])
+		assert.True(t, strings.HasPrefix(header, "PROXY TCP4 127.0.0.1 127.0.0.1 "), header)
+		assert.True(t, strings.HasSuffix(header, " "+relayPort+"\r\n"), header)
+	}
+}
+
+func TestProxyProtocol_V2(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	relay := newProxyProtocolRelay(t, server.Addr())
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithProxyProtocolHeader(&tls_client.ProxyProtocolHeader{
+			Version:         2,
+			SourceAddr:      &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51000},
+			DestinationAddr: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443},
+			TLVs: []tls_client.ProxyProtocolTLV{
+				{Type: tls_client.ProxyProtocolTLVTypeAuthority, Value: []byte("example.com")},
+				{Type: 0xe0, Value: []byte{0x01, 0x02}},
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, relayPort, _ := net.SplitHostPort(relay.addr)
+
+	req, err := http.NewRequest(http.MethodGet, "https://127.0.0.1:"+relayPort, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doEchoRequest(t, client, req)
+
+	expected := []byte{0x0d, 0x0a, 0x0d, 0x0a, 0x00, 0x0d, 0x0a, 0x51, 0x55, 0x49, 0x54, 0x0a, 0x21, 0x11, 0x00, 12 + 14 + 5}
+	expected = append(expected, 203, 0, 113, 7, 198, 51, 100, 1, 0xc7, 0x38, 0x01, 0xbb)
+	expected = append(expected, 0x02, 0x00, 11)
+	expected = append(expected, "example.com"...)
+	expected = append(expected, 0xe0, 0x00, 0x02, 0x01, 0x02)
+
+	headers := relay.receivedHeaders()
+	if assert.Len(t, headers, 1) {
+		assert.Equal(t, expected, headers[0])
+	}
+}
+
+func TestProxyProtocol_InvalidHeader(t *testing.T) {
+	testCases := []struct {
+		name   string
+		header *tls_client.ProxyProtocolHeader
+	}{
+		{"unknown version", &tls_client.ProxyProtocolHeader{Version: 3}},
+		{"tlvs with version 1", &tls_client.ProxyProtocolHeader{Version: 1, TLVs: []tls_client.ProxyProtocolTLV{{Type: tls_client.ProxyProtocolTLVTypeNOOP}}}},
+	}
+
+	for _, testCase := range testCases {
+		_, err := tls_client.NewHttpClient(nil, tls_client.WithProxyProtocolHeader(testCase.header))
+		assert.Error(t, err, testCase.name)
+	}
+}
+
+func TestProxyProtocol_NoHTTP3(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// the origin behind the relay advertises HTTP/3 on the echo server, which gets no PROXY protocol header over QUIC
+	origin := newAltSvcOrigin(t, `h3=":`+strconv.Itoa(server.Port())+`"; ma=60`)
+	relay := newProxyProtocolRelay(t, origin.Listener.Addr().String())
+
+	rootCAs := server.RootCAs().Clone()
+	rootCAs.AddCert(origin.Certificate())
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: rootCAs}),
+		tls_client.WithAltSvcCache(nil),
+		tls_client.WithProxyProtocolHeader(&tls_client.ProxyProtocolHeader{Version: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, "origin", doOriginRequest(t, client, "https://"+relay.addr))
+	}
+
+	_, err = tls_client.NewHttpClient(nil,
+		tls_client.WithProtocolRacing(),
+		tls_client.WithProxyProtocolHeader(&tls_client.ProxyProtocolHeader{Version: 1}),
+	)
+	assert.Error(t, err)
+}
+
+func TestProxyProtocol_ThroughProxy(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	relay := newProxyProtocolRelay(t, server.Addr())
+	proxy := newConnectProxy(t)
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+		tls_client.WithProxyUrl(proxy.url),
+		tls_client.WithProxyProtocolHeader(&tls_client.ProxyProtocolHeader{
+			Version:         1,
+			SourceAddr:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51000},
+			DestinationAddr: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, relayPort, _ := net.SplitHostPort(relay.addr)
+
+	req, err := http.NewRequest(http.MethodGet, "https://127.0.0.1:"+relayPort, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doEchoRequest(t, client, req)
+
+	// the header is written into the tunnel, so it reaches the target and not the proxy
+	assert.Equal(t, int32(1), proxy.connects.Load())
+	assert.Equal(t, [][]byte{[]byte("PROXY TCP6 2001:db8::1 2001:db8::2 51000 443\r\n")}, relay.receivedHeaders())
+}
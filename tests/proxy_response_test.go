@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"errors"
+	stdhttp "net/http"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyError(t *testing.T) {
+	testCases := []struct {
+		name        string
+		withTLS     bool
+		enableHttp2 bool
+	}{
+		{"http/1.1", false, false},
+		{"h2", true, true},
+	}
+
+	for _, testCase := range testCases {
+		proxy := newAuthConnectProxy(t, testCase.withTLS, testCase.enableHttp2, func(w stdhttp.ResponseWriter, r *stdhttp.Request) bool {
+			w.Header().Set("X-Proxy-Session", "session-1")
+			w.WriteHeader(stdhttp.StatusForbidden)
+
+			return false
+		})
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: proxy.rootCAs}),
+			tls_client.WithProxyUrl(proxy.url),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "https://127.0.0.1:1/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.Do(req)
+
+		var proxyErr *tls_client.ProxyError
+		if assert.True(t, errors.As(err, &proxyErr), testCase.name) {
+			assert.Equal(t, http.StatusForbidden, proxyErr.StatusCode, testCase.name)
+			assert.Equal(t, "session-1", proxyErr.Header.Get("X-Proxy-Session"), testCase.name)
+		}
+	}
+}
+
+func TestProxyConnectResponse(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	testCases := []struct {
+		name        string
+		withTLS     bool
+		enableHttp2 bool
+	}{
+		{"http/1.1", false, false},
+		{"h2", true, true},
+	}
+
+	for _, testCase := range testCases {
+		proxy := newAuthConnectProxy(t, testCase.withTLS, testCase.enableHttp2, func(w stdhttp.ResponseWriter, r *stdhttp.Request) bool {
+			w.Header().Set("X-Exit-Ip", "203.0.113.7")
+
+			return true
+		})
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithClientProfile(profiles.Chrome_146),
+			tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+			tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: proxy.rootCAs}),
+			tls_client.WithProxyUrl(proxy.url),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var connectResponses []*http.Response
+		client.AddPostResponseHook(func(ctx *tls_client.PostResponseContext) error {
+			connectResponses = append(connectResponses, ctx.ProxyConnectResponse)
+			return nil
+		})
+
+		// the second request reuses the connection and still knows the response of the proxy
+		for i := 0; i < 2; i++ {
+			req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			doEchoRequest(t, client, req)
+		}
+
+		assert.Equal(t, int32(1), proxy.connects.Load(), testCase.name)
+
+		if assert.Len(t, connectResponses, 2, testCase.name) {
+			for _, connectResponse := range connectResponses {
+				if assert.NotNil(t, connectResponse, testCase.name) {
+					assert.Equal(t, http.StatusOK, connectResponse.StatusCode, testCase.name)
+					assert.Equal(t, "203.0.113.7", connectResponse.Header.Get("X-Exit-Ip"), testCase.name)
+				}
+			}
+		}
+	}
+}
+
+func TestProxyConnectResponse_Status(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	testCases := []struct {
+		name        string
+		withTLS     bool
+		enableHttp2 bool
+	}{
+		{"http/1.1", false, false},
+		{"h2", true, true},
+	}
+
+	for _, testCase := range testCases {
+		proxy := newAuthConnectProxy(t, testCase.withTLS, testCase.enableHttp2, nil)
+		// any 2xx response establishes the tunnel
+		proxy.establishedStatus.Store(http.StatusCreated)
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithClientProfile(profiles.Chrome_146),
+			tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+			tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: proxy.rootCAs}),
+			tls_client.WithProxyUrl(proxy.url),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var connectResponse *http.Response
+		client.AddPostResponseHook(func(ctx *tls_client.PostResponseContext) error {
+			connectResponse = ctx.ProxyConnectResponse
+			return nil
+		})
+
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		doEchoRequest(t, client, req)
+
+		if assert.NotNil(t, connectResponse, testCase.name) {
+			assert.Equal(t, http.StatusCreated, connectResponse.StatusCode, testCase.name)
+		}
+	}
+}
@@ -0,0 +1,878 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/bogdanfinn/quic-go-utls"
+	"github.com/bogdanfinn/quic-go-utls/http3"
+	"github.com/bogdanfinn/quic-go-utls/quicvarint"
+	tls "github.com/bogdanfinn/utls"
+)
+
+// connectProxy is a local http proxy which only supports CONNECT. It counts the proxy connections and the tunnels.
+type connectProxy struct {
+	url         string
+	rootCAs     *x509.CertPool
+	certificate *x509.Certificate
+	// connections is the number of accepted proxy connections
+	connections atomic.Int32
+	// connects is the number of established tunnels
+	connects atomic.Int32
+	// establishedStatus is the status code of the response which establishes a tunnel, 0 responds with 200
+	establishedStatus atomic.Int32
+	// authenticate answers the CONNECT request itself and returns false if the client is not authenticated yet
+	authenticate func(w stdhttp.ResponseWriter, r *stdhttp.Request) bool
+
+	mu           sync.Mutex
+	tunnels      []net.Conn
+	clientHellos [][]byte
+}
+
+// newConnectProxy starts a plain http proxy.
+func newConnectProxy(t *testing.T) *connectProxy {
+	return startConnectProxy(t, false, false, nil)
+}
+
+// newTLSConnectProxy starts an https proxy with a certificate for 127.0.0.1 which supports h2 CONNECT if enableHttp2 is set.
+func newTLSConnectProxy(t *testing.T, enableHttp2 bool) *connectProxy {
+	return startConnectProxy(t, true, enableHttp2, nil)
+}
+
+// newAuthConnectProxy starts an http or https proxy which only opens tunnels for clients accepted by authenticate.
+func newAuthConnectProxy(t *testing.T, withTLS bool, enableHttp2 bool, authenticate func(w stdhttp.ResponseWriter, r *stdhttp.Request) bool) *connectProxy {
+	return startConnectProxy(t, withTLS, enableHttp2, authenticate)
+}
+
+func startConnectProxy(t *testing.T, withTLS bool, enableHttp2 bool, authenticate func(w stdhttp.ResponseWriter, r *stdhttp.Request) bool) *connectProxy {
+	t.Helper()
+
+	p := &connectProxy{authenticate: authenticate}
+
+	server := httptest.NewUnstartedServer(stdhttp.HandlerFunc(p.serveHTTP))
+	server.Listener = &proxyListener{Listener: server.Listener, proxy: p}
+
+	if withTLS {
+		server.EnableHTTP2 = enableHttp2
+		server.StartTLS()
+
+		p.certificate = server.Certificate()
+		p.rootCAs = x509.NewCertPool()
+		p.rootCAs.AddCert(p.certificate)
+		p.url = "https://" + server.Listener.Addr().String()
+	} else {
+		server.Start()
+
+		p.url = "http://" + server.Listener.Addr().String()
+	}
+
+	t.Cleanup(func() {
+		p.mu.Lock()
+		for _, conn := range p.tunnels {
+			_ = conn.Close()
+		}
+		p.mu.Unlock()
+
+		server.Close()
+	})
+
+	return p
+}
+
+// clientHello returns the raw ClientHello of the first TLS connection to the proxy.
+func (p *connectProxy) clientHello() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.clientHellos) == 0 {
+		return nil
+	}
+
+	return p.clientHellos[0]
+}
+
+func (p *connectProxy) serveHTTP(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	if r.Method != stdhttp.MethodConnect {
+		w.WriteHeader(stdhttp.StatusMethodNotAllowed)
+		return
+	}
+
+	if p.authenticate != nil && !p.authenticate(w, r) {
+		return
+	}
+
+	target, err := net.DialTimeout("tcp", r.Host, 5*time.Second)
+	if err != nil {
+		w.WriteHeader(stdhttp.StatusBadGateway)
+		return
+	}
+	defer target.Close()
+
+	p.trackTunnel(target)
+	p.connects.Add(1)
+
+	status := stdhttp.StatusOK
+	if establishedStatus := p.establishedStatus.Load(); establishedStatus != 0 {
+		status = int(establishedStatus)
+	}
+
+	if r.ProtoMajor == 2 {
+		w.WriteHeader(status)
+		w.(stdhttp.Flusher).Flush()
+
+		go func() {
+			_, _ = io.Copy(target, r.Body)
+		}()
+
+		_, _ = io.Copy(flushWriter{w}, target)
+
+		return
+	}
+
+	// the headers set by authenticate are sent with the hijacked response as well
+	response := bytes.NewBufferString("HTTP/1.1 " + strconv.Itoa(status) + " " + stdhttp.StatusText(status) + "\r\n")
+	_ = w.Header().Write(response)
+	response.WriteString("\r\n")
+
+	conn, buffered, err := w.(stdhttp.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	p.trackTunnel(conn)
+
+	if _, err := conn.Write(response.Bytes()); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(target, buffered)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, target)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+// trackTunnel registers a connection the server does not close itself, so it can be closed on cleanup.
+func (p *connectProxy) trackTunnel(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.tunnels = append(p.tunnels, conn)
+}
+
+type flushWriter struct {
+	w stdhttp.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.w.(stdhttp.Flusher).Flush()
+
+	return n, err
+}
+
+// proxyListener counts the accepted connections and records the ClientHello of TLS connections.
+type proxyListener struct {
+	net.Listener
+	proxy *connectProxy
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	l.proxy.connections.Add(1)
+
+	return &clientHelloConn{Conn: conn, proxy: l.proxy}, nil
+}
+
+// clientHelloConn records the first TLS record, which contains the whole ClientHello of the clients used in the tests.
+type clientHelloConn struct {
+	net.Conn
+	proxy    *connectProxy
+	received []byte
+	done     bool
+}
+
+func (c *clientHelloConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	if !c.done && n > 0 {
+		c.received = append(c.received, b[:n]...)
+
+		if len(c.received) >= 5 {
+			recordLen := int(binary.BigEndian.Uint16(c.received[3:5]))
+			if c.received[0] != 0x16 {
+				c.done = true
+			} else if len(c.received) >= 5+recordLen {
+				c.done = true
+
+				c.proxy.mu.Lock()
+				c.proxy.clientHellos = append(c.proxy.clientHellos, c.received[5:5+recordLen])
+				c.proxy.mu.Unlock()
+			}
+		}
+	}
+
+	return n, err
+}
+
+// socks5Proxy is a local socks5 proxy which supports CONNECT and UDP ASSOCIATE.
+type socks5Proxy struct {
+	url      string
+	username string
+	password string
+	// connects is the number of established TCP connections
+	connects atomic.Int32
+	// associations is the number of UDP associations
+	associations atomic.Int32
+	// datagrams is the number of datagrams relayed from the client to a target
+	datagrams atomic.Int32
+
+	mu      sync.Mutex
+	conns   []io.Closer
+	targets []string
+}
+
+// newSocks5Proxy starts a socks5 proxy which requires username and password authentication if a username is given.
+func newSocks5Proxy(t *testing.T, username string, password string) *socks5Proxy {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &socks5Proxy{username: username, password: password}
+
+	proxyUrl := url.URL{Scheme: "socks5", Host: listener.Addr().String()}
+	if username != "" {
+		proxyUrl.User = url.UserPassword(username, password)
+	}
+
+	p.url = proxyUrl.String()
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		for _, conn := range p.conns {
+			_ = conn.Close()
+		}
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			p.track(conn)
+
+			go p.serve(conn)
+		}
+	}()
+
+	return p
+}
+
+func (p *socks5Proxy) track(conn io.Closer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.conns = append(p.conns, conn)
+}
+
+func (p *socks5Proxy) serve(conn net.Conn) {
+	defer conn.Close()
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+
+	method := byte(0x00)
+	if p.username != "" {
+		method = 0x02
+	}
+
+	if !bytes.Contains(methods, []byte{method}) {
+		_, _ = conn.Write([]byte{0x05, 0xff})
+		return
+	}
+
+	if _, err := conn.Write([]byte{0x05, method}); err != nil {
+		return
+	}
+
+	if method == 0x02 && !p.authenticate(conn) {
+		return
+	}
+
+	request := make([]byte, 3)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return
+	}
+
+	target, err := readTestSocks5Addr(conn)
+	if err != nil {
+		return
+	}
+
+	switch request[1] {
+	case 0x01:
+		p.connect(conn, target)
+	case 0x03:
+		p.associate(conn)
+	default:
+		_, _ = conn.Write([]byte{0x05, 0x07, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	}
+}
+
+func (p *socks5Proxy) authenticate(conn net.Conn) bool {
+	version := make([]byte, 2)
+	if _, err := io.ReadFull(conn, version); err != nil {
+		return false
+	}
+
+	username := make([]byte, version[1])
+	if _, err := io.ReadFull(conn, username); err != nil {
+		return false
+	}
+
+	length := make([]byte, 1)
+	if _, err := io.ReadFull(conn, length); err != nil {
+		return false
+	}
+
+	password := make([]byte, length[0])
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return false
+	}
+
+	if string(username) != p.username || string(password) != p.password {
+		_, _ = conn.Write([]byte{0x01, 0x01})
+		return false
+	}
+
+	_, err := conn.Write([]byte{0x01, 0x00})
+
+	return err == nil
+}
+
+func (p *socks5Proxy) connect(conn net.Conn, target string) {
+	targetConn, err := net.DialTimeout("tcp", target, 5*time.Second)
+	if err != nil {
+		_, _ = conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer targetConn.Close()
+
+	p.track(targetConn)
+	p.connects.Add(1)
+
+	p.mu.Lock()
+	p.targets = append(p.targets, target)
+	p.mu.Unlock()
+
+	if _, err := conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0}); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(targetConn, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, targetConn)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+// associate relays the datagrams of the client until the control connection is closed.
+func (p *socks5Proxy) associate(conn net.Conn) {
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		_, _ = conn.Write([]byte{0x05, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer relay.Close()
+
+	p.track(relay)
+	p.associations.Add(1)
+
+	relayAddr := relay.LocalAddr().(*net.UDPAddr)
+	reply := append([]byte{0x05, 0x00, 0x00, 0x01}, relayAddr.IP.To4()...)
+	reply = binary.BigEndian.AppendUint16(reply, uint16(relayAddr.Port))
+	if _, err := conn.Write(reply); err != nil {
+		return
+	}
+
+	go func() {
+		var client *net.UDPAddr
+		buf := make([]byte, 64*1024)
+
+		for {
+			n, from, err := relay.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			if client == nil || from.String() == client.String() {
+				client = from
+
+				target, payload, err := parseTestSocks5Datagram(buf[:n])
+				if err != nil {
+					continue
+				}
+
+				targetAddr, err := net.ResolveUDPAddr("udp", target)
+				if err != nil {
+					continue
+				}
+
+				p.datagrams.Add(1)
+				_, _ = relay.WriteToUDP(payload, targetAddr)
+
+				continue
+			}
+
+			datagram := []byte{0x00, 0x00, 0x00, 0x01}
+			datagram = append(datagram, from.IP.To4()...)
+			datagram = binary.BigEndian.AppendUint16(datagram, uint16(from.Port))
+			datagram = append(datagram, buf[:n]...)
+
+			_, _ = relay.WriteToUDP(datagram, client)
+		}
+	}()
+
+	_, _ = io.Copy(io.Discard, conn)
+}
+
+func parseTestSocks5Datagram(datagram []byte) (string, []byte, error) {
+	if len(datagram) < 4 || datagram[2] != 0x00 {
+		return "", nil, errors.New("invalid datagram")
+	}
+
+	reader := bytes.NewReader(datagram[3:])
+
+	target, err := readTestSocks5Addr(reader)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return target, datagram[len(datagram)-reader.Len():], nil
+}
+
+func readTestSocks5Addr(r io.Reader) (string, error) {
+	addrType := make([]byte, 1)
+	if _, err := io.ReadFull(r, addrType); err != nil {
+		return "", err
+	}
+
+	var host []byte
+	switch addrType[0] {
+	case 0x01:
+		host = make([]byte, 4)
+	case 0x04:
+		host = make([]byte, 16)
+	case 0x03:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(r, length); err != nil {
+			return "", err
+		}
+
+		host = make([]byte, length[0])
+	default:
+		return "", errors.New("unknown address type")
+	}
+
+	if _, err := io.ReadFull(r, host); err != nil {
+		return "", err
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+
+	hostname := string(host)
+	if addrType[0] != 0x03 {
+		hostname = net.IP(host).String()
+	}
+
+	return net.JoinHostPort(hostname, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// masqueProxy is a local HTTP/3 proxy which supports CONNECT and CONNECT-UDP.
+type masqueProxy struct {
+	url     string
+	rootCAs *x509.CertPool
+	// connections is the number of QUIC connections to the proxy
+	connections atomic.Int32
+	// connects is the number of TCP tunnels
+	connects atomic.Int32
+	// udpTunnels is the number of CONNECT-UDP tunnels
+	udpTunnels atomic.Int32
+	// datagrams is the number of datagrams relayed from the client to a target
+	datagrams atomic.Int32
+
+	mu       sync.Mutex
+	settings *http3.Settings
+	conns    []io.Closer
+}
+
+// newMasqueProxy starts a masque proxy with a certificate for 127.0.0.1.
+func newMasqueProxy(t *testing.T) *masqueProxy {
+	t.Helper()
+
+	certificate, rootCAs := newTestCertificate(t)
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &masqueProxy{
+		url:     "masque://" + udpConn.LocalAddr().String(),
+		rootCAs: rootCAs,
+	}
+
+	server := &http3.Server{
+		TLSConfig:       http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{certificate}}),
+		EnableDatagrams: true,
+		Handler:         http.HandlerFunc(p.serveHTTP3),
+		ConnContext: func(ctx context.Context, _ *quic.Conn) context.Context {
+			p.connections.Add(1)
+			return ctx
+		},
+	}
+
+	go func() {
+		_ = server.Serve(udpConn)
+	}()
+
+	t.Cleanup(func() {
+		p.mu.Lock()
+		for _, conn := range p.conns {
+			_ = conn.Close()
+		}
+		p.mu.Unlock()
+
+		_ = server.Close()
+		_ = udpConn.Close()
+	})
+
+	return p
+}
+
+// receivedSettings returns the HTTP/3 settings of the first client connection.
+func (p *masqueProxy) receivedSettings() *http3.Settings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.settings
+}
+
+func (p *masqueProxy) track(conn io.Closer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.conns = append(p.conns, conn)
+}
+
+func (p *masqueProxy) serveHTTP3(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	conn := w.(http3.Hijacker).Connection()
+	<-conn.ReceivedSettings()
+
+	p.mu.Lock()
+	if p.settings == nil {
+		p.settings = conn.Settings()
+	}
+	p.mu.Unlock()
+
+	switch r.Proto {
+	case "connect-udp":
+		p.connectUDP(w, r)
+	case "HTTP/3.0":
+		p.connect(w, r)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (p *masqueProxy) connect(w http.ResponseWriter, r *http.Request) {
+	target, err := net.DialTimeout("tcp", r.Host, 5*time.Second)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer target.Close()
+
+	p.track(target)
+	p.connects.Add(1)
+
+	w.WriteHeader(http.StatusOK)
+	str := w.(http3.HTTPStreamer).HTTPStream()
+	defer str.Close()
+
+	go func() {
+		_, _ = io.Copy(target, str)
+		_ = target.Close()
+	}()
+
+	_, _ = io.Copy(str, target)
+}
+
+func (p *masqueProxy) connectUDP(w http.ResponseWriter, r *http.Request) {
+	// /.well-known/masque/udp/{target_host}/{target_port}/
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) != 5 || segments[2] != "udp" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	target, err := net.Dial("udp", net.JoinHostPort(segments[3], segments[4]))
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer target.Close()
+
+	p.track(target)
+	p.udpTunnels.Add(1)
+
+	w.Header().Set("Capsule-Protocol", "?1")
+	w.WriteHeader(http.StatusOK)
+	str := w.(http3.HTTPStreamer).HTTPStream()
+	defer str.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		for {
+			datagram, err := str.ReceiveDatagram(ctx)
+			if err != nil {
+				return
+			}
+
+			// the context id 0 carries UDP payloads
+			contextID, n, err := quicvarint.Parse(datagram)
+			if err != nil || contextID != 0 {
+				continue
+			}
+
+			p.datagrams.Add(1)
+			_, _ = target.Write(datagram[n:])
+		}
+	}()
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, err := target.Read(buf)
+			if err != nil {
+				return
+			}
+
+			_ = str.SendDatagram(append([]byte{0}, buf[:n]...))
+		}
+	}()
+
+	// the tunnel ends when the client closes the stream
+	_, _ = io.Copy(io.Discard, str)
+}
+
+// newTestCertificate creates a self-signed certificate for 127.0.0.1 and a pool which trusts it.
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"tls-client test proxy"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(certificate)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: privateKey}, rootCAs
+}
+
+// proxyProtocolRelay accepts connections starting with a PROXY protocol header, records the header and relays the rest
+// of the connection to the target, like a load balancer in front of the target.
+type proxyProtocolRelay struct {
+	addr string
+
+	mu      sync.Mutex
+	headers [][]byte
+	conns   []io.Closer
+}
+
+func newProxyProtocolRelay(t *testing.T, target string) *proxyProtocolRelay {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &proxyProtocolRelay{addr: listener.Addr().String()}
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for _, conn := range r.conns {
+			_ = conn.Close()
+		}
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go r.relay(conn, target)
+		}
+	}()
+
+	return r
+}
+
+func (r *proxyProtocolRelay) receivedHeaders() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([][]byte(nil), r.headers...)
+}
+
+func (r *proxyProtocolRelay) relay(conn net.Conn, target string) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	header, err := readTestProxyProtocolHeader(reader)
+	if err != nil {
+		return
+	}
+
+	targetConn, err := net.DialTimeout("tcp", target, 5*time.Second)
+	if err != nil {
+		return
+	}
+	defer targetConn.Close()
+
+	r.mu.Lock()
+	r.headers = append(r.headers, header)
+	r.conns = append(r.conns, conn, targetConn)
+	r.mu.Unlock()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(targetConn, reader)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, targetConn)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+// readTestProxyProtocolHeader reads a version 1 header up to the line break or a version 2 header up to its length.
+func readTestProxyProtocolHeader(reader *bufio.Reader) ([]byte, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] == 'P' {
+		return reader.ReadBytes('\n')
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+
+	return append(header, payload...), nil
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocks5Proxy_HTTP3(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	testCases := []struct {
+		name     string
+		username string
+		password string
+		scheme   string
+	}{
+		{"no authentication", "", "", "socks5"},
+		{"password authentication", "user", "pass", "socks5"},
+		{"remote dns", "", "", "socks5h"},
+	}
+
+	for _, testCase := range testCases {
+		proxy := newSocks5Proxy(t, testCase.username, testCase.password)
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithClientProfile(profiles.Chrome_144),
+			tls_client.WithProtocolRacing(),
+			tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+			tls_client.WithProxyUrl(strings.Replace(proxy.url, "socks5", testCase.scheme, 1)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		echoResponse := doEchoRequest(t, client, req)
+
+		// QUIC is tunneled through the proxy, whichever protocol won the race
+		assert.Equal(t, int32(1), proxy.associations.Load(), testCase.name)
+		assert.Greater(t, proxy.datagrams.Load(), int32(0), testCase.name)
+
+		if echoResponse.HTTPVersion != "h3" {
+			t.Logf("%s: protocol racing selected %s", testCase.name, echoResponse.HTTPVersion)
+			continue
+		}
+
+		assert.NotEmpty(t, echoResponse.HTTP3.Settings, testCase.name)
+	}
+}
+
+func TestSocks5Proxy_Resolver(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	proxy := newSocks5Proxy(t, "", "")
+
+	// the host can only be resolved by the resolver
+	resolver := &countingResolver{Resolver: tls_client.NewStaticResolver(map[string][]net.IP{
+		"resolver.test": {net.IPv4(127, 0, 0, 1)},
+	}, nil)}
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithInsecureSkipVerify(),
+		tls_client.WithDisableHttp3(),
+		tls_client.WithResolver(resolver),
+		tls_client.WithProxyUrl(proxy.url),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://resolver.test:"+strconv.Itoa(server.Port()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echoResponse := doEchoRequest(t, client, req)
+	assert.Equal(t, "h2", echoResponse.HTTPVersion)
+	assert.NotZero(t, resolver.lookups.Load())
+
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+
+	assert.Equal(t, []string{"127.0.0.1:" + strconv.Itoa(server.Port())}, proxy.targets)
+}
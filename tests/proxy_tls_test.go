@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+	"github.com/tam7t/hpkp"
+)
+
+func TestProxyTLS_Fingerprint(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	chrome, err := profiles.Chrome_146.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	safari, err := profiles.Safari_IOS_18_5.GetFingerprintReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name          string
+		proxyProfile  *profiles.ClientProfile
+		expectedProxy string
+	}{
+		{"client profile", nil, chrome.JA4},
+		{"other profile", &profiles.Safari_IOS_18_5, safari.JA4},
+	}
+
+	for _, testCase := range testCases {
+		proxy := newTLSConnectProxy(t, false)
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithClientProfile(profiles.Chrome_146),
+			tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+			tls_client.WithProxyUrl(proxy.url),
+			tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{ClientProfile: testCase.proxyProfile, RootCAs: proxy.rootCAs}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response := doEchoRequest(t, client, req)
+		assert.Equal(t, chrome.JA4, response.TLS.JA4, testCase.name)
+
+		clientHello, err := profiles.ParseClientHello(proxy.clientHello())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the proxy is dialed by ip, so the ClientHello has no server name. only the hashes of the ciphers and extensions are compared
+		assert.Equal(t, ja4Hashes(testCase.expectedProxy), ja4Hashes(clientHello.JA4()), testCase.name)
+	}
+}
+
+func TestProxyTLS_CertificatePins(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	proxy := newTLSConnectProxy(t, false)
+
+	testCases := []struct {
+		name    string
+		pins    []string
+		success bool
+	}{
+		{"matching pin", []string{hpkp.Fingerprint(proxy.certificate)}, true},
+		{"wrong pin", []string{"NQvy9sFS99nBqk/nZCUF44hFhshrkvxqYtfrZq3i+Ww="}, false},
+	}
+
+	for _, testCase := range testCases {
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.RootCAs()}),
+			tls_client.WithProxyUrl(proxy.url),
+			tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: proxy.rootCAs, CertificatePins: testCase.pins}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Do(req)
+		if testCase.success {
+			assert.NoError(t, err, testCase.name)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+		} else {
+			assert.ErrorIs(t, err, tls_client.ErrBadPinDetected, testCase.name)
+		}
+	}
+}
+
+func TestProxyTLS_Http2Multiplexing(t *testing.T) {
+	var servers []*echoserver.Server
+	for i := 0; i < 3; i++ {
+		server, err := echoserver.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+
+		servers = append(servers, server)
+	}
+
+	proxy := newTLSConnectProxy(t, true)
+
+	var options []tls_client.HttpClientOption
+	options = append(options,
+		tls_client.WithProxyUrl(proxy.url),
+		tls_client.WithProxyTLSOptions(&tls_client.ProxyTLSOptions{RootCAs: proxy.rootCAs}),
+		// every echo server has its own root CA, the certificate chain of the origins is not part of this test
+		tls_client.WithInsecureSkipVerify(),
+	)
+
+	client, err := tls_client.NewHttpClient(nil, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(server *echoserver.Server) {
+		req, err := http.NewRequest(http.MethodGet, server.URL(), nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		_ = resp.Body.Close()
+	}
+
+	// the second request reuses the tunnel of the first one
+	request(servers[0])
+	request(servers[0])
+
+	var wg sync.WaitGroup
+	for _, server := range servers[1:] {
+		wg.Add(1)
+
+		go func(server *echoserver.Server) {
+			defer wg.Done()
+			request(server)
+		}(server)
+	}
+
+	wg.Wait()
+
+	// every origin has its own tunnel, all of them share one h2 connection to the proxy
+	assert.Equal(t, int32(3), proxy.connects.Load())
+	assert.Equal(t, int32(1), proxy.connections.Load())
+}
+
+func ja4Hashes(ja4 string) string {
+	_, hashes, _ := strings.Cut(ja4, "_")
+
+	return hashes
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithResolveOverrides(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	testCases := []struct {
+		name                string
+		option              tls_client.HttpClientOption
+		expectedHTTPVersion string
+	}{
+		{"h2", tls_client.WithDisableHttp3(), "h2"},
+		{"h3", tls_client.WithProtocolRacing(), "h3"},
+		{"happy eyeballs", tls_client.WithHappyEyeballs(nil), "h2"},
+	}
+
+	hostPort := "override.test:" + strconv.Itoa(server.Port())
+
+	for _, testCase := range testCases {
+		// the host can only be dialed through the override, the resolver is not asked for it
+		resolver := &countingResolver{Resolver: tls_client.NewStaticResolver(nil, nil)}
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithClientProfile(profiles.Chrome_146),
+			tls_client.WithInsecureSkipVerify(),
+			tls_client.WithResolver(resolver),
+			tls_client.WithResolveOverrides(map[string][]net.IP{
+				"Override.test:" + strconv.Itoa(server.Port()): {net.IPv4(127, 0, 0, 1)},
+			}),
+			testCase.option,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "https://"+hostPort, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		echoResponse := doEchoRequest(t, client, req)
+		assert.Equal(t, testCase.expectedHTTPVersion, echoResponse.HTTPVersion, testCase.name)
+		assert.Equal(t, "override.test", echoResponse.TLS.ServerName, testCase.name)
+		assert.Zero(t, resolver.lookups.Load(), testCase.name)
+	}
+}
@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"context"
+	stdtls "crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+	tls_client "github.com/bogdanfinn/tls-client"
+	"github.com/bogdanfinn/tls-client/echoserver"
+	"github.com/bogdanfinn/tls-client/profiles"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// countingResolver counts the lookups of the resolver.
+type countingResolver struct {
+	tls_client.Resolver
+	lookups atomic.Int32
+}
+
+func (r *countingResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	r.lookups.Add(1)
+
+	return r.Resolver.LookupIP(ctx, network, host)
+}
+
+func newResolverTestZone() map[string][]dnsmessage.Resource {
+	return map[string][]dnsmessage.Resource{
+		"example.com.": {
+			newAddressResource("example.com.", 60, net.IPv4(127, 0, 0, 1)),
+			newAddressResource("example.com.", 30, net.ParseIP("::1")),
+		},
+	}
+}
+
+func assertResolverTestZone(t *testing.T, resolver tls_client.TTLResolver) {
+	t.Helper()
+
+	ips, ttl, err := resolver.LookupIPWithTTL(context.Background(), "ip", "example.com")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []net.IP{net.IPv4(127, 0, 0, 1).To4(), net.ParseIP("::1")}, ips)
+		assert.Equal(t, 30*time.Second, ttl)
+	}
+
+	ips, err = resolver.LookupIP(context.Background(), "ip6", "example.com")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []net.IP{net.ParseIP("::1")}, ips)
+	}
+
+	_, err = resolver.LookupIP(context.Background(), "ip", "unknown.example.com")
+
+	var dnsErr *net.DNSError
+	if assert.True(t, errors.As(err, &dnsErr), "expected a dns error, got %v", err) {
+		assert.True(t, dnsErr.IsNotFound)
+	}
+}
+
+func TestDoHResolver(t *testing.T) {
+	stub := newDNSStub(t, newResolverTestZone())
+
+	var requests atomic.Int32
+
+	server := httptest.NewTLSServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		requests.Add(1)
+
+		query, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+
+		// the id of the queries is 0 (RFC 8484, section 4.1)
+		if r.Method != stdhttp.MethodGet || r.Header.Get("Accept") != "application/dns-message" || err != nil || query[0] != 0 || query[1] != 0 {
+			w.WriteHeader(stdhttp.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(stub.answer(query, false))
+	}))
+	defer server.Close()
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithTransportOptions(&tls_client.TransportOptions{RootCAs: server.Client().Transport.(*stdhttp.Transport).TLSClientConfig.RootCAs}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err := tls_client.NewDoHResolver(server.URL+"/dns-query", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertResolverTestZone(t, resolver)
+
+	// the queries are sent through the client
+	assert.Equal(t, requests.Load(), stub.queries.Load())
+
+	_, err = tls_client.NewDoHResolver("http://dns.example.com/dns-query", client)
+	assert.Error(t, err)
+}
+
+func TestDoTResolver(t *testing.T) {
+	zone := newResolverTestZone()
+	zone["example.com."] = append(zone["example.com."], newHTTPSResource("example.com.", 1, ".", svcParamALPN("h2")))
+
+	stub := newDNSStub(t, zone)
+
+	// the certificate of the test server is valid for example.com
+	certificateServer := httptest.NewTLSServer(nil)
+	certificateServer.Close()
+
+	addr := stub.listenTLS(t, &stdtls.Config{Certificates: certificateServer.TLS.Certificates})
+
+	resolver := tls_client.NewDoTResolver(addr, &tls_client.DoTResolverOptions{
+		ServerName: "example.com",
+		RootCAs:    certificateServer.Client().Transport.(*stdhttp.Transport).TLSClientConfig.RootCAs,
+	})
+
+	assertResolverTestZone(t, resolver)
+
+	// the HTTPS records are queried from the same server
+	records, err := resolver.LookupHTTPS(context.Background(), "example.com")
+	if assert.NoError(t, err) && assert.Len(t, records, 1) {
+		assert.Equal(t, []string{"h2"}, records[0].ALPN)
+	}
+}
+
+func TestWithResolver(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	testCases := []struct {
+		name                string
+		option              tls_client.HttpClientOption
+		expectedHTTPVersion string
+	}{
+		{"h2", tls_client.WithDisableHttp3(), "h2"},
+		{"h3", tls_client.WithProtocolRacing(), "h3"},
+		{"happy eyeballs", tls_client.WithHappyEyeballs(nil), "h2"},
+	}
+
+	for _, testCase := range testCases {
+		// the host can only be resolved by the resolver
+		resolver := &countingResolver{Resolver: tls_client.NewStaticResolver(map[string][]net.IP{
+			"resolver.test": {net.IPv4(127, 0, 0, 1)},
+		}, nil)}
+
+		client, err := tls_client.NewHttpClient(nil,
+			tls_client.WithClientProfile(profiles.Chrome_146),
+			tls_client.WithInsecureSkipVerify(),
+			tls_client.WithResolver(resolver),
+			testCase.option,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "https://resolver.test:"+strconv.Itoa(server.Port()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		echoResponse := doEchoRequest(t, client, req)
+		assert.Equal(t, testCase.expectedHTTPVersion, echoResponse.HTTPVersion, testCase.name)
+		assert.NotZero(t, resolver.lookups.Load(), testCase.name)
+	}
+}
+
+func TestWithResolver_HTTP3DisableIPV6(t *testing.T) {
+	server, err := echoserver.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// nothing listens on ::1, so QUIC only reaches the server if the resolver is asked for IPv4 addresses
+	resolver := tls_client.NewStaticResolver(map[string][]net.IP{
+		"resolver.test": {net.ParseIP("::1"), net.IPv4(127, 0, 0, 1)},
+	}, nil)
+
+	client, err := tls_client.NewHttpClient(nil,
+		tls_client.WithClientProfile(profiles.Chrome_146),
+		tls_client.WithInsecureSkipVerify(),
+		tls_client.WithResolver(resolver),
+		tls_client.WithProtocolRacing(),
+		tls_client.WithDisableIPV6(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://resolver.test:"+strconv.Itoa(server.Port()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echoResponse := doEchoRequest(t, client, req)
+	assert.Equal(t, "h3", echoResponse.HTTPVersion)
+}
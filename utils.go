@@ -6,6 +6,11 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"slices"
+	"sort"
+	"strings"
+
+	http "github.com/bogdanfinn/fhttp"
 )
 
 func Int64ToInt(x int64) (int, error) {
@@ -37,3 +42,48 @@ func generateGREASESettingValue() uint64 {
 	}
 	return uint64(val)
 }
+
+// mergeHeaders returns a copy of base with all headers of overwrite set. Header names are compared case-insensitive.
+// The header order of overwrite is used if present, otherwise headers missing in the order of base are appended to it.
+func mergeHeaders(base http.Header, overwrite http.Header) http.Header {
+	merged := base.Clone()
+	if merged == nil {
+		merged = make(http.Header)
+	}
+
+	order := allToLower(merged[http.HeaderOrderKey])
+
+	keys := make([]string, 0, len(overwrite))
+	for key := range overwrite {
+		if key != http.HeaderOrderKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		values := overwrite[key]
+
+		for existing := range merged {
+			if existing != http.HeaderOrderKey && strings.EqualFold(existing, key) {
+				delete(merged, existing)
+			}
+		}
+
+		merged[key] = append([]string(nil), values...)
+
+		if !slices.Contains(order, strings.ToLower(key)) {
+			order = append(order, strings.ToLower(key))
+		}
+	}
+
+	if overwriteOrder, ok := overwrite[http.HeaderOrderKey]; ok {
+		order = allToLower(overwriteOrder)
+	}
+
+	if len(order) > 0 {
+		merged[http.HeaderOrderKey] = order
+	}
+
+	return merged
+}
@@ -2,7 +2,10 @@ package tls_client
 
 import (
 	"math"
+	"reflect"
 	"testing"
+
+	http "github.com/bogdanfinn/fhttp"
 )
 
 func TestInt64ToInt(t *testing.T) {
@@ -95,3 +98,68 @@ func TestInt64ToInt(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeHeaders(t *testing.T) {
+	base := http.Header{
+		"accept":            {"*/*"},
+		"user-agent":        {"base"},
+		http.HeaderOrderKey: {"user-agent", "accept"},
+	}
+
+	tests := []struct {
+		name      string
+		overwrite http.Header
+		want      http.Header
+	}{
+		{
+			name:      "empty overwrite",
+			overwrite: nil,
+			want:      base,
+		},
+		{
+			name: "overwrite value case-insensitive",
+			overwrite: http.Header{
+				"User-Agent": {"overwrite"},
+			},
+			want: http.Header{
+				"accept":            {"*/*"},
+				"User-Agent":        {"overwrite"},
+				http.HeaderOrderKey: {"user-agent", "accept"},
+			},
+		},
+		{
+			name: "append new headers to order",
+			overwrite: http.Header{
+				"x-b": {"b"},
+				"X-A": {"a"},
+			},
+			want: http.Header{
+				"accept":            {"*/*"},
+				"user-agent":        {"base"},
+				"X-A":               {"a"},
+				"x-b":               {"b"},
+				http.HeaderOrderKey: {"user-agent", "accept", "x-a", "x-b"},
+			},
+		},
+		{
+			name: "overwrite order",
+			overwrite: http.Header{
+				http.HeaderOrderKey: {"Accept", "User-Agent"},
+			},
+			want: http.Header{
+				"accept":            {"*/*"},
+				"user-agent":        {"base"},
+				http.HeaderOrderKey: {"accept", "user-agent"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeHeaders(base, tt.overwrite)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeHeaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}